@@ -0,0 +1,248 @@
+package bluesky
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const DefaultServiceURL = "https://bsky.social"
+
+// Returned when a post can't be found, e.g. because it was deleted
+var ErrPostNotFound = errors.New("post not found")
+
+type Client struct {
+	serviceURL  string
+	identifier  string
+	appPassword string
+	HTTPClient  *http.Client
+
+	sessionLock sync.Mutex
+	session     *Session
+}
+
+// Error response from an XRPC endpoint
+type XRPCError struct {
+	StatusCode int
+	Name       string `json:"error"`
+	Message    string `json:"message"`
+	// When the rate limit resets, if the server sent one
+	RateLimitReset time.Time
+}
+
+func (e XRPCError) Error() string {
+	return fmt.Sprintf("bluesky callout status %d %s: %s", e.StatusCode, e.Name, e.Message)
+}
+
+/*
+Creates a client that signs in to the PDS at serviceURL as the given handle or DID.
+Use an app password rather than the account password.
+*/
+func NewClient(identifier string, appPassword string, serviceURL url.URL) *Client {
+	return &Client{
+		serviceURL:  serviceURL.String(),
+		identifier:  identifier,
+		appPassword: appPassword,
+		HTTPClient:  http.DefaultClient,
+	}
+}
+
+// Gets the handle or email the client signs in with
+func (c *Client) Identifier() string {
+	return c.identifier
+}
+
+// Gets the handle of the account the client is signed in as, whatever it signs in with
+func (c *Client) Handle(ctx context.Context) (string, error) {
+	session, err := c.getSession(ctx)
+	if err != nil {
+		return "", err
+	}
+	return session.Handle, nil
+}
+
+// Gets the DID of the account the client is signed in as
+func (c *Client) DID(ctx context.Context) (string, error) {
+	session, err := c.getSession(ctx)
+	if err != nil {
+		return "", err
+	}
+	return session.DID, nil
+}
+
+// Gets a page of notifications, newest first. Pass the returned cursor to get the next (older) page.
+func (c *Client) ListNotifications(ctx context.Context, cursor string, limit int) (*ListNotificationsResponse, error) {
+	params := url.Values{}
+	params.Add("limit", strconv.Itoa(limit))
+	if cursor != "" {
+		params.Add("cursor", cursor)
+	}
+	var resp ListNotificationsResponse
+	if err := c.query(ctx, "app.bsky.notification.listNotifications", params, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) GetPost(ctx context.Context, uri string) (*PostView, error) {
+	params := url.Values{}
+	params.Add("uris", uri)
+	var resp GetPostsResponse
+	if err := c.query(ctx, "app.bsky.feed.getPosts", params, &resp); err != nil {
+		return nil, err
+	}
+	// Deleted posts are silently left out of the response
+	if len(resp.Posts) == 0 {
+		return nil, ErrPostNotFound
+	}
+	return &resp.Posts[0], nil
+}
+
+func (c *Client) ResolveHandle(ctx context.Context, handle string) (string, error) {
+	params := url.Values{}
+	params.Add("handle", handle)
+	var resp ResolveHandleResponse
+	if err := c.query(ctx, "com.atproto.identity.resolveHandle", params, &resp); err != nil {
+		return "", err
+	}
+	return resp.DID, nil
+}
+
+// Creates a post in the signed-in account's repo
+func (c *Client) CreatePost(ctx context.Context, record PostRecord) (*CreateRecordResponse, error) {
+	did, err := c.DID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	record.Type = CollectionPost
+	var resp CreateRecordResponse
+	err = c.procedure(ctx, "com.atproto.repo.createRecord", CreateRecordRequest{
+		Repo:       did,
+		Collection: CollectionPost,
+		Record:     record,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) query(ctx context.Context, nsid string, params url.Values, result any) error {
+	return c.callWithSession(ctx, http.MethodGet, nsid+"?"+params.Encode(), nil, result)
+}
+
+func (c *Client) procedure(ctx context.Context, nsid string, input any, result any) error {
+	reqBody, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	return c.callWithSession(ctx, http.MethodPost, nsid, reqBody, result)
+}
+
+// Makes an authenticated call, refreshing the session and trying once more if the access token expired
+func (c *Client) callWithSession(ctx context.Context, method string, path string, body []byte, result any) error {
+	session, err := c.getSession(ctx)
+	if err != nil {
+		return err
+	}
+	err = c.call(ctx, method, path, session.AccessJwt, body, result)
+	var xrpcError *XRPCError
+	if errors.As(err, &xrpcError) && xrpcError.Name == "ExpiredToken" {
+		if session, err = c.refreshSession(ctx, session); err != nil {
+			return err
+		}
+		return c.call(ctx, method, path, session.AccessJwt, body, result)
+	}
+	return err
+}
+
+func (c *Client) call(ctx context.Context, method string, path string, token string, body []byte, result any) error {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.serviceURL+"/xrpc/"+path, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		xrpcError := &XRPCError{StatusCode: resp.StatusCode}
+		if err := json.Unmarshal(respBody, xrpcError); err != nil || xrpcError.Name == "" {
+			xrpcError.Name = http.StatusText(resp.StatusCode)
+		}
+		// Reset is sent as a unix timestamp
+		if reset, err := strconv.ParseInt(resp.Header.Get("RateLimit-Reset"), 10, 64); err == nil {
+			xrpcError.RateLimitReset = time.Unix(reset, 0)
+		}
+		return xrpcError
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, result)
+}
+
+func (c *Client) getSession(ctx context.Context) (*Session, error) {
+	c.sessionLock.Lock()
+	defer c.sessionLock.Unlock()
+	if c.session != nil {
+		return c.session, nil
+	}
+	reqBody, err := json.Marshal(map[string]string{
+		"identifier": c.identifier,
+		"password":   c.appPassword,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var session Session
+	if err := c.call(ctx, http.MethodPost, "com.atproto.server.createSession", "", reqBody, &session); err != nil {
+		return nil, err
+	}
+	c.session = &session
+	return c.session, nil
+}
+
+func (c *Client) refreshSession(ctx context.Context, expired *Session) (*Session, error) {
+	c.sessionLock.Lock()
+	defer c.sessionLock.Unlock()
+	if c.session != expired {
+		// Another caller already refreshed it
+		return c.session, nil
+	}
+	var session Session
+	if err := c.call(ctx, http.MethodPost, "com.atproto.server.refreshSession", expired.RefreshJwt, nil, &session); err != nil {
+		// The refresh token may have expired too, so start over with a new session next time
+		c.session = nil
+		return nil, err
+	}
+	c.session = &session
+	return c.session, nil
+}
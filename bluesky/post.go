@@ -0,0 +1,68 @@
+package bluesky
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	postURLRegexp = regexp.MustCompile(`^https?://bsky\.app/profile/(?P<Actor>[^/]+)/post/(?P<RecordKey>[a-z0-9]+)/?$`)
+	atURIRegexp   = regexp.MustCompile(`^at://(?P<Repo>[^/]+)/(?P<Collection>[^/]+)/(?P<RecordKey>[^/]+)$`)
+	// Loosely matches URLs and @handles in post text so they can be made into links
+	linkRegexp    = regexp.MustCompile(`https?://[^\s]+`)
+	mentionRegexp = regexp.MustCompile(`(?:^|\s)(@(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?\.)+[a-zA-Z][a-zA-Z0-9-]*)`)
+)
+
+// Builds the bsky.app web URL for a post from its AT URI
+func ConstructPostURL(handle string, uri string) (string, error) {
+	_, _, recordKey, err := ParseATURI(uri)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("https://bsky.app/profile/%s/post/%s", handle, recordKey), nil
+}
+
+// Takes in a bsky.app post URL and returns the handle (or DID) and record key of the post
+func DeconstructPostURL(postURL string) (string, string, error) {
+	matches := postURLRegexp.FindStringSubmatch(postURL)
+	if matches == nil {
+		return "", "", errors.New("not a bluesky post URL")
+	}
+	return matches[1], matches[2], nil
+}
+
+// Splits an AT URI like at://did:plc:abc/app.bsky.feed.post/3kabc into repo, collection, and record key
+func ParseATURI(uri string) (string, string, string, error) {
+	matches := atURIRegexp.FindStringSubmatch(uri)
+	if matches == nil {
+		return "", "", "", fmt.Errorf("not an AT URI: %s", uri)
+	}
+	return matches[1], matches[2], matches[3], nil
+}
+
+func ConstructATURI(did string, collection string, recordKey string) string {
+	return fmt.Sprintf("at://%s/%s/%s", did, collection, recordKey)
+}
+
+/*
+Finds the links and @handles in post text. Bluesky doesn't parse post text on its own, so
+without facets the links in a reply aren't clickable and mentions don't notify anyone.
+Mention facets need a DID, so handles are returned separately for the caller to resolve.
+*/
+func DetectFacets(text string) ([]Facet, map[string]FacetIndex) {
+	var facets []Facet
+	for _, match := range linkRegexp.FindAllStringIndex(text, -1) {
+		facets = append(facets, Facet{
+			Index:    FacetIndex{ByteStart: match[0], ByteEnd: match[1]},
+			Features: []FacetFeature{{Type: FacetTypeLink, URI: text[match[0]:match[1]]}},
+		})
+	}
+	mentions := map[string]FacetIndex{}
+	for _, match := range mentionRegexp.FindAllStringSubmatchIndex(text, -1) {
+		handle := strings.TrimPrefix(text[match[2]:match[3]], "@")
+		mentions[handle] = FacetIndex{ByteStart: match[2], ByteEnd: match[3]}
+	}
+	return facets, mentions
+}
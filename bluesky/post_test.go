@@ -0,0 +1,53 @@
+package bluesky
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeconstructPostURL(t *testing.T) {
+	t.Run("successfully parses bsky.app URLs", func(t *testing.T) {
+		actor, recordKey, err := DeconstructPostURL("https://bsky.app/profile/alice.bsky.social/post/3kq2fyzzb2k2a")
+		assert.NoError(t, err)
+		assert.Equal(t, "alice.bsky.social", actor)
+		assert.Equal(t, "3kq2fyzzb2k2a", recordKey)
+
+		actor, recordKey, err = DeconstructPostURL("https://bsky.app/profile/did:plc:abc123/post/3kq2fyzzb2k2a")
+		assert.NoError(t, err)
+		assert.Equal(t, "did:plc:abc123", actor)
+		assert.Equal(t, "3kq2fyzzb2k2a", recordKey)
+	})
+
+	t.Run("rejects non-Bluesky URLs", func(t *testing.T) {
+		actor, recordKey, err := DeconstructPostURL("https://www.someotherwebsite.com/profile/alice/post/3kq2fyzzb2k2a")
+		assert.Error(t, err)
+		assert.Equal(t, "", actor)
+		assert.Equal(t, "", recordKey)
+	})
+}
+
+func TestConstructPostURL(t *testing.T) {
+	postURL, err := ConstructPostURL("alice.bsky.social", "at://did:plc:abc123/app.bsky.feed.post/3kq2fyzzb2k2a")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://bsky.app/profile/alice.bsky.social/post/3kq2fyzzb2k2a", postURL)
+
+	_, err = ConstructPostURL("alice.bsky.social", "https://bsky.app/")
+	assert.Error(t, err)
+}
+
+func TestDetectFacets(t *testing.T) {
+	text := "🔴 Verdict >\nhttps://example.com/media?id=abc\n\nThank you for submitting this, @alice.bsky.social."
+	facets, mentions := DetectFacets(text)
+
+	assert.Len(t, facets, 1)
+	link := facets[0]
+	assert.Equal(t, FacetTypeLink, link.Features[0].Type)
+	assert.Equal(t, "https://example.com/media?id=abc", link.Features[0].URI)
+	// Offsets are in bytes, so the emoji counts for more than one
+	assert.Equal(t, "https://example.com/media?id=abc", text[link.Index.ByteStart:link.Index.ByteEnd])
+
+	assert.Contains(t, mentions, "alice.bsky.social")
+	index := mentions["alice.bsky.social"]
+	assert.Equal(t, "@alice.bsky.social", text[index.ByteStart:index.ByteEnd])
+}
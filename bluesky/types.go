@@ -0,0 +1,127 @@
+package bluesky
+
+import "time"
+
+const (
+	CollectionPost = "app.bsky.feed.post"
+
+	NotificationReasonMention = "mention"
+
+	EmbedTypeImagesView          = "app.bsky.embed.images#view"
+	EmbedTypeVideoView           = "app.bsky.embed.video#view"
+	EmbedTypeExternalView        = "app.bsky.embed.external#view"
+	EmbedTypeRecordWithMediaView = "app.bsky.embed.recordWithMedia#view"
+
+	FacetTypeLink    = "app.bsky.richtext.facet#link"
+	FacetTypeMention = "app.bsky.richtext.facet#mention"
+)
+
+type Session struct {
+	AccessJwt  string `json:"accessJwt"`
+	RefreshJwt string `json:"refreshJwt"`
+	Handle     string `json:"handle"`
+	DID        string `json:"did"`
+}
+
+type ProfileView struct {
+	DID    string `json:"did"`
+	Handle string `json:"handle"`
+}
+
+// A reference to a specific version of a record
+type StrongRef struct {
+	URI string `json:"uri"`
+	CID string `json:"cid"`
+}
+
+type ReplyRef struct {
+	Root   StrongRef `json:"root"`
+	Parent StrongRef `json:"parent"`
+}
+
+type Facet struct {
+	Index    FacetIndex     `json:"index"`
+	Features []FacetFeature `json:"features"`
+}
+
+// Facet positions are UTF-8 byte offsets into the post text
+type FacetIndex struct {
+	ByteStart int `json:"byteStart"`
+	ByteEnd   int `json:"byteEnd"`
+}
+
+type FacetFeature struct {
+	Type string `json:"$type"`
+	URI  string `json:"uri,omitempty"`
+	DID  string `json:"did,omitempty"`
+}
+
+type PostRecord struct {
+	Type      string    `json:"$type"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"createdAt"`
+	Reply     *ReplyRef `json:"reply,omitempty"`
+	Facets    []Facet   `json:"facets,omitempty"`
+	Langs     []string  `json:"langs,omitempty"`
+}
+
+// The hydrated form of an embed. Only what's needed to tell whether a post carries media is decoded.
+type EmbedView struct {
+	Type  string     `json:"$type"`
+	Media *EmbedView `json:"media,omitempty"`
+}
+
+type PostView struct {
+	URI       string      `json:"uri"`
+	CID       string      `json:"cid"`
+	Author    ProfileView `json:"author"`
+	Record    PostRecord  `json:"record"`
+	Embed     *EmbedView  `json:"embed,omitempty"`
+	IndexedAt time.Time   `json:"indexedAt"`
+}
+
+type Notification struct {
+	URI       string      `json:"uri"`
+	CID       string      `json:"cid"`
+	Author    ProfileView `json:"author"`
+	Reason    string      `json:"reason"`
+	Record    PostRecord  `json:"record"`
+	IsRead    bool        `json:"isRead"`
+	IndexedAt time.Time   `json:"indexedAt"`
+}
+
+type ListNotificationsResponse struct {
+	Cursor        string         `json:"cursor"`
+	Notifications []Notification `json:"notifications"`
+}
+
+type GetPostsResponse struct {
+	Posts []PostView `json:"posts"`
+}
+
+type ResolveHandleResponse struct {
+	DID string `json:"did"`
+}
+
+type CreateRecordRequest struct {
+	Repo       string     `json:"repo"`
+	Collection string     `json:"collection"`
+	Record     PostRecord `json:"record"`
+}
+
+type CreateRecordResponse struct {
+	URI string `json:"uri"`
+	CID string `json:"cid"`
+}
+
+// Whether the post has images or a video embedded, either directly or alongside a quoted post
+func (p PostView) HasMedia() bool {
+	if p.Embed == nil {
+		return false
+	}
+	embed := p.Embed
+	if embed.Type == EmbedTypeRecordWithMediaView && embed.Media != nil {
+		embed = embed.Media
+	}
+	return embed.Type == EmbedTypeImagesView || embed.Type == EmbedTypeVideoView
+}
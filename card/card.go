@@ -0,0 +1,195 @@
+package card
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// Large enough to stay sharp in timelines, in the 1.91:1 ratio social sites use for link cards
+	Width  = 1200
+	Height = 628
+
+	bandWidth     = 48
+	margin        = 64
+	thumbnailSize = 420
+	// How many model scores to list on the card
+	maxScores = 4
+)
+
+var (
+	ColorHigh      = color.RGBA{0xD7, 0x26, 0x3D, 0xFF}
+	ColorUncertain = color.RGBA{0xF2, 0xA9, 0x00, 0xFF}
+	ColorLow       = color.RGBA{0x2E, 0x9E, 0x44, 0xFF}
+	ColorUnknown   = color.RGBA{0x8A, 0x8F, 0x98, 0xFF}
+
+	backgroundColor = color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	textColor       = color.RGBA{0x1F, 0x23, 0x28, 0xFF}
+	mutedTextColor  = color.RGBA{0x5F, 0x66, 0x6D, 0xFF}
+)
+
+// A detector's contribution to the verdict, as shown on the card
+type Score struct {
+	Model string
+	// Between 0 and 1
+	Score float64
+}
+
+// Everything shown on a verdict card
+type Card struct {
+	// Colour of the band down the left edge
+	Color color.Color
+	// Small text above the label, such as "TrueMedia.org verdict"
+	Heading string
+	// The verdict, such as "Substantial evidence of manipulation"
+	Label string
+	// Small text above the scores, such as "Top detectors"
+	ScoresHeading string
+	// Highest-scoring models first; only the first few are drawn
+	Scores []Score
+	// Optional image of the analyzed media
+	Thumbnail image.Image
+}
+
+// Draws the card and encodes it as a PNG
+func Render(c Card) ([]byte, error) {
+	faces, err := loadFaces()
+	if err != nil {
+		return nil, err
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, Width, Height))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(backgroundColor), image.Point{}, draw.Src)
+	draw.Draw(canvas, image.Rect(0, 0, bandWidth, Height), image.NewUniform(c.Color), image.Point{}, draw.Src)
+
+	textRight := Width - margin
+	if c.Thumbnail != nil {
+		thumbnailRect := image.Rect(Width-margin-thumbnailSize, (Height-thumbnailSize)/2, Width-margin, (Height+thumbnailSize)/2)
+		drawThumbnail(canvas, thumbnailRect, c.Thumbnail)
+		textRight = thumbnailRect.Min.X - margin
+	}
+
+	x := bandWidth + margin
+	y := margin + 36
+	drawText(canvas, faces.small, mutedTextColor, x, y, c.Heading)
+	y += 80
+	for _, line := range wrap(faces.title, c.Label, textRight-x) {
+		drawText(canvas, faces.title, c.Color, x, y, line)
+		y += 68
+	}
+
+	if len(c.Scores) > 0 {
+		y += 24
+		drawText(canvas, faces.small, mutedTextColor, x, y, c.ScoresHeading)
+		y += 48
+		for i, score := range c.Scores {
+			if i == maxScores {
+				break
+			}
+			percent := fmt.Sprintf("%.0f%%", score.Score*100)
+			drawText(canvas, faces.body, textColor, x, y, truncate(faces.body, score.Model, textRight-x-120))
+			drawText(canvas, faces.body, textColor, textRight-font.MeasureString(faces.body, percent).Ceil(), y, percent)
+			y += 46
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, canvas); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type faceSet struct {
+	title font.Face
+	body  font.Face
+	small font.Face
+}
+
+func loadFaces() (*faceSet, error) {
+	bold, err := opentype.Parse(gobold.TTF)
+	if err != nil {
+		return nil, err
+	}
+	regular, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		return nil, err
+	}
+	title, err := opentype.NewFace(bold, &opentype.FaceOptions{Size: 56, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	body, err := opentype.NewFace(regular, &opentype.FaceOptions{Size: 34, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	small, err := opentype.NewFace(regular, &opentype.FaceOptions{Size: 28, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	return &faceSet{title: title, body: body, small: small}, nil
+}
+
+func drawText(canvas draw.Image, face font.Face, c color.Color, x int, y int, text string) {
+	drawer := font.Drawer{
+		Dst:  canvas,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  fixed.P(x, y),
+	}
+	drawer.DrawString(text)
+}
+
+// Scales the thumbnail to fit inside rect, keeping its aspect ratio, and centers it there
+func drawThumbnail(canvas draw.Image, rect image.Rectangle, thumbnail image.Image) {
+	bounds := thumbnail.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return
+	}
+	scale := min(float64(rect.Dx())/float64(bounds.Dx()), float64(rect.Dy())/float64(bounds.Dy()))
+	w := int(float64(bounds.Dx()) * scale)
+	h := int(float64(bounds.Dy()) * scale)
+	target := image.Rect(0, 0, w, h).Add(image.Pt(rect.Min.X+(rect.Dx()-w)/2, rect.Min.Y+(rect.Dy()-h)/2))
+	draw.CatmullRom.Scale(canvas, target, thumbnail, bounds, draw.Over, nil)
+}
+
+// Breaks text into lines no wider than maxWidth
+func wrap(face font.Face, text string, maxWidth int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		candidate := strings.TrimSpace(line + " " + word)
+		if line != "" && font.MeasureString(face, candidate).Ceil() > maxWidth {
+			lines = append(lines, line)
+			candidate = word
+		}
+		line = candidate
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Shortens text with an ellipsis until it's no wider than maxWidth
+func truncate(face font.Face, text string, maxWidth int) string {
+	if font.MeasureString(face, text).Ceil() <= maxWidth {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && font.MeasureString(face, string(runes)+"…").Ceil() > maxWidth {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
@@ -0,0 +1,29 @@
+package card
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	thumbnail := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	cardPNG, err := Render(Card{
+		Color:         ColorHigh,
+		Heading:       "TrueMedia.org verdict",
+		Label:         "Substantial evidence of manipulation",
+		ScoresHeading: "Top detectors",
+		Scores:        []Score{{Model: "faces", Score: 0.97}, {Model: "voice", Score: 0.4}},
+		Thumbnail:     thumbnail,
+	})
+	assert.Nil(t, err)
+
+	decoded, err := png.Decode(bytes.NewReader(cardPNG))
+	assert.Nil(t, err)
+	assert.Equal(t, image.Rect(0, 0, Width, Height), decoded.Bounds())
+	assert.Equal(t, ColorHigh, color.RGBAModel.Convert(decoded.At(bandWidth/2, Height/2)))
+}
@@ -0,0 +1,61 @@
+package card
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"time"
+
+	// Register the formats social platforms serve previews in
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	thumbnailTimeout = 10 * time.Second
+	// Previews are small; anything much bigger isn't worth holding in memory
+	maxThumbnailBytes = 10 << 20
+	// A small file can still decode to a huge image, so the header is checked against this before decoding
+	maxThumbnailPixels = 4096 * 4096
+)
+
+// Downloads and decodes an image to use as a card thumbnail
+func FetchThumbnail(ctx context.Context, url string) (image.Image, error) {
+	ctx, cancel := context.WithTimeout(ctx, thumbnailTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status fetching thumbnail: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxThumbnailBytes))
+	if err != nil {
+		return nil, err
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > maxThumbnailPixels {
+		return nil, fmt.Errorf("thumbnail too large: %dx%d", config.Width, config.Height)
+	}
+	thumbnail, _, err := image.Decode(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	return thumbnail, nil
+}
@@ -0,0 +1,52 @@
+package card
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Encodes a tiny PNG, then rewrites its header to claim it's width by height
+func pngClaimingSize(t *testing.T, width, height uint32) []byte {
+	var buf bytes.Buffer
+	assert.Nil(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))))
+	encoded := buf.Bytes()
+	// The IHDR chunk follows the 8-byte signature: length, type, then width and height
+	ihdr := encoded[8+4 : 8+4+4+13]
+	binary.BigEndian.PutUint32(ihdr[4:], width)
+	binary.BigEndian.PutUint32(ihdr[8:], height)
+	binary.BigEndian.PutUint32(encoded[8+4+4+13:], crc32.ChecksumIEEE(ihdr))
+	return encoded
+}
+
+func serveImage(t *testing.T, body []byte) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestFetchThumbnail(t *testing.T) {
+	t.Run("decodes a preview", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.Nil(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 64, 32))))
+		thumbnail, err := FetchThumbnail(context.Background(), serveImage(t, buf.Bytes()))
+		assert.Nil(t, err)
+		assert.Equal(t, image.Rect(0, 0, 64, 32), thumbnail.Bounds())
+	})
+
+	t.Run("rejects an image too big to decode", func(t *testing.T) {
+		thumbnail, err := FetchThumbnail(context.Background(), serveImage(t, pngClaimingSize(t, 100000, 100000)))
+		assert.ErrorContains(t, err, "too large")
+		assert.Nil(t, thumbnail)
+	})
+}
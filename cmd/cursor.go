@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/truemediaorg/socialbot/config"
+	"github.com/truemediaorg/socialbot/database"
+	"github.com/truemediaorg/socialbot/model"
+)
+
+var (
+	cursorAccount string
+	cursorTo      string
+)
+
+func init() {
+	cursorResetCmd.Flags().StringVar(&cursorAccount, "account", "", "only reset the cursor for this bot account (default all accounts)")
+	cursorResetCmd.Flags().StringVar(&cursorTo, "to", "", "set the cursor to this platform ID instead of removing it; requires --account")
+	cursorCmd.AddCommand(cursorListCmd, cursorResetCmd)
+	rootCmd.AddCommand(cursorCmd)
+}
+
+var cursorCmd = &cobra.Command{
+	Use:   "cursor",
+	Short: "Inspects and resets the watchers' polling cursors",
+	Long:  `Inspects and resets the watchers' polling cursors, which record the newest mention handled for each bot account`,
+}
+
+var cursorListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the polling cursor for every platform and account",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db := connectAdminDatabase(cmd.Context())
+		defer db.Disconnect()
+
+		cursors, err := db.ListCursors(cmd.Context())
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PLATFORM\tACCOUNT\tCURSOR\tUPDATED")
+		for _, cursor := range cursors {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", cursor.Platform, cursor.Account, cursor.Value, cursor.Updated.Format(time.RFC3339))
+		}
+		return w.Flush()
+	},
+}
+
+var cursorResetCmd = &cobra.Command{
+	Use:   "reset PLATFORM",
+	Short: "Resets the polling cursor for a platform",
+	Long: `Resets the polling cursor for a platform.
+Without --to, the cursor is removed and the watcher goes back to starting from the newest mention in the queue.
+With --to, the cursor is set to the given platform ID, even if that's older than where it is now, so mentions
+after it are fetched again.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		platform, err := model.ParsePlatform(args[0])
+		if err != nil {
+			return err
+		}
+		if cursorTo != "" && cursorAccount == "" {
+			return fmt.Errorf("--to requires --account")
+		}
+
+		db := connectAdminDatabase(cmd.Context())
+		defer db.Disconnect()
+
+		if cursorTo != "" {
+			if err := db.SetCursor(cmd.Context(), platform, cursorAccount, cursorTo); err != nil {
+				return err
+			}
+			fmt.Printf("Set %s cursor for %s to %s\n", platform, cursorAccount, cursorTo)
+			return nil
+		}
+		deleted, err := db.DeleteCursors(cmd.Context(), platform, cursorAccount)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Removed %d %s cursor(s)\n", deleted, platform)
+		return nil
+	},
+}
+
+// Sets up logging and connects to the database for admin commands
+func connectAdminDatabase(ctx context.Context) *database.Database {
+	cfg, secretsManagerClient := setupAdminCommand(ctx)
+	return connectDatabase(ctx, cfg, secretsManagerClient)
+}
+
+// Loads the config and sets up logging for admin commands, returning a Secrets Manager client for the services they need
+func setupAdminCommand(ctx context.Context) (config.Config, *secretsmanager.Client) {
+	cfg := config.FromEnvfile()
+
+	log.SetLevel(cfg.LogLevel)
+	switch cfg.LogFormat {
+	case config.LogFormatJSON:
+		log.SetFormatter(&log.JSONFormatter{})
+	default:
+		log.SetFormatter(&log.TextFormatter{})
+	}
+
+	awsConfig, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return cfg, secretsmanager.NewFromConfig(awsConfig)
+}
+
+func connectDatabase(ctx context.Context, cfg config.Config, secretsManagerClient *secretsmanager.Client) *database.Database {
+	db := database.NewDatabase(getDatabaseURL(cfg, secretsManagerClient))
+	if err := db.Connect(ctx); err != nil {
+		log.Fatalf("error connecting to database: %v", err)
+	}
+	return db
+}
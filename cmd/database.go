@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	log "github.com/sirupsen/logrus"
+	"github.com/truemediaorg/socialbot/config"
+)
+
+// Gets the Postgres connection string, from the config if it's there and from AWS Secrets Manager if not
+func getDatabaseURL(cfg config.Config, secretsManagerClient *secretsmanager.Client) string {
+	if cfg.PostgresURL != "" {
+		return cfg.PostgresURL
+	}
+	// Get the DB secrets from AWS Secrets Manager
+	result, err := secretsManagerClient.GetSecretValue(context.Background(), &secretsmanager.GetSecretValueInput{SecretId: aws.String(cfg.PostgresSecretPath)})
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	var pgSecrets config.PostgresSecretData
+	err = json.Unmarshal([]byte(*result.SecretString), &pgSecrets)
+	if err != nil {
+		log.Fatalf("postgres secrets read error: %v", err)
+	}
+	return pgSecrets.ConnectionString
+}
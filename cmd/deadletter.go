@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/truemediaorg/socialbot/database/db"
+)
+
+func init() {
+	deadletterCmd.AddCommand(deadletterListCmd, deadletterRequeueCmd)
+	rootCmd.AddCommand(deadletterCmd)
+}
+
+var deadletterCmd = &cobra.Command{
+	Use:   "deadletter",
+	Short: "Inspects and requeues abandoned mentions",
+	Long:  `Inspects and requeues mentions the responders gave up on after too many failed attempts`,
+}
+
+var deadletterListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists abandoned mentions, oldest first",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database := connectAdminDatabase(cmd.Context())
+		defer database.Disconnect()
+
+		mentions, err := database.ListMentionsByState(cmd.Context(), db.MentionStateAbandoned)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tPLATFORM\tPLATFORM ID\tATTEMPTS\tENQUEUED\tLAST ERROR")
+		for _, mention := range mentions {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", mention.ID, mention.Platform, mention.PlatformID, mention.Attempts, mention.Enqueued.Format(time.RFC3339), mention.LastError)
+		}
+		return w.Flush()
+	},
+}
+
+var deadletterRequeueCmd = &cobra.Command{
+	Use:   "requeue ID...",
+	Short: "Puts abandoned or failed mentions back in the queue",
+	Long: `Puts abandoned or failed mentions back in the queue, clearing their attempts and last error,
+so the responders try them again right away.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database := connectAdminDatabase(cmd.Context())
+		defer database.Disconnect()
+
+		for _, id := range args {
+			requeued, err := database.RequeueMention(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+			if requeued {
+				fmt.Printf("Requeued %s\n", id)
+			} else {
+				fmt.Printf("Skipped %s: no failed or abandoned mention with that ID\n", id)
+			}
+		}
+		return nil
+	},
+}
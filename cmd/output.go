@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// How the operator commands print what they find, set by --output
+var outputFormat string
+
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputTable, `output format, "table" or "json"`)
+}
+
+// Checks --output before a command does anything, so a typo doesn't cost a round trip
+func checkOutputFormat(cmd *cobra.Command, args []string) error {
+	if outputFormat != outputTable && outputFormat != outputJSON {
+		return fmt.Errorf("unknown output format %q; use %q or %q", outputFormat, outputTable, outputJSON)
+	}
+	return nil
+}
+
+func printJSON(v any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func newTableWriter() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+}
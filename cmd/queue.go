@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/truemediaorg/socialbot/database/db"
+	"github.com/truemediaorg/socialbot/service"
+)
+
+var queueStates []string
+
+func init() {
+	addOutputFlag(queueCmd)
+	defaultStates := make([]string, 0, len(service.UnfinishedMentionStates))
+	for _, state := range service.UnfinishedMentionStates {
+		defaultStates = append(defaultStates, string(state))
+	}
+	queueListCmd.Flags().StringSliceVar(&queueStates, "state", defaultStates, "only list mentions in these states")
+	queueCmd.AddCommand(queueListCmd, queueShowCmd, queueRetryCmd, queueDeleteCmd)
+	rootCmd.AddCommand(queueCmd)
+}
+
+var queueCmd = &cobra.Command{
+	Use:   "queue",
+	Short: "Inspects and fixes up the mention queue",
+	Long:  `Inspects and fixes up the mention queue, for when a mention is stuck or shouldn't be replied to`,
+}
+
+var queueListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "Lists queued mentions, oldest first",
+	Long:    `Lists queued mentions, oldest first. By default this is every mention the bot hasn't finished with.`,
+	Args:    cobra.NoArgs,
+	PreRunE: checkOutputFormat,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		states := make([]db.MentionState, 0, len(queueStates))
+		for _, state := range queueStates {
+			states = append(states, db.MentionState(strings.ToUpper(state)))
+		}
+
+		database := connectAdminDatabase(cmd.Context())
+		defer database.Disconnect()
+
+		mentions, err := database.ListMentionsByState(cmd.Context(), states...)
+		if err != nil {
+			return err
+		}
+		if outputFormat == outputJSON {
+			views := make([]service.MentionView, 0, len(mentions))
+			for _, mention := range mentions {
+				views = append(views, service.DescribeMention(cmd.Context(), nil, mention, nil))
+			}
+			return printJSON(views)
+		}
+		w := newTableWriter()
+		fmt.Fprintln(w, "ID\tPLATFORM\tPLATFORM ID\tSTATE\tATTEMPTS\tENQUEUED\tLAST ERROR")
+		for _, mention := range mentions {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", mention.ID, mention.Platform, mention.PlatformID, mention.State, mention.Attempts, mention.Enqueued.Format(time.RFC3339), mention.LastError)
+		}
+		return w.Flush()
+	},
+}
+
+var queueShowCmd = &cobra.Command{
+	Use:     "show ID",
+	Short:   "Shows a mention with its analyses and replies",
+	Long:    `Shows a mention, with the state of its analyses on TrueMedia and the replies posted to it`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: checkOutputFormat,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, secretsManagerClient := setupAdminCommand(cmd.Context())
+		database := connectDatabase(cmd.Context(), cfg, secretsManagerClient)
+		defer database.Disconnect()
+		truemediaService := service.NewTruemediaService(cfg, secretsManagerClient)
+
+		mention, err := database.GetMention(cmd.Context(), args[0])
+		if err != nil {
+			return err
+		}
+		if mention == nil {
+			return fmt.Errorf("no mention with ID %s", args[0])
+		}
+		replies, err := database.FindRepliesForMention(cmd.Context(), mention.ID)
+		if err != nil {
+			return err
+		}
+		view := service.DescribeMention(cmd.Context(), truemediaService, *mention, map[string]service.AnalysisView{})
+		view.Replies = service.DescribeReplies(replies)
+		if outputFormat == outputJSON {
+			return printJSON(view)
+		}
+		return printMentionTable(view)
+	},
+}
+
+var queueRetryCmd = &cobra.Command{
+	Use:   "retry ID...",
+	Short: "Puts failed or abandoned mentions back in the queue",
+	Long: `Puts failed or abandoned mentions back in the queue, clearing their attempts and last error,
+so the responders try them again right away. The same as "deadletter requeue".`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: deadletterRequeueCmd.RunE,
+}
+
+var queueDeleteCmd = &cobra.Command{
+	Use:   "delete ID...",
+	Short: "Deletes mentions from the queue",
+	Long:  `Deletes mentions from the queue, so the bot stops working on them and never replies to them again`,
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database := connectAdminDatabase(cmd.Context())
+		defer database.Disconnect()
+
+		for _, id := range args {
+			mention, err := database.GetMention(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+			if mention == nil {
+				fmt.Printf("Skipped %s: no mention with that ID\n", id)
+				continue
+			}
+			if err := database.DeleteMention(cmd.Context(), id); err != nil {
+				return err
+			}
+			fmt.Printf("Deleted %s (%s %s)\n", id, mention.Platform, mention.PlatformID)
+		}
+		return nil
+	},
+}
+
+func printMentionTable(view service.MentionView) error {
+	w := newTableWriter()
+	fmt.Fprintf(w, "ID\t%s\n", view.ID)
+	fmt.Fprintf(w, "PLATFORM\t%s\n", view.Platform)
+	fmt.Fprintf(w, "PLATFORM ID\t%s\n", view.PlatformID)
+	fmt.Fprintf(w, "USER\t%s\n", view.UserName)
+	fmt.Fprintf(w, "STATE\t%s\n", view.State)
+	fmt.Fprintf(w, "ATTEMPTS\t%d\n", view.Attempts)
+	fmt.Fprintf(w, "ENQUEUED\t%s\n", view.Enqueued.Format(time.RFC3339))
+	if view.NextAttemptAt != nil {
+		fmt.Fprintf(w, "NEXT ATTEMPT\t%s\n", view.NextAttemptAt.Format(time.RFC3339))
+	}
+	fmt.Fprintf(w, "LAST ERROR\t%s\n", view.LastError)
+	fmt.Fprintf(w, "MEDIA POST\t%s\n", view.MediaPostURL)
+	fmt.Fprintf(w, "FAILURE REASON\t%s\n", view.FailureReason)
+	fmt.Fprintf(w, "COMMAND\t%s\n", view.Command)
+	fmt.Fprintf(w, "TRACE ID\t%s\n", view.TraceID)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	w = newTableWriter()
+	fmt.Fprintln(w, "MEDIA ID\tSTATE\tVERDICT\tERRORS")
+	for _, analysis := range view.Analyses {
+		errors := strings.Join(analysis.Errors, "; ")
+		if analysis.Error != "" {
+			errors = "couldn't fetch analysis: " + analysis.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", analysis.MediaID, analysis.State, analysis.Verdict, errors)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	w = newTableWriter()
+	fmt.Fprintln(w, "REPLY ID\tTYPE\tPLATFORM ID\tREPLIED")
+	for _, reply := range view.Replies {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", reply.ID, reply.Type, reply.PlatformID, reply.Replied.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var replyMentionID string
+
+func init() {
+	replyCmd.Flags().StringVar(&replyMentionID, "mention", "", "ID of the mention to reply to")
+	replyCmd.MarkFlagRequired("mention")
+	rootCmd.AddCommand(replyCmd)
+}
+
+var replyCmd = &cobra.Command{
+	Use:   "reply --mention ID",
+	Short: "Makes the bot reply to a mention again",
+	Long: `Makes the bot reply to a mention again, e.g. after its reply was deleted or went out wrong.
+The mention's final and error replies are marked superseded and it goes back in the queue, so a running
+server's responders post a fresh reply once the analysis is done. The earlier replies stay up. If X rejects
+the fresh reply as identical to one already posted, the mention is marked replied without a new post.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database := connectAdminDatabase(cmd.Context())
+		defer database.Disconnect()
+
+		reopened, err := database.ReopenMention(cmd.Context(), replyMentionID)
+		if err != nil {
+			return err
+		}
+		if !reopened {
+			return fmt.Errorf("no mention with ID %s", replyMentionID)
+		}
+		fmt.Printf("Queued %s for a fresh reply\n", replyMentionID)
+		return nil
+	},
+}
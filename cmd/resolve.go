@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/truemediaorg/socialbot/service"
+	"github.com/truemediaorg/socialbot/truemedia"
+)
+
+func init() {
+	addOutputFlag(resolveCmd)
+	rootCmd.AddCommand(resolveCmd)
+}
+
+type resolveResult struct {
+	PostURL       string                  `json:"postUrl"`
+	MediaIDs      []string                `json:"mediaIds"`
+	FailureReason truemedia.FailureReason `json:"failureReason,omitempty"`
+	Messages      []string                `json:"messages,omitempty"`
+}
+
+var resolveCmd = &cobra.Command{
+	Use:   "resolve POST_URL",
+	Short: "Resolves the media in a post through TrueMedia",
+	Long: `Resolves the media in a post through TrueMedia, the same way the watcher does for a mention,
+and prints the media IDs found or why there weren't any. TrueMedia starts analyzing any new media it finds.`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: checkOutputFormat,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, secretsManagerClient := setupAdminCommand(cmd.Context())
+		truemediaService := service.NewTruemediaService(cfg, secretsManagerClient)
+
+		result := resolveResult{PostURL: args[0], MediaIDs: []string{}}
+		mediaIDs, err := truemediaService.ResolvePostMedia(cmd.Context(), args[0])
+		var failure *truemedia.FailureError
+		if errors.As(err, &failure) {
+			result.FailureReason = failure.Reason
+			result.Messages = failure.Messages
+		} else if err != nil {
+			return err
+		} else {
+			result.MediaIDs = mediaIDs
+		}
+
+		if outputFormat == outputJSON {
+			return printJSON(result)
+		}
+		if result.FailureReason != "" {
+			fmt.Printf("Couldn't resolve media (%s): %s\n", result.FailureReason, strings.Join(result.Messages, "; "))
+			return nil
+		}
+		w := newTableWriter()
+		fmt.Fprintln(w, "MEDIA ID")
+		for _, mediaID := range result.MediaIDs {
+			fmt.Fprintln(w, mediaID)
+		}
+		return w.Flush()
+	},
+}
@@ -2,24 +2,37 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
 	"os/signal"
+	"slices"
 	"syscall"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/truemediaorg/socialbot/config"
 	"github.com/truemediaorg/socialbot/database"
+	"github.com/truemediaorg/socialbot/health"
+	"github.com/truemediaorg/socialbot/messages"
+	"github.com/truemediaorg/socialbot/model"
+	"github.com/truemediaorg/socialbot/platform"
 	"github.com/truemediaorg/socialbot/responder"
 	"github.com/truemediaorg/socialbot/service"
+	"github.com/truemediaorg/socialbot/tracing"
 	"github.com/truemediaorg/socialbot/watcher"
 	"golang.org/x/sync/errgroup"
 )
 
+const (
+	// Checked for readiness when the bot watches X
+	xAPIURL = "https://api.twitter.com"
+	// Responders beat every few seconds, but a pass over a full batch of mentions can take a while
+	responderHeartbeatMaxAge = 5 * time.Minute
+)
+
 func init() {
 	rootCmd.AddCommand(serverCmd)
 }
@@ -44,6 +57,13 @@ var serverCmd = &cobra.Command{
 		if cfg.TestModeEnabled {
 			log.Info("TEST MODE ENABLED")
 		}
+		log.WithField("workerID", cfg.WorkerID).Info("starting socialbot")
+
+		// Check the reply copy up front so template mistakes don't surface mid-reply
+		catalog, err := messages.Load(cfg.MessagesDir)
+		if err != nil {
+			log.Fatalf("error loading reply templates: %v", err)
+		}
 
 		awsConfig, err := awsconfig.LoadDefaultConfig(context.Background())
 		if err != nil {
@@ -51,20 +71,20 @@ var serverCmd = &cobra.Command{
 		}
 		secretsManagerClient := secretsmanager.NewFromConfig(awsConfig)
 
-		databaseURL := cfg.PostgresURL
-		if databaseURL == "" {
-			// Get the DB secrets from AWS Secrets Manager
-			result, err := secretsManagerClient.GetSecretValue(context.Background(), &secretsmanager.GetSecretValueInput{SecretId: aws.String(cfg.PostgresSecretPath)})
-			if err != nil {
-				log.Fatal(err.Error())
-			}
-			var pgSecrets config.PostgresSecretData
-			err = json.Unmarshal([]byte(*result.SecretString), &pgSecrets)
-			if err != nil {
-				log.Fatalf("postgres secrets read error: %v", err)
-			}
-			databaseURL = pgSecrets.ConnectionString
+		databaseURL := getDatabaseURL(cfg, secretsManagerClient)
+
+		shutdownTracing, err := tracing.Setup(context.Background(), cfg.OTLPEndpoint, cfg.WorkerID)
+		if err != nil {
+			log.Fatalf("error setting up tracing: %v", err)
 		}
+		defer func() {
+			// Send off the last spans before exiting
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdownTracing(shutdownCtx); err != nil {
+				log.Warnf("error flushing traces: %v", err)
+			}
+		}()
 
 		/*
 			Graceful shutdown is possible with errgroup + signal.NotifyContext
@@ -75,7 +95,6 @@ var serverCmd = &cobra.Command{
 		defer done()
 		g, gCtx := errgroup.WithContext(ctx)
 
-		twitterService := service.NewTwitterService(gCtx, cfg, secretsManagerClient)
 		truemediaService := service.NewTruemediaService(cfg, secretsManagerClient)
 
 		database := database.NewDatabase(databaseURL)
@@ -84,21 +103,63 @@ var serverCmd = &cobra.Command{
 		}
 		defer database.Disconnect()
 
-		watcher := watcher.NewWatcher(twitterService, truemediaService, database)
+		healthchecker := service.NewHealthchecker(8080)
+		healthchecker.Handle("/metrics", promhttp.Handler())
+
+		checker := health.NewChecker()
+		checker.AddDependency("postgres", database.Ping)
+		dependencyClient := &http.Client{}
+		checker.AddDependency("truemedia", health.Reachable(dependencyClient, cfg.Truemedia.ApiURL.String()))
+		if slices.Contains(cfg.Platforms, model.PlatformX) {
+			checker.AddDependency("x", health.Reachable(dependencyClient, xAPIURL))
+		}
+		healthchecker.Handle("/livez", checker.LivenessHandler())
+		healthchecker.Handle("/readyz", checker.ReadinessHandler())
+
+		var adminService *service.AdminService
+		if cfg.AdminSecretPath != "" {
+			adminService = service.NewAdminService(cfg, secretsManagerClient, database, truemediaService)
+			healthchecker.Handle("/admin/", adminService.Handler())
+		}
 
-		responder := responder.NewResponder(twitterService, truemediaService, database, cfg.TestModeEnabled)
+		// Each enabled platform gets its own watcher/responder pair
+		var responders []*responder.Responder
+		for _, platformName := range cfg.Platforms {
+			socialPlatform := newSocialPlatform(gCtx, platformName, cfg, secretsManagerClient)
+			watcher := watcher.NewWatcher(socialPlatform, truemediaService, database)
+			responder := responder.NewResponder(socialPlatform, truemediaService, database, catalog, cfg.Truemedia.ResultsURL, cfg.WorkerID, cfg.TestModeEnabled)
+			responders = append(responders, responder)
+			// Watchers beat once per poll; leave room for a slow poll before calling one stuck
+			watcher.Heartbeat = checker.AddHeartbeat("watcher "+string(platformName), 2*socialPlatform.PollInterval()+time.Minute)
+			responder.Heartbeat = checker.AddHeartbeat("responder "+string(platformName), responderHeartbeatMaxAge)
+			if adminService != nil {
+				adminService.AddPoller(platformName, watcher.PollNow)
+			}
 
-		healthchecker := service.NewHealthchecker(8080)
+			if twitterService, ok := socialPlatform.(*service.TwitterService); ok && cfg.Twitter.WebhookEnabled {
+				healthchecker.Handle("/webhooks/x", twitterService.WebhookHandler(watcher.Push))
+			}
 
-		g.Go(func() error {
-			defer log.Info("exiting watcher")
-			return watcher.Watch(gCtx)
-		})
+			g.Go(func() error {
+				defer log.WithField("platform", platformName).Info("exiting watcher")
+				return watcher.Watch(gCtx)
+			})
 
-		g.Go(func() error {
-			defer log.Info("exiting responder")
-			return responder.Respond(gCtx)
-		})
+			g.Go(func() error {
+				defer log.WithField("platform", platformName).Info("exiting responder")
+				return responder.Respond(gCtx)
+			})
+		}
+
+		if truemediaService.CallbacksEnabled() {
+			// Whichever replica gets the callback checks on every mention waiting on the media that another replica
+			// hasn't claimed; the others' safety-net polls pick up the rest
+			healthchecker.Handle("/callbacks/truemedia", truemediaService.CallbackHandler(func(mediaID string) {
+				for _, responder := range responders {
+					responder.Wake(mediaID)
+				}
+			}))
+		}
 
 		// For deployed instances, provide a basic healthcheck endpoint to show it's online
 		g.Go(func() error {
@@ -120,3 +181,20 @@ var serverCmd = &cobra.Command{
 		}
 	},
 }
+
+// Creates the client for a platform the bot should watch
+func newSocialPlatform(ctx context.Context, platformName model.Platform, cfg config.Config, secretsManagerClient *secretsmanager.Client) platform.SocialPlatform {
+	switch platformName {
+	case model.PlatformX:
+		return service.NewTwitterService(ctx, cfg, secretsManagerClient)
+	case model.PlatformMastadon:
+		return service.NewMastodonService(ctx, cfg, secretsManagerClient)
+	case model.PlatformReddit:
+		return service.NewRedditService(cfg, secretsManagerClient)
+	case model.PlatformBluesky:
+		return service.NewBlueskyService(cfg, secretsManagerClient)
+	default:
+		log.Fatalf("platform %s is not supported", platformName)
+		return nil
+	}
+}
@@ -4,21 +4,36 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/lucsky/cuid"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
+	"github.com/truemediaorg/socialbot/bluesky"
+	"github.com/truemediaorg/socialbot/model"
 )
 
 type Config struct {
+	Platforms []model.Platform
 	Twitter   TwitterConfig
+	Mastodon  MastodonConfig
+	Reddit    RedditConfig
+	Bluesky   BlueskyConfig
 	Truemedia TruemediaConfig
 
 	PostgresURL        string
 	PostgresSecretPath string
 
+	MessagesDir string
+	WorkerID    string
+	// Where to send traces over OTLP/HTTP, or empty to not trace
+	OTLPEndpoint string
+	// Where the admin API token is, or empty to not serve the admin API
+	AdminSecretPath string
+
 	LogLevel        log.Level
 	LogFormat       LogFormat
 	TestModeEnabled bool
@@ -28,11 +43,29 @@ type TwitterConfig struct {
 	BotUserName      string
 	SecretPath       string
 	TimelinePageSize int
+	StreamEnabled    bool
+	WebhookEnabled   bool
+}
+
+type MastodonConfig struct {
+	InstanceURL url.URL
+	SecretPath  string
+}
+
+type RedditConfig struct {
+	SecretPath string
+}
+
+type BlueskyConfig struct {
+	ServiceURL url.URL
+	SecretPath string
 }
 
 type TruemediaConfig struct {
 	ApiURL          url.URL
-	ResolveInterval time.Duration
+	ResultsURL      url.URL
+	CallbackURL     url.URL
+	Timeout         time.Duration
 	ResultsInterval time.Duration
 	SecretPath      string
 }
@@ -47,6 +80,14 @@ const (
 type EnvfileKey string
 
 const (
+	defaultTruemediaResultsURL = "https://detect.truemedia.org/media/analysis"
+	defaultTruemediaTimeout    = 30 * time.Second
+)
+
+const (
+	// Comma-separated list of platforms to watch and reply on (e.g. "X,MASTADON,REDDIT,BLUESKY")
+	EnvfileKeyPlatforms = "PLATFORMS"
+
 	// Postgres connection string to use for database connections
 	EnvfileKeyPostgresURL = "POSTGRES_URL"
 	// AWS Secrets Manager path where Postgres connection string can be found
@@ -54,12 +95,17 @@ const (
 
 	// Base URL to the Truemedia API, including "/api"
 	EnvfileKeyTruemediaAPI = "TRUEMEDIA_API"
-	// Interval to wait after calling the resolve media endpoint, in seconds
-	EnvfileKeyTruemediaResolveInterval = "TRUEMEDIA_RESOLVE_INTERVAL"
+	// How long to wait for a response from the Truemedia API before giving up on a request, in seconds
+	EnvfileKeyTruemediaTimeout = "TRUEMEDIA_TIMEOUT"
 	// Interval to wait after calling the get results endpoint, in seconds
 	EnvfileKeyTruemediaResultsInterval = "TRUEMEDIA_RESULTS_INTERVAL"
 	// AWS Secrets Manager path where Truemedia API secrets can be found
 	EnvfileKeyTruemediaSecretPath = "TRUEMEDIA_SECRETS_PATH"
+	// URL of the Truemedia analysis page linked in replies. Defaults to the public TrueMedia.org site
+	EnvfileKeyTruemediaResultsURL = "TRUEMEDIA_RESULTS_URL"
+	// Public URL of this bot's /callbacks/truemedia endpoint, for TrueMedia to call when analyses finish.
+	// Without it, the bot polls for results
+	EnvfileKeyTruemediaCallbackURL = "TRUEMEDIA_CALLBACK_URL"
 
 	// AWS Secrets Manager path where Twitter secrets can be found
 	EnvfileKeyTwitterSecretPath = "TWITTER_SECRETS_PATH"
@@ -68,7 +114,37 @@ const (
 	EnvfileKeyTwitterUserName = "TWITTER_USERNAME"
 	// Number of tweets to request per call to the timeline mentions endpoint
 	EnvfileKeyTwitterTimelinePageSize = "TWITTER_TIMELINE_PAGE_SIZE"
+	// Enables real-time mention intake from the filtered stream, with polling kept as a fallback
+	EnvfileKeyTwitterStream = "TWITTER_STREAM"
+	// Serves the Account Activity API webhook on the healthcheck port, so X can push mentions as they're posted
+	EnvfileKeyTwitterWebhook = "TWITTER_WEBHOOK"
+
+	// Base URL of the Mastodon instance the bot's account lives on
+	EnvfileKeyMastodonInstance = "MASTODON_INSTANCE"
+	// AWS Secrets Manager path where Mastodon secrets can be found
+	EnvfileKeyMastodonSecretPath = "MASTODON_SECRETS_PATH"
 
+	// AWS Secrets Manager path where Reddit secrets can be found
+	// NOTE: the bot posts under the account configured in reddit secrets
+	EnvfileKeyRedditSecretPath = "REDDIT_SECRETS_PATH"
+
+	// Base URL of the Bluesky PDS hosting the bot's account. Defaults to bsky.social
+	EnvfileKeyBlueskyService = "BLUESKY_SERVICE"
+	// AWS Secrets Manager path where Bluesky secrets can be found
+	EnvfileKeyBlueskySecretPath = "BLUESKY_SECRETS_PATH"
+
+	// Directory holding reply templates, one file per locale (e.g. "en.tmpl"). Defaults to the built-in templates
+	EnvfileKeyMessagesDir = "MESSAGES_DIR"
+
+	// Identifies this replica when claiming work, so several can run against the same database.
+	// Defaults to the hostname plus a random suffix
+	EnvfileKeyWorkerID = "WORKER_ID"
+
+	// OTLP/HTTP endpoint to export traces to (e.g. "http://localhost:4318" for a local collector).
+	// Tracing is off without it
+	EnvfileKeyOTLPEndpoint = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	// AWS Secrets Manager path where the admin API token can be found. The admin API is off without it
+	EnvfileKeyAdminSecretPath = "ADMIN_SECRETS_PATH"
 	// Log level (e.g. "debug", "info", "warn", "error")
 	EnvfileKeyLogLevel = "LOG_LEVEL"
 	// Log output format (e.g. "text", "json")
@@ -92,9 +168,33 @@ func FromEnvfile() Config {
 		log.Fatalf("error parsing Truemedia URL: %v", err)
 	}
 
+	truemediaResultsRaw := getConfigString(EnvfileKeyTruemediaResultsURL)
+	if truemediaResultsRaw == "" {
+		truemediaResultsRaw = defaultTruemediaResultsURL
+	}
+	truemediaResultsURL, err := url.Parse(truemediaResultsRaw)
+	if err != nil {
+		log.Fatalf("error parsing Truemedia results URL: %v", err)
+	}
+
+	truemediaCallbackURL, err := url.Parse(getConfigString(EnvfileKeyTruemediaCallbackURL))
+	if err != nil {
+		log.Fatalf("error parsing Truemedia callback URL: %v", err)
+	}
+
+	truemediaTimeout := time.Duration(getConfigInt(EnvfileKeyTruemediaTimeout)) * time.Second
+	if truemediaTimeout == 0 {
+		truemediaTimeout = defaultTruemediaTimeout
+	}
+
+	platforms, err := parsePlatforms(getConfigString(EnvfileKeyPlatforms))
+	if err != nil {
+		log.Fatalf("error parsing platforms: %v", err)
+	}
+
 	// TODO: Does this config make more sense as the actual user ID?
 	twitterUsername := getConfigString(EnvfileKeyTwitterUserName)
-	if twitterUsername == "" {
+	if twitterUsername == "" && slices.Contains(platforms, model.PlatformX) {
 		log.Fatalf("must supply username for bot")
 	}
 
@@ -104,6 +204,23 @@ func FromEnvfile() Config {
 		twitterTimelineSize = 5
 	}
 
+	mastodonURL, err := url.Parse(getConfigString(EnvfileKeyMastodonInstance))
+	if err != nil {
+		log.Fatalf("error parsing Mastodon URL: %v", err)
+	}
+	if mastodonURL.Host == "" && slices.Contains(platforms, model.PlatformMastadon) {
+		log.Fatalf("must supply Mastodon instance for bot")
+	}
+
+	blueskyService := getConfigString(EnvfileKeyBlueskyService)
+	if blueskyService == "" {
+		blueskyService = bluesky.DefaultServiceURL
+	}
+	blueskyURL, err := url.Parse(blueskyService)
+	if err != nil {
+		log.Fatalf("error parsing Bluesky URL: %v", err)
+	}
+
 	logLevel, err := log.ParseLevel(getConfigString(EnvfileKeyLogLevel))
 	if err != nil {
 		// Default to info level but log a warning
@@ -124,12 +241,24 @@ func FromEnvfile() Config {
 		log.Fatal("postgres not configured")
 	}
 
+	workerID := getConfigString(EnvfileKeyWorkerID)
+	if workerID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "socialbot"
+		}
+		workerID = fmt.Sprintf("%s-%s", hostname, cuid.Slug())
+	}
+
 	isTestMode := viper.GetBool(EnvfileKeyTestMode)
 
 	return Config{
+		Platforms: platforms,
 		Truemedia: TruemediaConfig{
 			ApiURL:          *truemediaURL,
-			ResolveInterval: time.Duration(getConfigInt(EnvfileKeyTruemediaResolveInterval)) * time.Second,
+			ResultsURL:      *truemediaResultsURL,
+			CallbackURL:     *truemediaCallbackURL,
+			Timeout:         truemediaTimeout,
 			ResultsInterval: time.Duration(getConfigInt(EnvfileKeyTruemediaResultsInterval)) * time.Second,
 			SecretPath:      getConfigString(EnvfileKeyTruemediaSecretPath),
 		},
@@ -137,9 +266,26 @@ func FromEnvfile() Config {
 			BotUserName:      twitterUsername,
 			SecretPath:       getConfigString(EnvfileKeyTwitterSecretPath),
 			TimelinePageSize: twitterTimelineSize,
+			StreamEnabled:    viper.GetBool(EnvfileKeyTwitterStream),
+			WebhookEnabled:   viper.GetBool(EnvfileKeyTwitterWebhook),
+		},
+		Mastodon: MastodonConfig{
+			InstanceURL: *mastodonURL,
+			SecretPath:  getConfigString(EnvfileKeyMastodonSecretPath),
+		},
+		Reddit: RedditConfig{
+			SecretPath: getConfigString(EnvfileKeyRedditSecretPath),
+		},
+		Bluesky: BlueskyConfig{
+			ServiceURL: *blueskyURL,
+			SecretPath: getConfigString(EnvfileKeyBlueskySecretPath),
 		},
 		PostgresURL:        postgresURL,
 		PostgresSecretPath: postgresSecretsPath,
+		MessagesDir:        getConfigString(EnvfileKeyMessagesDir),
+		WorkerID:           workerID,
+		OTLPEndpoint:       getConfigString(EnvfileKeyOTLPEndpoint),
+		AdminSecretPath:    getConfigString(EnvfileKeyAdminSecretPath),
 		LogLevel:           logLevel,
 		LogFormat:          logFormat,
 		TestModeEnabled:    isTestMode,
@@ -157,6 +303,22 @@ func parseLogFormat(raw string) (LogFormat, error) {
 	}
 }
 
+// Parses a comma-separated list of platforms, defaulting to X alone if none are given
+func parsePlatforms(raw string) ([]model.Platform, error) {
+	if strings.TrimSpace(raw) == "" {
+		return []model.Platform{model.PlatformX}, nil
+	}
+	var platforms []model.Platform
+	for _, name := range strings.Split(raw, ",") {
+		platform, err := model.ParsePlatform(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		platforms = append(platforms, platform)
+	}
+	return platforms, nil
+}
+
 // Gets a config value as a string from env vars or a .env file
 func getConfigString(key string) string {
 	value := os.Getenv(key)
@@ -8,8 +8,33 @@ type TwitterSecretData struct {
 	ConsumerSecret    string `json:"consumerSecret"`
 }
 
+// Credentials for a Reddit "script" app and the account it posts as
+type RedditSecretData struct {
+	ClientID     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"`
+	UserName     string `json:"userName"`
+	Password     string `json:"password"`
+}
+
+type MastodonSecretData struct {
+	AccessToken string `json:"accessToken"`
+}
+
+type BlueskySecretData struct {
+	// Handle or DID of the bot's account
+	Identifier  string `json:"identifier"`
+	AppPassword string `json:"appPassword"`
+}
+
 type TrueMediaSecretData struct {
 	ApiKey string `json:"apiKey"`
+	// Bearer token TrueMedia sends with analysis callbacks
+	CallbackSecret string `json:"callbackSecret"`
+}
+
+type AdminSecretData struct {
+	// Bearer token operators send to the admin API
+	Token string `json:"token"`
 }
 
 type PostgresSecretData struct {
@@ -0,0 +1,128 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/truemediaorg/socialbot/database/db"
+	"github.com/truemediaorg/socialbot/model"
+)
+
+/*
+Every platform's IDs sort by length and then character by character: X and Mastodon use decimal snowflakes,
+Reddit uses base 36 and Bluesky uses fixed-length TIDs. Plain string ordering would put "999" after "1000".
+The "C" collation keeps Postgres from applying language rules to the comparison.
+*/
+const cursorOrder = `(length(%[1]s), %[1]s COLLATE "C")`
+
+// Anything that can run a statement, so cursor updates can share a transaction
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// Gets the polling cursor for a bot account on a platform, or "" if there isn't one yet
+func (d *Database) GetCursor(ctx context.Context, platform model.Platform, account string) (string, error) {
+	var cursor string
+	err := d.pool.QueryRow(ctx, `
+	SELECT cursor
+	FROM platform_cursor
+	WHERE platform = $1
+	  AND account = $2`,
+		platform,
+		account,
+	).Scan(&cursor)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return "", nil
+		}
+		return "", err
+	}
+	return cursor, nil
+}
+
+// Moves the polling cursor forward to a mention the watcher has handled. Cursors never move backwards.
+func (d *Database) AdvanceCursor(ctx context.Context, platform model.Platform, account string, cursor string) error {
+	return advanceCursor(ctx, d.pool, platform, account, cursor)
+}
+
+func advanceCursor(ctx context.Context, conn execer, platform model.Platform, account string, cursor string) error {
+	_, err := conn.Exec(ctx, `
+	INSERT INTO platform_cursor (platform, account, cursor, updated) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (platform, account) DO UPDATE
+	SET
+		cursor = EXCLUDED.cursor,
+		updated = EXCLUDED.updated
+	WHERE `+fmt.Sprintf(cursorOrder, "platform_cursor.cursor")+` < `+fmt.Sprintf(cursorOrder, "EXCLUDED.cursor"),
+		platform,
+		account,
+		cursor,
+		time.Now().UTC(), // the DB stores timezones and assumes UTC
+	)
+	return err
+}
+
+// Sets the polling cursor for a bot account on a platform, even if that moves it backwards
+func (d *Database) SetCursor(ctx context.Context, platform model.Platform, account string, cursor string) error {
+	_, err := d.pool.Exec(ctx, `
+	INSERT INTO platform_cursor (platform, account, cursor, updated) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (platform, account) DO UPDATE
+	SET
+		cursor = EXCLUDED.cursor,
+		updated = EXCLUDED.updated`,
+		platform,
+		account,
+		cursor,
+		time.Now().UTC(), // the DB stores timezones and assumes UTC
+	)
+	return err
+}
+
+// Deletes the polling cursors for a platform, for one account or for all of them if account is empty.
+// Returns how many were deleted.
+func (d *Database) DeleteCursors(ctx context.Context, platform model.Platform, account string) (int64, error) {
+	tag, err := d.pool.Exec(ctx, `
+	DELETE FROM platform_cursor
+	WHERE platform = $1
+	  AND ($2 = '' OR account = $2)`,
+		platform,
+		account,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (d *Database) ListCursors(ctx context.Context) ([]model.Cursor, error) {
+	var cursors []model.Cursor
+	rows, err := d.pool.Query(ctx, `
+	SELECT
+		platform,
+		account,
+		cursor,
+		updated
+	FROM platform_cursor
+	ORDER BY platform, account`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	raws, err := pgx.CollectRows(rows, pgx.RowToStructByName[db.PlatformCursor])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, raw := range raws {
+		cursor, err := model.CursorFromPlatformCursor(raw)
+		if err != nil {
+			return nil, err
+		}
+		cursors = append(cursors, *cursor)
+	}
+
+	return cursors, nil
+}
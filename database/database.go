@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -31,25 +32,105 @@ func (d *Database) Connect(ctx context.Context) error {
 	return nil
 }
 
+// Checks the database can be reached, for readiness checks
+func (d *Database) Ping(ctx context.Context) error {
+	return d.pool.Ping(ctx)
+}
+
 func (d *Database) Disconnect() {
 	d.pool.Close()
 }
 
-func (d *Database) AddMention(ctx context.Context, platformID string, platformUserName string, platform model.Platform, mediaID string) error {
-	// don't really care about the result, as long as this succeeds
-	_, err := d.pool.Exec(ctx, `
-	INSERT INTO mention_queue (id, platform, platform_id, platform_user_name, enqueued, media_id) VALUES ($1, $2, $3, $4, $5, $6)`,
-		cuid.New(),
+/*
+Adds a mention to the queue and advances the polling cursor for the bot's account past it, in one transaction
+so a mention is never queued without the cursor moving or skipped without being queued.
+mediaIDs holds every media item resolved from the post. If resolving failed, mediaIDs is empty and
+failureReason says why, so the responder can tell the user.
+The cursor for the account moves to cursor, which is usually platformID. An empty account queues the
+mention without touching the cursor. traceParent is the trace context of the
+mention's root span, so later work on it joins the same trace. Returns the ID of the queued mention, or ""
+if it was already queued, e.g. by another replica that got it from the webhook; the cursor still moves.
+*/
+func (d *Database) AddMention(ctx context.Context, account string, cursor string, platformID string, platformUserName string, platform model.Platform, mediaPostURL string, mediaIDs []string, failureReason string, language string, command model.Command, traceParent string) (string, error) {
+	mentionID := cuid.New()
+	var mediaID *string
+	if len(mediaIDs) > 0 {
+		mediaID = &mediaIDs[0]
+	} else {
+		mediaIDs = []string{}
+	}
+
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	// Does nothing once the transaction is committed
+	defer tx.Rollback(ctx)
+
+	// The unique (platform, platform_id) constraint keeps replicas from queueing the same mention twice
+	tag, err := tx.Exec(ctx, `
+	INSERT INTO mention_queue (id, platform, platform_id, platform_user_name, enqueued, media_post_url, media_id, media_ids, failure_reason, lang, command, trace_parent) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), NULLIF($10, ''), $11, NULLIF($12, ''))
+	ON CONFLICT (platform, platform_id) DO NOTHING`,
+		mentionID,
 		platform,
 		platformID,
 		platformUserName,
 		time.Now().UTC(), // the DB stores timezones and assumes UTC
+		mediaPostURL,
 		mediaID,
+		mediaIDs,
+		failureReason,
+		language,
+		command,
+		traceParent,
 	)
 	if err != nil {
-		return err
+		return "", err
 	}
-	return nil
+	if account != "" {
+		if err := advanceCursor(ctx, tx, platform, account, cursor); err != nil {
+			return "", err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return "", err
+	}
+	if tag.RowsAffected() == 0 {
+		return "", nil
+	}
+	return mentionID, nil
+}
+
+// Checks whether a mention has already been queued, whether or not it's been replied to yet
+func (d *Database) IsMentionQueued(ctx context.Context, platform model.Platform, platformID string) (bool, error) {
+	var queued bool
+	err := d.pool.QueryRow(ctx, `
+	SELECT EXISTS (SELECT 1 FROM mention_queue WHERE platform = $1 AND platform_id = $2)`,
+		platform,
+		platformID,
+	).Scan(&queued)
+	return queued, err
+}
+
+/*
+Gets the media IDs resolved for a post when it was mentioned before, so it isn't resolved again.
+Returns nil if no queued mention on the platform replies to that post.
+*/
+func (d *Database) FindResolvedMedia(ctx context.Context, platform model.Platform, mediaPostURL string) ([]string, error) {
+	var mediaIDs []string
+	err := d.pool.QueryRow(ctx, `
+	SELECT COALESCE(media_ids, ARRAY[media_id])
+	FROM mention_queue
+	WHERE platform = $1 AND media_post_url = $2 AND media_id IS NOT NULL
+	ORDER BY enqueued DESC
+	LIMIT 1`,
+		platform,
+		mediaPostURL,
+	).Scan(&mediaIDs)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return mediaIDs, err
 }
 
 func (d *Database) DeleteMention(ctx context.Context, mentionID string) error {
@@ -64,19 +145,22 @@ func (d *Database) DeleteMention(ctx context.Context, mentionID string) error {
 	return nil
 }
 
-func (d *Database) GetLatestTweetID(ctx context.Context) (string, error) {
-	// For Twitter, IDs are always increasing
+/*
+Gets the platform ID of the newest mention queued for a platform.
+The watcher starts from here when an account has no polling cursor yet, so mentions queued before
+cursors were kept aren't fetched again.
+*/
+func (d *Database) GetLatestMentionID(ctx context.Context, platform model.Platform) (string, error) {
 	var id string
-	// TODO: using model.PlatformX here is blurring the lines between model and db
 	err := d.pool.QueryRow(
 		ctx,
 		`SELECT 
 			platform_id 
 		FROM mention_queue 
 		WHERE platform = $1
-		ORDER BY platform_id DESC
+		ORDER BY `+fmt.Sprintf(cursorOrder, "platform_id")+` DESC
 		LIMIT 1`,
-		model.PlatformX,
+		platform,
 	).Scan(&id)
 	if err != nil {
 		// A blank table is OK and obviously can't return rows
@@ -88,65 +172,148 @@ func (d *Database) GetLatestTweetID(ctx context.Context) (string, error) {
 	return id, nil
 }
 
-func (d *Database) GetMentionsNeedingRepliesForPlatform(ctx context.Context, platform model.Platform) ([]model.Mention, error) {
-	var mentions []model.Mention
-	var raws []db.MentionQueue
+/*
+Claims mentions on a platform that still need a FINAL reply, so no other replica works on them at the same time.
+A claim is a lease held by workerID until leaseDuration from now. Mentions already leased by workerID are
+included, and their leases renewed, so a worker keeps what it has as long as it keeps claiming. Mentions leased
+by another worker are skipped until that lease expires, which is how work moves on from a replica that died.
+Mentions are claimed in the order they became due, so a backlog of newer mentions can't starve older ones.
+Mentions held off until next_attempt_at, whether after a failure or until their analysis is next checked,
+are left out until then, so slow analyses can't take up the whole claim either.
+*/
+func (d *Database) ClaimMentionsNeedingReplies(ctx context.Context, platform model.Platform, workerID string, leaseDuration time.Duration, limit int) ([]model.Mention, error) {
+	now := time.Now().UTC() // the DB stores timezones and assumes UTC
 	rows, err := d.pool.Query(ctx, `
-	SELECT 
-		id, 
-		platform, 
-		platform_id,
-		platform_user_name,
-		media_id, 
-		enqueued 
-	FROM mention_queue
-	WHERE 
-		id NOT IN ( 
-			SELECT mention_id 
-			FROM mention_reply 
-			WHERE platform = $1
-			  AND type = 'FINAL' 
-		) 
-		AND platform = $2
-	ORDER BY enqueued DESC`,
-		platform,
+	WITH claimed AS (
+		UPDATE mention_queue
+		SET
+			leased_by = $1,
+			lease_expires = $2
+		WHERE id IN (
+			SELECT id
+			FROM mention_queue
+			WHERE 
+				id NOT IN ( 
+					SELECT mention_id 
+					FROM mention_reply 
+					WHERE platform = $3
+					  AND type = 'FINAL' 
+					  AND NOT superseded
+				) 
+				AND platform = $3
+				AND state IN ('QUEUED', 'ANALYZING', 'FAILED')
+				AND (next_attempt_at IS NULL OR next_attempt_at <= $4)
+				AND (leased_by IS NULL OR leased_by = $1 OR lease_expires < $4)
+			ORDER BY COALESCE(next_attempt_at, enqueued) ASC
+			LIMIT $5
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *
+	)
+	SELECT `+mentionColumns+`
+	FROM claimed
+	ORDER BY COALESCE(next_attempt_at, enqueued) ASC`,
+		workerID,
+		now.Add(leaseDuration),
 		platform,
+		now,
+		limit,
 	)
 	if err != nil {
 		return nil, err
 	}
+	return collectMentions(rows)
+}
 
-	raws, err = pgx.CollectRows(rows, pgx.RowToStructByName[db.MentionQueue])
+/*
+Claims the mentions on a platform that are waiting on a media item's analysis, once TrueMedia says it's finished.
+Leases work as in ClaimMentionsNeedingReplies. Mentions held off until their next poll are included, since the
+analysis they're waiting on is done; failed mentions wait out their backoff as usual.
+*/
+func (d *Database) ClaimMentionsForMedia(ctx context.Context, platform model.Platform, workerID string, leaseDuration time.Duration, mediaID string) ([]model.Mention, error) {
+	now := time.Now().UTC() // the DB stores timezones and assumes UTC
+	rows, err := d.pool.Query(ctx, `
+	WITH claimed AS (
+		UPDATE mention_queue
+		SET
+			leased_by = $1,
+			lease_expires = $2
+		WHERE id IN (
+			SELECT id
+			FROM mention_queue
+			WHERE 
+				id NOT IN ( 
+					SELECT mention_id 
+					FROM mention_reply 
+					WHERE platform = $3
+					  AND type = 'FINAL' 
+					  AND NOT superseded
+				) 
+				AND platform = $3
+				AND $5 = ANY(COALESCE(media_ids, ARRAY[media_id]))
+				AND state IN ('QUEUED', 'ANALYZING')
+				AND (leased_by IS NULL OR leased_by = $1 OR lease_expires < $4)
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *
+	)
+	SELECT `+mentionColumns+`
+	FROM claimed
+	ORDER BY enqueued ASC`,
+		workerID,
+		now.Add(leaseDuration),
+		platform,
+		now,
+		mediaID,
+	)
 	if err != nil {
 		return nil, err
 	}
+	return collectMentions(rows)
+}
 
-	for _, raw := range raws {
-		mention, err := model.MentionFromMentionQueue(raw)
-		if err != nil {
-			return nil, err
-		}
-		mentions = append(mentions, *mention)
-	}
+// Records a reply to a mention. A FINAL reply also marks the mention REPLIED, in the same transaction.
+func (d *Database) AddReply(ctx context.Context, mentionID string, platform model.Platform, platformID string, replyType db.ReplyType) error {
+	return d.addReply(ctx, mentionID, platform, platformID, replyType, false)
+}
 
-	return mentions, nil
+/*
+Records that a mention has a reply the platform wouldn't post again because it already has one just like it,
+such as when the same user mentions the bot twice on the same post. The platform doesn't say which post it
+already has, so the reply is recorded with a made-up platform ID and flagged as a placeholder.
+*/
+func (d *Database) AddPlaceholderReply(ctx context.Context, mentionID string, platform model.Platform, replyType db.ReplyType) error {
+	return d.addReply(ctx, mentionID, platform, cuid.New(), replyType, true)
 }
 
-func (d *Database) AddReply(ctx context.Context, mentionID string, platform model.Platform, platformID string, replyType db.ReplyType) error {
-	_, err := d.pool.Exec(
+func (d *Database) addReply(ctx context.Context, mentionID string, platform model.Platform, platformID string, replyType db.ReplyType, placeholder bool) error {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	// Does nothing once the transaction is committed
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(
 		ctx,
-		`INSERT INTO mention_reply (id, mention_id, platform, platform_id, replied, type) VALUES ($1, $2, $3, $4, $5, $6)`,
+		`INSERT INTO mention_reply (id, mention_id, platform, platform_id, replied, type, placeholder) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
 		cuid.New(),
 		mentionID,
 		platform,
 		platformID,
 		time.Now().UTC(), // the DB stores timezones and assumes UTC
 		replyType,
+		placeholder,
 	)
 	if err != nil {
 		return err
 	}
-	return nil
+	if replyType == db.ReplyTypeFinal {
+		if err := setMentionState(ctx, tx, mentionID, db.MentionStateReplied); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
 }
 
 func (d *Database) FindRepliesForMention(ctx context.Context, mentionID string) ([]model.Reply, error) {
@@ -159,7 +326,9 @@ func (d *Database) FindRepliesForMention(ctx context.Context, mentionID string)
 		platform, 
 		platform_id, 
 		replied, 
-		type
+		type,
+		placeholder,
+		superseded
 	FROM mention_reply
 	WHERE mention_id = $1`,
 		mentionID,
@@ -184,6 +353,58 @@ func (d *Database) FindRepliesForMention(ctx context.Context, mentionID string)
 	return replies, nil
 }
 
+// Gives up the leases workerID holds on a platform's mentions so other replicas can pick them up right away
+func (d *Database) ReleaseMentions(ctx context.Context, platform model.Platform, workerID string) error {
+	_, err := d.pool.Exec(ctx, `
+	UPDATE mention_queue
+	SET
+		leased_by = NULL,
+		lease_expires = NULL
+	WHERE platform = $1
+	  AND leased_by = $2`,
+		platform,
+		workerID,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Records that a user doesn't want the bot replying under their posts
+func (d *Database) AddOptOut(ctx context.Context, platform model.Platform, platformUserName string) error {
+	_, err := d.pool.Exec(ctx, `
+	INSERT INTO opt_out (id, platform, platform_user_name, opted_out) VALUES ($1, $2, lower($3), $4)
+	ON CONFLICT (platform, platform_user_name) DO NOTHING`,
+		cuid.New(),
+		platform,
+		platformUserName,
+		time.Now().UTC(), // the DB stores timezones and assumes UTC
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (d *Database) IsOptedOut(ctx context.Context, platform model.Platform, platformUserName string) (bool, error) {
+	var optedOut bool
+	err := d.pool.QueryRow(ctx, `
+	SELECT EXISTS (
+		SELECT 1
+		FROM opt_out
+		WHERE platform = $1
+		  AND platform_user_name = lower($2)
+	)`,
+		platform,
+		platformUserName,
+	).Scan(&optedOut)
+	if err != nil {
+		return false, err
+	}
+	return optedOut, nil
+}
+
 func (d *Database) GetMediaPostUrl(ctx context.Context, mediaID string) (string, error) {
 	var postUrl string
 	err := d.pool.QueryRow(ctx, `
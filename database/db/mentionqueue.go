@@ -2,11 +2,37 @@ package db
 
 import "time"
 
+// Where a mention is in the bot's handling of it
+type MentionState string
+
+const (
+	// Waiting for its analysis to be checked for the first time
+	MentionStateQueued MentionState = "QUEUED"
+	// The analysis is still running
+	MentionStateAnalyzing MentionState = "ANALYZING"
+	// The FINAL reply has been posted
+	MentionStateReplied MentionState = "REPLIED"
+	// The last attempt failed; it'll be tried again at next_attempt_at
+	MentionStateFailed MentionState = "FAILED"
+	// Failed too many times, or can never succeed. Left for an operator to look at and requeue.
+	MentionStateAbandoned MentionState = "ABANDONED"
+)
+
 type MentionQueue struct {
-	ID               string    `db:"id"`
-	Platform         string    `db:"platform"`
-	PlatformID       string    `db:"platform_id"`
-	PlatformUserName string    `db:"platform_user_name"`
-	MediaID          string    `db:"media_id"`
-	Enqueued         time.Time `db:"enqueued"`
+	ID               string       `db:"id"`
+	Platform         string       `db:"platform"`
+	PlatformID       string       `db:"platform_id"`
+	PlatformUserName string       `db:"platform_user_name"`
+	MediaID          string       `db:"media_id"`
+	MediaIDs         []string     `db:"media_ids"`
+	MediaPostURL     string       `db:"media_post_url"`
+	FailureReason    string       `db:"failure_reason"`
+	Language         string       `db:"lang"`
+	Command          string       `db:"command"`
+	Enqueued         time.Time    `db:"enqueued"`
+	State            MentionState `db:"state"`
+	Attempts         int          `db:"attempts"`
+	LastError        string       `db:"last_error"`
+	NextAttemptAt    *time.Time   `db:"next_attempt_at"`
+	TraceParent      string       `db:"trace_parent"`
 }
@@ -7,6 +7,12 @@ type ReplyType string
 const (
 	ReplyTypeFinal      ReplyType = "FINAL"
 	ReplyTypeProcessing ReplyType = "PROCESSING"
+	// Analysis took too long and the user was given a link to check later.
+	// The mention stays in the queue until a FINAL reply with the verdict follows.
+	ReplyTypeTimedOut ReplyType = "TIMED_OUT"
+	// The media couldn't be analyzed and the user was told why.
+	// Posted at most once per mention, when the bot gives up on it.
+	ReplyTypeError ReplyType = "ERROR"
 )
 
 type MentionReply struct {
@@ -16,4 +22,8 @@ type MentionReply struct {
 	PlatformID string    `db:"platform_id"`
 	Type       ReplyType `db:"type"`
 	Replied    time.Time `db:"replied"`
+	// The platform ID is made up, because the platform rejected the reply as a duplicate of one it already has
+	Placeholder bool `db:"placeholder"`
+	// An operator asked for a fresh reply, so this one no longer counts
+	Superseded bool `db:"superseded"`
 }
@@ -0,0 +1,10 @@
+package db
+
+import "time"
+
+type PlatformCursor struct {
+	Platform string    `db:"platform"`
+	Account  string    `db:"account"`
+	Cursor   string    `db:"cursor"`
+	Updated  time.Time `db:"updated"`
+}
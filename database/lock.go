@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+/*
+A Postgres session-level advisory lock, used to elect one replica to do work that mustn't be done twice.
+Postgres holds the lock for as long as the connection that took it stays open, so the connection is kept
+out of the pool until the lock is released. If the connection drops, Postgres releases the lock and
+another replica can take it.
+*/
+type Lock struct {
+	name string
+	conn *pgxpool.Conn
+}
+
+// Takes the named lock if no one else holds it. Returns nil without an error if another session has it.
+func (d *Database) TryLock(ctx context.Context, name string) (*Lock, error) {
+	conn, err := d.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var locked bool
+	err = conn.QueryRow(ctx, `SELECT pg_try_advisory_lock(hashtext($1))`, name).Scan(&locked)
+	if err != nil || !locked {
+		conn.Release()
+		return nil, err
+	}
+	return &Lock{name: name, conn: conn}, nil
+}
+
+// Checks the lock is still held, which is as long as its connection is alive
+func (l *Lock) Check(ctx context.Context) error {
+	return l.conn.Ping(ctx)
+}
+
+// Gives up the lock and returns its connection to the pool
+func (l *Lock) Release(ctx context.Context) error {
+	defer l.conn.Release()
+	_, err := l.conn.Exec(ctx, `SELECT pg_advisory_unlock(hashtext($1))`, l.name)
+	return err
+}
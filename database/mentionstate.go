@@ -0,0 +1,206 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/truemediaorg/socialbot/database/db"
+	"github.com/truemediaorg/socialbot/model"
+)
+
+// Columns selected into db.MentionQueue, with NULLs turned into zero values
+const mentionColumns = `
+		id,
+		platform,
+		platform_id,
+		platform_user_name,
+		COALESCE(media_id, '') AS media_id,
+		COALESCE(media_ids, '{}') AS media_ids,
+		COALESCE(media_post_url, '') AS media_post_url,
+		COALESCE(failure_reason, '') AS failure_reason,
+		COALESCE(lang, '') AS lang,
+		COALESCE(command, '') AS command,
+		enqueued,
+		state,
+		attempts,
+		COALESCE(last_error, '') AS last_error,
+		next_attempt_at,
+		COALESCE(trace_parent, '') AS trace_parent`
+
+func collectMentions(rows pgx.Rows) ([]model.Mention, error) {
+	raws, err := pgx.CollectRows(rows, pgx.RowToStructByName[db.MentionQueue])
+	if err != nil {
+		return nil, err
+	}
+	var mentions []model.Mention
+	for _, raw := range raws {
+		mention, err := model.MentionFromMentionQueue(raw)
+		if err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, *mention)
+	}
+	return mentions, nil
+}
+
+func setMentionState(ctx context.Context, conn execer, mentionID string, state db.MentionState) error {
+	_, err := conn.Exec(ctx, `
+	UPDATE mention_queue
+	SET
+		state = $2,
+		next_attempt_at = NULL
+	WHERE id = $1`,
+		mentionID,
+		state,
+	)
+	return err
+}
+
+// Marks a mention as waiting on its analysis, once it's been checked and found still running
+func (d *Database) MarkMentionAnalyzing(ctx context.Context, mentionID string) error {
+	_, err := d.pool.Exec(ctx, `
+	UPDATE mention_queue
+	SET state = 'ANALYZING'
+	WHERE id = $1
+	  AND state IN ('QUEUED', 'FAILED')`,
+		mentionID,
+	)
+	return err
+}
+
+/*
+Counts a failed attempt at handling a mention and records why.
+The mention is tried again once nextAttempt comes, unless abandon is set, in which case it's dead-lettered
+until an operator requeues it.
+*/
+func (d *Database) RecordMentionFailure(ctx context.Context, mentionID string, lastError string, abandon bool, nextAttempt time.Time) error {
+	state := db.MentionStateFailed
+	if abandon {
+		state = db.MentionStateAbandoned
+	}
+	_, err := d.pool.Exec(ctx, `
+	UPDATE mention_queue
+	SET
+		state = $2,
+		attempts = attempts + 1,
+		last_error = $3,
+		next_attempt_at = $4
+	WHERE id = $1`,
+		mentionID,
+		state,
+		lastError,
+		nextAttempt.UTC(), // the DB stores timezones and assumes UTC
+	)
+	return err
+}
+
+// Holds off on a mention until the given time without counting it as a failure, e.g. while rate limited
+func (d *Database) PostponeMention(ctx context.Context, mentionID string, until time.Time) error {
+	_, err := d.pool.Exec(ctx, `
+	UPDATE mention_queue
+	SET next_attempt_at = $2
+	WHERE id = $1`,
+		mentionID,
+		until.UTC(), // the DB stores timezones and assumes UTC
+	)
+	return err
+}
+
+// Lists mentions in any of the given states, oldest first
+func (d *Database) ListMentionsByState(ctx context.Context, states ...db.MentionState) ([]model.Mention, error) {
+	stateNames := make([]string, 0, len(states))
+	for _, state := range states {
+		stateNames = append(stateNames, string(state))
+	}
+	rows, err := d.pool.Query(ctx, `
+	SELECT `+mentionColumns+`
+	FROM mention_queue
+	WHERE state = ANY($1)
+	ORDER BY enqueued`,
+		stateNames,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return collectMentions(rows)
+}
+
+/*
+Puts a failed or abandoned mention back in the queue with a clean slate, so the responder tries it again
+right away. Returns false if there's no such mention, or it doesn't need requeueing.
+*/
+func (d *Database) RequeueMention(ctx context.Context, mentionID string) (bool, error) {
+	tag, err := d.pool.Exec(ctx, `
+	UPDATE mention_queue
+	SET
+		state = 'QUEUED',
+		attempts = 0,
+		last_error = NULL,
+		next_attempt_at = NULL
+	WHERE id = $1
+	  AND state IN ('FAILED', 'ABANDONED')`,
+		mentionID,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// Gets a mention by ID, or nil if there's no such mention
+func (d *Database) GetMention(ctx context.Context, mentionID string) (*model.Mention, error) {
+	rows, err := d.pool.Query(ctx, `
+	SELECT `+mentionColumns+`
+	FROM mention_queue
+	WHERE id = $1`,
+		mentionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	mentions, err := collectMentions(rows)
+	if err != nil || len(mentions) == 0 {
+		return nil, err
+	}
+	return &mentions[0], nil
+}
+
+/*
+Marks a mention's FINAL and ERROR replies superseded and puts it back in the queue, so the responder replies
+again once the analysis is done. The earlier replies stay up on the platform and in the database, so there's
+still a record of them. Returns false if there's no such mention.
+*/
+func (d *Database) ReopenMention(ctx context.Context, mentionID string) (bool, error) {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	// Does nothing once the transaction is committed
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+	UPDATE mention_queue
+	SET
+		state = 'QUEUED',
+		attempts = 0,
+		last_error = NULL,
+		next_attempt_at = NULL
+	WHERE id = $1`,
+		mentionID,
+	)
+	if err != nil || tag.RowsAffected() == 0 {
+		return false, err
+	}
+	_, err = tx.Exec(ctx, `
+	UPDATE mention_reply
+	SET superseded = true
+	WHERE mention_id = $1
+	  AND type IN ('FINAL', 'ERROR')`,
+		mentionID,
+	)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
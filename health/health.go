@@ -0,0 +1,211 @@
+/*
+Liveness and readiness reporting for the server. The watcher and responder loops beat heartbeats as they
+go round, and readiness also checks the services the bot depends on. Both report each component's status
+and when it last succeeded as JSON, with a 503 if anything is failing, so ECS can act on it.
+*/
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	StatusOK      = "ok"
+	StatusFailing = "failing"
+
+	// How long each dependency check gets before it counts as failing
+	checkTimeout = 3 * time.Second
+)
+
+// What's reported for each component
+type ComponentStatus struct {
+	Status string `json:"status"`
+	// Nil if the component has never succeeded
+	LastSuccess *time.Time `json:"lastSuccess"`
+	Error       string     `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+/*
+Beaten by a loop each time round. The loop counts as stuck once it goes maxAge without a beat.
+A nil Heartbeat ignores beats, so loops don't need one to run.
+*/
+type Heartbeat struct {
+	maxAge time.Duration
+	mu     sync.Mutex
+	last   time.Time
+}
+
+func (h *Heartbeat) Beat() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.last = time.Now()
+}
+
+func (h *Heartbeat) status() ComponentStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.last.IsZero() {
+		return ComponentStatus{Status: StatusFailing, Error: "no heartbeat yet"}
+	}
+	last := h.last
+	if time.Since(last) > h.maxAge {
+		return ComponentStatus{Status: StatusFailing, LastSuccess: &last, Error: "no heartbeat for " + time.Since(last).Round(time.Second).String()}
+	}
+	return ComponentStatus{Status: StatusOK, LastSuccess: &last}
+}
+
+// A dependency the bot needs to do its work, checked on each readiness request
+type dependency struct {
+	check       func(ctx context.Context) error
+	mu          sync.Mutex
+	lastSuccess time.Time
+}
+
+func (d *dependency) status(ctx context.Context) ComponentStatus {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	err := d.check(ctx)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err == nil {
+		d.lastSuccess = time.Now()
+	}
+	status := ComponentStatus{Status: StatusOK}
+	if !d.lastSuccess.IsZero() {
+		lastSuccess := d.lastSuccess
+		status.LastSuccess = &lastSuccess
+	}
+	if err != nil {
+		status.Status = StatusFailing
+		status.Error = err.Error()
+	}
+	return status
+}
+
+type Checker struct {
+	mu           sync.Mutex
+	heartbeats   map[string]*Heartbeat
+	dependencies map[string]*dependency
+}
+
+func NewChecker() *Checker {
+	return &Checker{
+		heartbeats:   map[string]*Heartbeat{},
+		dependencies: map[string]*dependency{},
+	}
+}
+
+// Adds a loop to liveness and readiness, which fail if it goes maxAge without a beat
+func (c *Checker) AddHeartbeat(name string, maxAge time.Duration) *Heartbeat {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	heartbeat := &Heartbeat{maxAge: maxAge}
+	c.heartbeats[name] = heartbeat
+	return heartbeat
+}
+
+// Adds a dependency to readiness, which fails if check returns an error
+func (c *Checker) AddDependency(name string, check func(ctx context.Context) error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dependencies[name] = &dependency{check: check}
+}
+
+// Whether the process is alive: every loop has beaten recently
+func (c *Checker) Liveness() Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	report := Report{Status: StatusOK, Components: map[string]ComponentStatus{}}
+	for name, heartbeat := range c.heartbeats {
+		report.add(name, heartbeat.status())
+	}
+	return report
+}
+
+// Whether the bot can do its work: it's alive, and every dependency can be reached. Dependencies are checked in parallel.
+func (c *Checker) Readiness(ctx context.Context) Report {
+	report := c.Liveness()
+
+	c.mu.Lock()
+	names := make([]string, 0, len(c.dependencies))
+	for name := range c.dependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	statuses := make([]ComponentStatus, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, dep *dependency) {
+			defer wg.Done()
+			statuses[i] = dep.status(ctx)
+		}(i, c.dependencies[name])
+	}
+	c.mu.Unlock()
+	wg.Wait()
+
+	for i, name := range names {
+		report.add(name, statuses[i])
+	}
+	return report
+}
+
+func (r *Report) add(name string, status ComponentStatus) {
+	r.Components[name] = status
+	if status.Status != StatusOK {
+		r.Status = StatusFailing
+	}
+}
+
+func (c *Checker) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, c.Liveness())
+	})
+}
+
+func (c *Checker) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, c.Readiness(r.Context()))
+	})
+}
+
+func writeReport(w http.ResponseWriter, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != StatusOK {
+		log.WithField("components", report.Components).Warn("health check failing")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// Checks a service can be reached over HTTP. Any response counts, since all that matters is getting one.
+func Reachable(client *http.Client, url string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+}
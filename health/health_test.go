@@ -0,0 +1,53 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadiness(t *testing.T) {
+	checker := NewChecker()
+	fresh := checker.AddHeartbeat("fresh", time.Minute)
+	fresh.Beat()
+	stale := checker.AddHeartbeat("stale", time.Minute)
+	stale.last = time.Now().Add(-2 * time.Minute)
+	checker.AddDependency("up", func(ctx context.Context) error { return nil })
+	checker.AddDependency("down", func(ctx context.Context) error { return errors.New("connection refused") })
+
+	report := checker.Readiness(context.Background())
+	assert.Equal(t, StatusFailing, report.Status)
+	assert.Equal(t, StatusOK, report.Components["fresh"].Status)
+	assert.Equal(t, StatusFailing, report.Components["stale"].Status)
+	assert.NotNil(t, report.Components["stale"].LastSuccess)
+	assert.Equal(t, StatusOK, report.Components["up"].Status)
+	assert.Equal(t, "connection refused", report.Components["down"].Error)
+	assert.Nil(t, report.Components["down"].LastSuccess)
+
+	// Liveness only looks at the loops
+	liveness := checker.Liveness()
+	assert.NotContains(t, liveness.Components, "down")
+}
+
+func TestReadinessHandler(t *testing.T) {
+	checker := NewChecker()
+	heartbeat := checker.AddHeartbeat("loop", time.Minute)
+
+	recorder := httptest.NewRecorder()
+	checker.ReadinessHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	heartbeat.Beat()
+	recorder = httptest.NewRecorder()
+	checker.ReadinessHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var report Report
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	assert.Equal(t, StatusOK, report.Components["loop"].Status)
+}
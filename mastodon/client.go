@@ -0,0 +1,191 @@
+package mastodon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Returned when a status can't be found on the instance, e.g. because it was deleted
+var ErrStatusNotFound = errors.New("status not found")
+
+type Client struct {
+	baseURL     string
+	accessToken string
+	HTTPClient  *http.Client
+}
+
+// Error response from the Mastodon API
+type APIError struct {
+	StatusCode int
+	Message    string `json:"error"`
+	// When the rate limit resets, if the instance sent one
+	RateLimitReset time.Time
+}
+
+func (e APIError) Error() string {
+	return fmt.Sprintf("mastodon callout status %d: %s", e.StatusCode, e.Message)
+}
+
+func NewClient(accessToken string, instanceURL url.URL) *Client {
+	return &Client{
+		accessToken: accessToken,
+		baseURL:     instanceURL.String(),
+		HTTPClient:  http.DefaultClient,
+	}
+}
+
+/*
+Gets a page of mention notifications for the authenticated account, newest first.
+If maxID is set, only notifications older than it are returned.
+*/
+func (c Client) GetMentionNotifications(ctx context.Context, maxID string, limit int) ([]Notification, error) {
+	q := url.Values{}
+	q.Add("types[]", string(NotificationTypeMention))
+	q.Add("limit", strconv.Itoa(limit))
+	if maxID != "" {
+		q.Add("max_id", maxID)
+	}
+	var notifications []Notification
+	if err := c.do(ctx, http.MethodGet, "/api/v1/notifications?"+q.Encode(), nil, nil, &notifications); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+func (c Client) GetStatus(ctx context.Context, statusID string) (*Status, error) {
+	var status Status
+	if err := c.do(ctx, http.MethodGet, "/api/v1/statuses/"+url.PathEscape(statusID), nil, nil, &status); err != nil {
+		var apiError *APIError
+		if errors.As(err, &apiError) && apiError.StatusCode == http.StatusNotFound {
+			return nil, ErrStatusNotFound
+		}
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Gets the account the access token belongs to
+func (c Client) VerifyCredentials(ctx context.Context) (*Account, error) {
+	var account Account
+	if err := c.do(ctx, http.MethodGet, "/api/v1/accounts/verify_credentials", nil, nil, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// Looks up a status by its public URL, fetching it from the origin server if this instance hasn't seen it
+func (c Client) LookupStatus(ctx context.Context, statusURL string) (*Status, error) {
+	q := url.Values{}
+	q.Add("q", statusURL)
+	q.Add("type", "statuses")
+	q.Add("resolve", "true")
+	q.Add("limit", "1")
+	var results SearchResults
+	if err := c.do(ctx, http.MethodGet, "/api/v2/search?"+q.Encode(), nil, nil, &results); err != nil {
+		return nil, err
+	}
+	if len(results.Statuses) == 0 {
+		return nil, ErrStatusNotFound
+	}
+	return &results.Statuses[0], nil
+}
+
+/*
+Posts a new status. Mastodon returns the original status instead of posting again when a
+request repeats an idempotency key, so retrying the same reply can't create duplicates.
+*/
+func (c Client) CreateStatus(ctx context.Context, request CreateStatusRequest, idempotencyKey string) (*Status, error) {
+	reqBody, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	headers := http.Header{}
+	headers.Set("Content-Type", "application/json")
+	if idempotencyKey != "" {
+		headers.Set("Idempotency-Key", idempotencyKey)
+	}
+	var status Status
+	if err := c.do(ctx, http.MethodPost, "/api/v1/statuses", bytes.NewReader(reqBody), headers, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Replaces the text of one of the authenticated account's statuses
+func (c Client) EditStatus(ctx context.Context, statusID string, text string) (*Status, error) {
+	reqBody, err := json.Marshal(EditStatusRequest{Status: text})
+	if err != nil {
+		return nil, err
+	}
+	headers := http.Header{}
+	headers.Set("Content-Type", "application/json")
+	var status Status
+	if err := c.do(ctx, http.MethodPut, "/api/v1/statuses/"+url.PathEscape(statusID), bytes.NewReader(reqBody), headers, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+func (c Client) do(ctx context.Context, method string, path string, body io.Reader, headers http.Header, result any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	for key, values := range headers {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.accessToken))
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiError := &APIError{StatusCode: resp.StatusCode}
+		// Not every error has a JSON body (e.g. proxies in front of the instance), so fall back to the status text
+		if err := json.Unmarshal(respBody, apiError); err != nil || apiError.Message == "" {
+			apiError.Message = http.StatusText(resp.StatusCode)
+		}
+		if reset, err := time.Parse(time.RFC3339, resp.Header.Get("X-RateLimit-Reset")); err == nil {
+			apiError.RateLimitReset = reset
+		}
+		return apiError
+	}
+
+	return json.Unmarshal(respBody, result)
+}
+
+// Compares two Mastodon IDs, which are numeric strings of varying length
+func CompareIDs(a string, b string) int {
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
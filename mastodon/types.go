@@ -0,0 +1,78 @@
+package mastodon
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type NotificationType string
+
+var (
+	blockTagPattern = regexp.MustCompile(`(?i)<br\s*/?>|</p>`)
+	tagPattern      = regexp.MustCompile(`<[^>]*>`)
+)
+
+const (
+	NotificationTypeMention NotificationType = "mention"
+)
+
+type Account struct {
+	ID       string `json:"id"`
+	UserName string `json:"username"`
+	// Username for local accounts, username@domain for remote accounts
+	Acct string `json:"acct"`
+	URL  string `json:"url"`
+}
+
+type MediaAttachment struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type Status struct {
+	ID               string            `json:"id"`
+	URI              string            `json:"uri"`
+	URL              string            `json:"url"`
+	CreatedAt        time.Time         `json:"created_at"`
+	Account          Account           `json:"account"`
+	InReplyToID      string            `json:"in_reply_to_id,omitempty"`
+	Content          string            `json:"content"`
+	Language         string            `json:"language,omitempty"`
+	MediaAttachments []MediaAttachment `json:"media_attachments"`
+}
+
+type Notification struct {
+	ID        string           `json:"id"`
+	Type      NotificationType `json:"type"`
+	CreatedAt time.Time        `json:"created_at"`
+	Account   Account          `json:"account"`
+	Status    *Status          `json:"status,omitempty"`
+}
+
+type SearchResults struct {
+	Statuses []Status `json:"statuses"`
+}
+
+type CreateStatusRequest struct {
+	Status      string `json:"status"`
+	InReplyToID string `json:"in_reply_to_id,omitempty"`
+}
+
+type EditStatusRequest struct {
+	Status string `json:"status"`
+}
+
+// Gets the status content as plain text. Mastodon only serves the HTML, where paragraphs and line
+// breaks are tags and mentions are links wrapping the account name.
+func (s Status) Text() string {
+	text := blockTagPattern.ReplaceAllString(s.Content, " ")
+	text = tagPattern.ReplaceAllString(text, "")
+	return strings.TrimSpace(html.UnescapeString(text))
+}
+
+func (s Status) HasMedia() bool {
+	return len(s.MediaAttachments) > 0
+}
@@ -0,0 +1,191 @@
+package messages
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+)
+
+// Replies fall back to this locale when there's no copy in the mention's language
+const DefaultLocale = "en"
+
+// Names of the templates each locale must define
+const (
+	TemplateFinalLow       = "final_low"
+	TemplateFinalUncertain = "final_uncertain"
+	TemplateFinalHigh      = "final_high"
+	TemplateDetails        = "details"
+	TemplateExplain        = "explain"
+	TemplateTimedOut       = "timed_out"
+	TemplateProcessing     = "processing"
+	TemplateError          = "error"
+	// Text drawn on the verdict card attached to final replies, and its alt text
+	TemplateCardHeading       = "card_heading"
+	TemplateCardLabel         = "card_label"
+	TemplateCardScoresHeading = "card_scores_heading"
+	TemplateCardAltText       = "card_alt_text"
+)
+
+var requiredTemplates = []string{
+	TemplateFinalLow,
+	TemplateFinalUncertain,
+	TemplateFinalHigh,
+	TemplateDetails,
+	TemplateExplain,
+	TemplateTimedOut,
+	TemplateProcessing,
+	TemplateError,
+	TemplateCardHeading,
+	TemplateCardLabel,
+	TemplateCardScoresHeading,
+	TemplateCardAltText,
+}
+
+// Verdicts as templates see them in Data.Verdict
+const (
+	VerdictLow       = "low"
+	VerdictUncertain = "uncertain"
+	VerdictHigh      = "high"
+)
+
+// Why media couldn't be analyzed, as templates see it in Data.Failure. Empty means the reason isn't known.
+const (
+	FailureUnsupportedMedia = "unsupported_media"
+	FailurePrivateAccount   = "private_account"
+	FailureTooLong          = "too_long"
+)
+
+//go:embed templates/*.tmpl
+var embeddedTemplates embed.FS
+
+// Everything reply templates can refer to
+type Data struct {
+	// User name of the account that mentioned the bot, without the "@"
+	UserName string
+	// Link to the analysis on the TrueMedia site. Empty in error replies when there's no analysis to link.
+	ResultsURL string
+	// Where users can upload media to the TrueMedia site themselves
+	UploadURL string
+	// One of the Verdict constants, for replies about a completed analysis
+	Verdict string
+	// Detector scores behind the verdict, highest first
+	Scores []Score
+	// Detectors that hadn't finished when the reply was written
+	Pending []string
+	// For posts with several media items, how many share the headline verdict out of how many were
+	// analyzed. Total is zero for posts with one item.
+	Matching int
+	Total    int
+	// One of the Failure constants, for error replies
+	Failure string
+}
+
+// A detector's score as shown in replies
+type Score struct {
+	Model   string
+	Percent int
+	// Position among all the detectors' scores, 1 being the highest
+	Rank int
+	// "image", "video" or "audio", or empty if unknown
+	MediaType string
+}
+
+// Reply templates for every supported locale
+type Catalog struct {
+	locales map[string]*template.Template
+}
+
+/*
+Loads one template file per locale, named like "en.tmpl", from dir.
+If dir is empty, the templates built into the binary are used.
+Every locale is checked for the required templates and test-rendered, so mistakes in the copy
+are caught at startup instead of when the bot tries to reply.
+*/
+func Load(dir string) (*Catalog, error) {
+	var templates fs.FS
+	if dir == "" {
+		sub, err := fs.Sub(embeddedTemplates, "templates")
+		if err != nil {
+			return nil, err
+		}
+		templates = sub
+	} else {
+		templates = os.DirFS(dir)
+	}
+
+	files, err := fs.Glob(templates, "*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	catalog := &Catalog{locales: map[string]*template.Template{}}
+	for _, file := range files {
+		locale := strings.TrimSuffix(path.Base(file), ".tmpl")
+		tmpl, err := template.New(locale).ParseFS(templates, file)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s templates: %w", locale, err)
+		}
+		catalog.locales[locale] = tmpl
+	}
+
+	if err := catalog.validate(); err != nil {
+		return nil, err
+	}
+	return catalog, nil
+}
+
+// Makes sure every locale can render every reply
+func (c *Catalog) validate() error {
+	if _, ok := c.locales[DefaultLocale]; !ok {
+		return fmt.Errorf("no templates for default locale %s", DefaultLocale)
+	}
+	var samples []Data
+	for _, verdict := range []string{VerdictLow, VerdictUncertain, VerdictHigh} {
+		samples = append(samples,
+			Data{UserName: "user", ResultsURL: "https://example.com", Verdict: verdict},
+			Data{UserName: "user", ResultsURL: "https://example.com", Verdict: verdict, Matching: 1, Total: 2, Scores: []Score{{Model: "model", Percent: 50, Rank: 1, MediaType: "video"}}, Pending: []string{"pending"}},
+		)
+	}
+	for _, failure := range []string{"", FailureUnsupportedMedia, FailurePrivateAccount, FailureTooLong} {
+		samples = append(samples, Data{UserName: "user", UploadURL: "https://example.com", Failure: failure})
+	}
+	for locale, tmpl := range c.locales {
+		for _, name := range requiredTemplates {
+			if tmpl.Lookup(name) == nil {
+				return fmt.Errorf("%s templates are missing %s", locale, name)
+			}
+			for _, sample := range samples {
+				if err := tmpl.ExecuteTemplate(&bytes.Buffer{}, name, sample); err != nil {
+					return fmt.Errorf("error rendering %s template %s: %w", locale, name, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+/*
+Renders a reply in the given locale. Locales are matched on the language alone, so "es-419" gets the
+"es" copy; anything without copy, including an empty locale, gets DefaultLocale.
+*/
+func (c *Catalog) Render(locale string, name string, data Data) (string, error) {
+	tmpl, ok := c.locales[language(locale)]
+	if !ok {
+		tmpl = c.locales[DefaultLocale]
+	}
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// Gets the language subtag of a BCP 47 tag, e.g. "pt" from "pt-BR"
+func language(locale string) string {
+	lang, _, _ := strings.Cut(locale, "-")
+	return strings.ToLower(lang)
+}
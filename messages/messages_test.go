@@ -0,0 +1,82 @@
+package messages
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadBuiltInTemplates(t *testing.T) {
+	catalog, err := Load("")
+	assert.Nil(t, err)
+	assert.Contains(t, catalog.locales, "en")
+	assert.Contains(t, catalog.locales, "es")
+}
+
+func TestRender(t *testing.T) {
+	catalog, err := Load("")
+	assert.Nil(t, err)
+	data := Data{UserName: "foo", ResultsURL: "https://example.com/media/analysis?id=foo.mp4"}
+
+	testCases := []struct {
+		description string
+		locale      string
+		startsWith  string
+	}{
+		{"renders the requested locale", "es", "🔴 Veredicto de TrueMedia"},
+		{"matches on language alone", "es-419", "🔴 Veredicto de TrueMedia"},
+		{"falls back to the default locale", "ja", "🔴 TrueMedia verdict"},
+		{"uses the default locale when none is given", "", "🔴 TrueMedia verdict"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			content, err := catalog.Render(testCase.locale, TemplateFinalHigh, data)
+			assert.Nil(t, err)
+			assert.True(t, strings.HasPrefix(content, testCase.startsWith), content)
+			assert.Contains(t, content, data.ResultsURL)
+			assert.Contains(t, content, "@foo")
+		})
+	}
+
+	t.Run("summarizes posts with several media items in place of the tagline", func(t *testing.T) {
+		content, err := catalog.Render("en", TemplateFinalUncertain, Data{UserName: "foo", Matching: 1, Total: 2})
+		assert.Nil(t, err)
+		assert.Contains(t, content, "1 of 2 items in this post shows some evidence of manipulation.")
+		assert.NotContains(t, content, "non-partisan")
+	})
+}
+
+func TestRenderCard(t *testing.T) {
+	catalog, err := Load("")
+	assert.Nil(t, err)
+
+	label, err := catalog.Render("es", TemplateCardLabel, Data{Verdict: VerdictUncertain})
+	assert.Nil(t, err)
+	assert.Equal(t, "Alguna evidencia de manipulación", label)
+
+	altText, err := catalog.Render("en", TemplateCardAltText, Data{Verdict: VerdictLow})
+	assert.Nil(t, err)
+	assert.Equal(t, "TrueMedia.org verdict: little evidence of manipulation.", altText)
+}
+
+func TestLoadRejectsIncompleteTemplates(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "en.tmpl"), []byte(`{{define "processing"}}{{.ResultsURL}}{{end}}`), 0o644))
+
+	_, err := Load(dir)
+	assert.ErrorContains(t, err, "en templates are missing final_low")
+}
+
+func TestLoadRejectsTemplatesThatFailToRender(t *testing.T) {
+	dir := t.TempDir()
+	builtIn, err := os.ReadFile("templates/en.tmpl")
+	assert.Nil(t, err)
+	broken := strings.Replace(string(builtIn), "{{.UserName}}", "{{.Handle}}", 1)
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "en.tmpl"), []byte(broken), 0o644))
+
+	_, err = Load(dir)
+	assert.ErrorContains(t, err, "error rendering en template")
+}
@@ -0,0 +1,79 @@
+/*
+Prometheus metrics covering the mention pipeline, from fetching mentions to posting the FINAL reply.
+They're registered with the default registry and served at /metrics on the healthcheck server.
+*/
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Where a mention came from, for MentionsFetched
+const (
+	SourcePoll   = "poll"
+	SourceStream = "stream"
+	// Pushed to the bot, such as by a webhook
+	SourcePush = "push"
+)
+
+// How resolving a post's media went, for MediaResolved
+const (
+	ResolveResolved = "resolved"
+	// The post was resolved for an earlier mention
+	ResolveReused = "reused"
+	// TrueMedia couldn't get media out of the post
+	ResolveFailed = "failed"
+	// The request to TrueMedia didn't go through
+	ResolveError = "error"
+)
+
+var (
+	MentionsFetched = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "socialbot_mentions_fetched_total",
+		Help: "Mentions of the bot received from each platform, by where they came from.",
+	}, []string{"platform", "source"})
+
+	MediaResolved = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "socialbot_media_resolved_total",
+		Help: "Attempts to resolve the media in mentioned posts, by result and failure reason.",
+	}, []string{"platform", "result", "reason"})
+
+	AnalysesChecked = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "socialbot_analyses_checked_total",
+		Help: "Analyses fetched from TrueMedia by the responders, by state and verdict.",
+	}, []string{"platform", "state", "verdict"})
+
+	RepliesPosted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "socialbot_replies_posted_total",
+		Help: "Replies posted, by reply type.",
+	}, []string{"platform", "type"})
+
+	ReplyFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "socialbot_reply_failures_total",
+		Help: "Replies that couldn't be posted, by reply type and the kind of API error.",
+	}, []string{"platform", "type", "error"})
+
+	MentionReplySeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "socialbot_mention_reply_seconds",
+		Help: "Time from a mention being queued to its FINAL reply.",
+		// 5 seconds up to about 3 hours
+		Buckets: prometheus.ExponentialBuckets(5, 2, 12),
+	}, []string{"platform"})
+
+	XRateLimitRemaining = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "socialbot_x_rate_limit_remaining",
+		Help: "Requests left in the current X rate limit window, as of the last response, by endpoint.",
+	}, []string{"endpoint"})
+
+	XRateLimitReset = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "socialbot_x_rate_limit_reset_timestamp_seconds",
+		Help: "When the current X rate limit window resets, as a Unix timestamp, by endpoint.",
+	}, []string{"endpoint"})
+
+	TruemediaRequestSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "socialbot_truemedia_request_seconds",
+		Help:    "Latency of requests to the TrueMedia API, by method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "code"})
+)
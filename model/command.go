@@ -0,0 +1,87 @@
+package model
+
+import (
+	"strings"
+	"unicode"
+)
+
+// What a user asked the bot to do when they mentioned it
+type Command string
+
+const (
+	// Reply with the verdict; also used when the mention doesn't contain a known command
+	CommandVerdict Command = "VERDICT"
+	// Reply with the verdict and the score from each detector
+	CommandDetails Command = "DETAILS"
+	// Reply with the verdict and a plain-language explanation of what it means
+	CommandExplain Command = "EXPLAIN"
+	// Stop replying under the user's posts
+	CommandStop Command = "STOP"
+)
+
+/*
+Finds the command in the text of a mention of the bot, whose user name is botHandle. The command is the
+first word that isn't a mention of an account (e.g. "@TrueMediaBot details", or "u/TrueMediaBot details"
+on Reddit), ignoring case and punctuation. Stopping replies can't be undone by the user, so "stop" only
+counts right after the bot's own handle; "Stop sharing this @TrueMediaBot" asks for the verdict.
+Anything else is a plain request for the verdict.
+*/
+func ParseCommand(text string, botHandle string) Command {
+	afterBot := false
+	for _, word := range strings.Fields(text) {
+		if isAccountMention(word) {
+			afterBot = mentionsAccount(word, botHandle)
+			continue
+		}
+		word = strings.TrimFunc(strings.ToLower(word), func(r rune) bool { return !unicode.IsLetter(r) })
+		switch word {
+		case "details":
+			return CommandDetails
+		case "explain":
+			return CommandExplain
+		case "stop":
+			if afterBot {
+				return CommandStop
+			}
+			return CommandVerdict
+		default:
+			return CommandVerdict
+		}
+	}
+	return CommandVerdict
+}
+
+// Commands are stored in the database by name; mentions queued before commands existed have none
+func commandFromString(s string) Command {
+	switch Command(strings.ToUpper(s)) {
+	case CommandDetails:
+		return CommandDetails
+	case CommandExplain:
+		return CommandExplain
+	case CommandStop:
+		return CommandStop
+	default:
+		return CommandVerdict
+	}
+}
+
+func isAccountMention(word string) bool {
+	return strings.HasPrefix(word, "@") || strings.HasPrefix(word, "u/") || strings.HasPrefix(word, "/u/")
+}
+
+// Whether a mention like "@TrueMediaBot," or "@TrueMediaBot@mastodon.social" names the given account
+func mentionsAccount(word string, handle string) bool {
+	if handle == "" {
+		return false
+	}
+	for _, prefix := range []string{"@", "/u/", "u/"} {
+		if name, found := strings.CutPrefix(word, prefix); found {
+			word = name
+			break
+		}
+	}
+	word = strings.TrimRightFunc(word, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' })
+	// Mastodon mentions from other instances carry the bot's instance after a second @
+	name, _, _ := strings.Cut(word, "@")
+	return strings.EqualFold(word, handle) || strings.EqualFold(name, handle)
+}
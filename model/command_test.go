@@ -0,0 +1,35 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCommand(t *testing.T) {
+	testCases := []struct {
+		text     string
+		handle   string
+		expected Command
+	}{
+		{"@TrueMediaBot details", "TrueMediaBot", CommandDetails},
+		{"@someone @TrueMediaBot Explain!", "TrueMediaBot", CommandExplain},
+		{"u/TrueMediaBot stop", "TrueMediaBot", CommandStop},
+		{"@truemediabot, stop", "TrueMediaBot", CommandStop},
+		{"@TrueMediaBot@mastodon.social stop", "TrueMediaBot", CommandStop},
+		{"@TrueMediaBot.bsky.social STOP.", "truemediabot.bsky.social", CommandStop},
+		{"details @TrueMediaBot", "TrueMediaBot", CommandDetails},
+		{"Stop sharing this @TrueMediaBot is it real?", "TrueMediaBot", CommandVerdict},
+		{"@TrueMediaBot @someone stop", "TrueMediaBot", CommandVerdict},
+		{"@TrueMediaBotFan stop", "TrueMediaBot", CommandVerdict},
+		{"@TrueMediaBot is this real?", "TrueMediaBot", CommandVerdict},
+		{"@TrueMediaBot please explain", "TrueMediaBot", CommandVerdict},
+		{"@TrueMediaBot", "TrueMediaBot", CommandVerdict},
+		{"", "TrueMediaBot", CommandVerdict},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.text, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, ParseCommand(testCase.text, testCase.handle))
+		})
+	}
+}
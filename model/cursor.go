@@ -0,0 +1,29 @@
+package model
+
+import (
+	"time"
+
+	"github.com/truemediaorg/socialbot/database/db"
+)
+
+// How far the watcher has read a bot account's mentions on a platform
+type Cursor struct {
+	Platform Platform
+	Account  string
+	// Platform ID of the newest mention the watcher has handled
+	Value   string
+	Updated time.Time
+}
+
+func CursorFromPlatformCursor(pc db.PlatformCursor) (*Cursor, error) {
+	platform, err := ParsePlatform(pc.Platform)
+	if err != nil {
+		return nil, err
+	}
+	return &Cursor{
+		Platform: platform,
+		Account:  pc.Account,
+		Value:    pc.Cursor,
+		Updated:  pc.Updated,
+	}, nil
+}
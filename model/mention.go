@@ -12,7 +12,28 @@ type Mention struct {
 	PlatformID       string
 	PlatformUserName string
 	Enqueued         time.Time
-	MediaID          string
+	// The first media item resolved from the post; its analysis page is linked in replies
+	MediaID string
+	// Every media item resolved from the post, starting with MediaID
+	MediaIDs []string
+	// The post the mention replies to, which holds the media
+	MediaPostURL string
+	// Why TrueMedia couldn't resolve the post's media, if it couldn't; MediaIDs is empty in that case
+	FailureReason string
+	// Language of the mention as reported by the platform, or empty if unknown
+	Language string
+	// What the user asked for
+	Command Command
+
+	State db.MentionState
+	// How many attempts at handling the mention have failed since it was last queued
+	Attempts int
+	// Why the last attempt failed, if it did
+	LastError string
+	// When the mention can be tried again after a failure, or nil if it can be tried now
+	NextAttemptAt *time.Time
+	// W3C trace context of the span the watcher started for the mention, or empty if tracing was off
+	TraceParent string
 }
 
 func MentionFromMentionQueue(mq db.MentionQueue) (*Mention, error) {
@@ -20,6 +41,11 @@ func MentionFromMentionQueue(mq db.MentionQueue) (*Mention, error) {
 	if err != nil {
 		return nil, err
 	}
+	mediaIDs := mq.MediaIDs
+	if len(mediaIDs) == 0 && mq.MediaID != "" {
+		// Mentions queued before media_ids existed only have the one
+		mediaIDs = []string{mq.MediaID}
+	}
 	return &Mention{
 		ID:               mq.ID,
 		Platform:         platform,
@@ -27,5 +53,15 @@ func MentionFromMentionQueue(mq db.MentionQueue) (*Mention, error) {
 		PlatformUserName: mq.PlatformUserName,
 		Enqueued:         mq.Enqueued,
 		MediaID:          mq.MediaID,
+		MediaIDs:         mediaIDs,
+		MediaPostURL:     mq.MediaPostURL,
+		FailureReason:    mq.FailureReason,
+		Language:         mq.Language,
+		Command:          commandFromString(mq.Command),
+		State:            mq.State,
+		Attempts:         mq.Attempts,
+		LastError:        mq.LastError,
+		NextAttemptAt:    mq.NextAttemptAt,
+		TraceParent:      mq.TraceParent,
 	}, nil
 }
@@ -12,6 +12,7 @@ const (
 	PlatformX        Platform = "X"
 	PlatformReddit   Platform = "REDDIT"
 	PlatformMastadon Platform = "MASTADON" // typo'd consistently with everything else
+	PlatformBluesky  Platform = "BLUESKY"
 	// TODO: Add more as needed
 )
 
@@ -23,6 +24,8 @@ func ParsePlatform(s string) (Platform, error) {
 		return PlatformReddit, nil
 	case string(PlatformMastadon):
 		return PlatformMastadon, nil
+	case string(PlatformBluesky):
+		return PlatformBluesky, nil
 	default:
 		return PlatformX, fmt.Errorf("unknown platform: %s", s)
 	}
@@ -14,6 +14,10 @@ type Reply struct {
 	Replied    time.Time
 	MediaID    string
 	Type       db.ReplyType
+	// There's a reply like this on the platform, but its ID isn't known, so it can't be edited or replied under
+	Placeholder bool
+	// Replaced by a fresh reply an operator asked for; it's still on the platform but no longer counts
+	Superseded bool
 }
 
 func ReplyFromMentionReply(mq db.MentionReply) (*Reply, error) {
@@ -22,11 +26,13 @@ func ReplyFromMentionReply(mq db.MentionReply) (*Reply, error) {
 		return nil, err
 	}
 	return &Reply{
-		ID:         mq.ID,
-		MentionID:  mq.MentionID,
-		Platform:   platform,
-		PlatformID: mq.PlatformID,
-		Replied:    mq.Replied,
-		Type:       mq.Type,
+		ID:          mq.ID,
+		MentionID:   mq.MentionID,
+		Platform:    platform,
+		PlatformID:  mq.PlatformID,
+		Replied:     mq.Replied,
+		Type:        mq.Type,
+		Placeholder: mq.Placeholder,
+		Superseded:  mq.Superseded,
 	}, nil
 }
@@ -0,0 +1,139 @@
+package platform
+
+import (
+	"context"
+	"time"
+
+	"github.com/truemediaorg/socialbot/model"
+)
+
+/*
+How far back the watcher looks for mentions on an account it has no cursor for, such as one just added.
+Older mentions are left alone, so the bot doesn't reply to posts from long before it was watching.
+*/
+const InitialBacklog = 1 * time.Hour
+
+/*
+SocialPlatform is implemented by each social network the bot can watch and reply on.
+The watcher uses it to find mentions of the bot, and the responder uses it to post
+the analysis results back to the post that carries the media.
+*/
+type SocialPlatform interface {
+	// Platform identifies which platform this is, as stored in the database
+	Platform() model.Platform
+	// Account identifies the bot's account on the platform; polling cursors are kept per account
+	Account() string
+	// Handle is the bot's user name as people write it when they mention the bot
+	Handle() string
+	// PollInterval is how long the watcher should wait between checks for new mentions
+	PollInterval() time.Duration
+	// GetMentionsSince returns all mentions of the bot newer than cursor, oldest first.
+	// An empty cursor returns the mentions from the last InitialBacklog.
+	GetMentionsSince(ctx context.Context, cursor string) ([]Mention, error)
+	// PostReply replies to the post at parentPostURL and returns the platform ID of the reply
+	PostReply(ctx context.Context, parentPostURL string, message string) (string, error)
+	// PostThreadedReply replies to one of the bot's own earlier replies and returns the platform ID of the new reply
+	PostThreadedReply(ctx context.Context, replyID string, message string) (string, error)
+	// ClassifyError inspects an error returned by the platform's API
+	ClassifyError(err error) APIError
+}
+
+// ReplyEditor is implemented by platforms that let the bot edit its own replies
+type ReplyEditor interface {
+	// EditReply replaces the content of one of the bot's earlier replies
+	EditReply(ctx context.Context, replyID string, message string) error
+}
+
+// ImageReplier is implemented by platforms that can attach an image to the bot's replies
+type ImageReplier interface {
+	// PostReplyWithImage is PostReply with an image attached
+	PostReplyWithImage(ctx context.Context, parentPostURL string, message string, image Image) (string, error)
+	// PostThreadedReplyWithImage is PostThreadedReply with an image attached
+	PostThreadedReplyWithImage(ctx context.Context, replyID string, message string, image Image) (string, error)
+}
+
+// MediaThumbnailer is implemented by platforms that can point to a preview image of a post's media
+type MediaThumbnailer interface {
+	// MediaThumbnailURL returns the URL of a still image of the first media item in the post at postURL
+	MediaThumbnailURL(ctx context.Context, postURL string) (string, error)
+}
+
+/*
+MentionStreamer is implemented by platforms that can push mentions as they're posted, rather than waiting
+for the next poll. Streamed mentions may be missed while the stream is down, so polling carries on alongside it.
+*/
+type MentionStreamer interface {
+	// StreamingEnabled is whether the platform has been configured to stream mentions
+	StreamingEnabled() bool
+	// StreamMentions sends mentions of the bot to mentions as they arrive, reconnecting whenever the stream drops.
+	// It blocks until ctx is done.
+	StreamMentions(ctx context.Context, mentions chan<- Mention) error
+}
+
+// An image to attach to a reply
+type Image struct {
+	PNG []byte
+	// Description of the image for screen readers
+	AltText string
+}
+
+// A mention of the bot found on a social platform
+type Mention struct {
+	// Platform ID of the post that mentions the bot; also used as the polling cursor unless Cursor is set
+	PlatformID string
+	// Where polling picks up after this mention, on platforms whose post IDs don't follow the order mentions arrive in
+	Cursor string
+	// User name of the account that mentioned the bot
+	AuthorUserName string
+	// URL of the post the mention replies to, if that post carries media.
+	// Empty if there's nothing for the bot to analyze.
+	MediaPostURL string
+	// User name of the account that posted the media, set along with MediaPostURL
+	MediaPostAuthorUserName string
+	// Plain text of the mention, which may hold a command for the bot
+	Text string
+	// BCP 47 language tag of the mention, used to pick the language of the bot's replies.
+	// Empty if the platform doesn't say.
+	Language string
+}
+
+// Where polling picks up once this mention is handled
+func (m Mention) PollCursor() string {
+	if m.Cursor != "" {
+		return m.Cursor
+	}
+	return m.PlatformID
+}
+
+type APIErrorKind int
+
+const (
+	// The error isn't one the bot knows how to handle
+	APIErrorKindUnknown APIErrorKind = iota
+	// The platform is rate limiting the bot; wait until RetryAt and try again
+	APIErrorKindRateLimited
+	// The post being replied to was deleted or isn't visible to the bot
+	APIErrorKindPostDeleted
+	// The platform rejected the reply as a duplicate of one already posted
+	APIErrorKindDuplicateReply
+)
+
+// Names the kind of error for logs and metrics
+func (k APIErrorKind) String() string {
+	switch k {
+	case APIErrorKindRateLimited:
+		return "rate_limited"
+	case APIErrorKindPostDeleted:
+		return "post_deleted"
+	case APIErrorKindDuplicateReply:
+		return "duplicate_reply"
+	default:
+		return "unknown"
+	}
+}
+
+type APIError struct {
+	Kind    APIErrorKind
+	RetryAt time.Time
+	Detail  string
+}
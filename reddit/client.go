@@ -0,0 +1,246 @@
+package reddit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultAPIURL   = "https://oauth.reddit.com"
+	DefaultTokenURL = "https://www.reddit.com/api/v1/access_token"
+
+	// Refresh the access token this long before Reddit says it expires
+	tokenExpiryMargin = 1 * time.Minute
+)
+
+// Returned when Reddit has no record of a thing, or it was removed
+var ErrThingNotFound = errors.New("thing not found")
+
+/*
+Credentials for a Reddit "script" app, which acts as the account of the developer that
+registered it. Reddit exchanges these for an hour-long bearer token using the password grant.
+*/
+type Credentials struct {
+	ClientID     string
+	ClientSecret string
+	UserName     string
+	Password     string
+}
+
+type Client struct {
+	apiURL      string
+	tokenURL    string
+	credentials Credentials
+	userAgent   string
+	HTTPClient  *http.Client
+
+	tokenLock   sync.Mutex
+	accessToken string
+	tokenExpiry time.Time
+}
+
+// Error response from the Reddit API
+type APIError struct {
+	StatusCode int
+	// Reddit's error code (e.g. "RATELIMIT" or "DELETED_COMMENT"), if it sent one
+	Code    string
+	Message string
+	// When the rate limit resets, if Reddit sent one
+	RateLimitReset time.Time
+}
+
+func (e APIError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("reddit callout status %d %s: %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("reddit callout status %d: %s", e.StatusCode, e.Message)
+}
+
+func NewClient(credentials Credentials, apiURL string, tokenURL string) *Client {
+	return &Client{
+		apiURL:      apiURL,
+		tokenURL:    tokenURL,
+		credentials: credentials,
+		// Reddit throttles generic user agents, and asks for this format
+		userAgent:  fmt.Sprintf("server:socialbot:v1 (by /u/%s)", credentials.UserName),
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+func (c *Client) UserName() string {
+	return c.credentials.UserName
+}
+
+// Gets a page of the bot's inbox, newest first. If after is set, only items older than it are returned.
+func (c *Client) GetInbox(ctx context.Context, after string, limit int) (*Listing, error) {
+	q := url.Values{}
+	q.Add("limit", strconv.Itoa(limit))
+	q.Add("raw_json", "1")
+	if after != "" {
+		q.Add("after", after)
+	}
+	var listing Listing
+	if err := c.do(ctx, http.MethodGet, "/message/inbox?"+q.Encode(), nil, &listing); err != nil {
+		return nil, err
+	}
+	return &listing, nil
+}
+
+// Gets a single link or comment by its fullname
+func (c *Client) GetThing(ctx context.Context, fullname string) (*Thing, error) {
+	q := url.Values{}
+	q.Add("id", fullname)
+	q.Add("raw_json", "1")
+	var listing Listing
+	if err := c.do(ctx, http.MethodGet, "/api/info?"+q.Encode(), nil, &listing); err != nil {
+		return nil, err
+	}
+	if len(listing.Data.Children) == 0 || listing.Data.Children[0].Data.Author == "[deleted]" {
+		return nil, ErrThingNotFound
+	}
+	return &listing.Data.Children[0], nil
+}
+
+// Posts a comment in reply to the link or comment with the given fullname
+func (c *Client) Comment(ctx context.Context, parentFullname string, text string) (*Thing, error) {
+	form := url.Values{}
+	form.Add("api_type", "json")
+	form.Add("thing_id", parentFullname)
+	form.Add("text", text)
+	return c.postUserText(ctx, "/api/comment", form)
+}
+
+// Replaces the text of one of the bot's comments
+func (c *Client) EditText(ctx context.Context, fullname string, text string) (*Thing, error) {
+	form := url.Values{}
+	form.Add("api_type", "json")
+	form.Add("thing_id", fullname)
+	form.Add("text", text)
+	return c.postUserText(ctx, "/api/editusertext", form)
+}
+
+// Submits a comment or edit and returns the resulting comment
+func (c *Client) postUserText(ctx context.Context, path string, form url.Values) (*Thing, error) {
+	var resp CommentResponse
+	if err := c.do(ctx, http.MethodPost, path, form, &resp); err != nil {
+		return nil, err
+	}
+	// Errors come back as [code, message, field] triples in a 200 response
+	if len(resp.JSON.Errors) > 0 {
+		apiError := &APIError{StatusCode: http.StatusOK}
+		if len(resp.JSON.Errors[0]) > 1 {
+			apiError.Code, _ = resp.JSON.Errors[0][0].(string)
+			apiError.Message, _ = resp.JSON.Errors[0][1].(string)
+		}
+		return nil, apiError
+	}
+	if len(resp.JSON.Data.Things) == 0 {
+		return nil, errors.New("reddit did not return the comment")
+	}
+	return &resp.JSON.Data.Things[0], nil
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, form url.Values, result any) error {
+	token, err := c.token(ctx)
+	if err != nil {
+		return err
+	}
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.apiURL+path, body)
+	if err != nil {
+		return err
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	req.Header.Set("User-Agent", c.userAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiError := &APIError{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+		// Reset is sent as seconds until the current rate limit window ends
+		if reset, err := strconv.ParseFloat(resp.Header.Get("X-Ratelimit-Reset"), 64); err == nil {
+			apiError.RateLimitReset = time.Now().Add(time.Duration(reset) * time.Second)
+		}
+		if resp.StatusCode == http.StatusUnauthorized {
+			// Force a new token on the next call in case this one was revoked early
+			c.tokenLock.Lock()
+			c.accessToken = ""
+			c.tokenLock.Unlock()
+		}
+		return apiError
+	}
+
+	return json.Unmarshal(respBody, result)
+}
+
+// Gets a bearer token, requesting a new one from Reddit if the current one is missing or about to expire
+func (c *Client) token(ctx context.Context) (string, error) {
+	c.tokenLock.Lock()
+	defer c.tokenLock.Unlock()
+	if c.accessToken != "" && time.Now().Before(c.tokenExpiry) {
+		return c.accessToken, nil
+	}
+
+	form := url.Values{}
+	form.Add("grant_type", "password")
+	form.Add("username", c.credentials.UserName)
+	form.Add("password", c.credentials.Password)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(c.credentials.ClientID, c.credentials.ClientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", c.userAgent)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "", &APIError{StatusCode: resp.StatusCode, Message: "unable to get access token"}
+	}
+
+	var atr accessTokenResponse
+	if err = json.Unmarshal(respBody, &atr); err != nil {
+		return "", err
+	}
+	// Bad credentials come back as a 200 with an error field
+	if atr.Error != "" || atr.AccessToken == "" {
+		return "", &APIError{StatusCode: resp.StatusCode, Code: atr.Error, Message: "unable to get access token"}
+	}
+
+	c.accessToken = atr.AccessToken
+	c.tokenExpiry = time.Now().Add(time.Duration(atr.ExpiresIn)*time.Second - tokenExpiryMargin)
+	return c.accessToken, nil
+}
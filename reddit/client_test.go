@@ -0,0 +1,98 @@
+package reddit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Serves the token endpoint and an empty inbox, handing out a new token on each password grant
+func newFakeRedditServer(t *testing.T, expiresIn int) (*httptest.Server, *int) {
+	tokensIssued := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/access_token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "client", clientID)
+		assert.NotEmpty(t, r.UserAgent())
+		assert.Nil(t, r.ParseForm())
+		assert.Equal(t, "password", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "TrueMediaBot", r.PostForm.Get("username"))
+		// Reddit reports bad credentials in a 200
+		if clientSecret != "secret" || r.PostForm.Get("password") != "hunter2" {
+			json.NewEncoder(w).Encode(accessTokenResponse{Error: "invalid_grant"})
+			return
+		}
+		tokensIssued++
+		json.NewEncoder(w).Encode(accessTokenResponse{AccessToken: fmt.Sprintf("token%d", tokensIssued), ExpiresIn: expiresIn})
+	})
+	mux.HandleFunc("GET /message/inbox", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer revoked" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(Listing{Kind: "Listing"})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &tokensIssued
+}
+
+func newTestClient(serverURL string, password string) *Client {
+	return NewClient(Credentials{ClientID: "client", ClientSecret: "secret", UserName: "TrueMediaBot", Password: password}, serverURL, serverURL+"/api/v1/access_token")
+}
+
+func TestClientToken(t *testing.T) {
+	t.Run("reuses the token until it's about to expire", func(t *testing.T) {
+		server, tokensIssued := newFakeRedditServer(t, 3600)
+		client := newTestClient(server.URL, "hunter2")
+		for range 3 {
+			_, err := client.GetInbox(context.TODO(), "", 10)
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, 1, *tokensIssued)
+		assert.Equal(t, "token1", client.accessToken)
+	})
+
+	t.Run("gets a new token once the old one expires", func(t *testing.T) {
+		// Tokens that expire within the safety margin count as expired straight away
+		server, tokensIssued := newFakeRedditServer(t, 30)
+		client := newTestClient(server.URL, "hunter2")
+		for range 2 {
+			_, err := client.GetInbox(context.TODO(), "", 10)
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, 2, *tokensIssued)
+	})
+
+	t.Run("gets a new token after one is rejected", func(t *testing.T) {
+		server, tokensIssued := newFakeRedditServer(t, 3600)
+		client := newTestClient(server.URL, "hunter2")
+		_, err := client.GetInbox(context.TODO(), "", 10)
+		assert.NoError(t, err)
+		client.accessToken = "revoked"
+
+		_, err = client.GetInbox(context.TODO(), "", 10)
+		var apiError *APIError
+		assert.ErrorAs(t, err, &apiError)
+		assert.Equal(t, http.StatusUnauthorized, apiError.StatusCode)
+		_, err = client.GetInbox(context.TODO(), "", 10)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, *tokensIssued)
+	})
+
+	t.Run("reports bad credentials", func(t *testing.T) {
+		server, tokensIssued := newFakeRedditServer(t, 3600)
+		client := newTestClient(server.URL, "wrong")
+		_, err := client.GetInbox(context.TODO(), "", 10)
+		var apiError *APIError
+		assert.ErrorAs(t, err, &apiError)
+		assert.Equal(t, "invalid_grant", apiError.Code)
+		assert.Equal(t, 0, *tokensIssued)
+	})
+}
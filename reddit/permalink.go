@@ -0,0 +1,43 @@
+package reddit
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var permalinkRegexp = regexp.MustCompile(`^https?://(?:(?:www|old|new)\.)?reddit\.com/r/\w+/comments/(?P<LinkID>[a-z0-9]+)(?:/[^/]*(?:/(?P<CommentID>[a-z0-9]+))?)?/?(?:\?.*)?$`)
+
+func ConstructPermalinkURL(permalink string) string {
+	return "https://www.reddit.com" + permalink
+}
+
+// Takes in a Reddit permalink and returns the fullname of the link or comment it points to
+func FullnameFromPermalink(permalinkURL string) (string, error) {
+	matches := permalinkRegexp.FindStringSubmatch(permalinkURL)
+	if matches == nil {
+		return "", errors.New("not a reddit permalink")
+	}
+	if commentID := matches[2]; commentID != "" {
+		return fmt.Sprintf("%s_%s", KindComment, commentID), nil
+	}
+	return fmt.Sprintf("%s_%s", KindLink, matches[1]), nil
+}
+
+// Splits a fullname like "t1_abc123" into its kind and ID
+func SplitFullname(fullname string) (string, string) {
+	kind, id, _ := strings.Cut(fullname, "_")
+	return kind, id
+}
+
+// Compares two Reddit IDs. They're base 36, so longer IDs are always newer.
+func CompareIDs(a string, b string) int {
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
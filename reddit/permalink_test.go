@@ -0,0 +1,41 @@
+package reddit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFullnameFromPermalink(t *testing.T) {
+	t.Run("returns the link for submission permalinks", func(t *testing.T) {
+		fullname, err := FullnameFromPermalink("https://www.reddit.com/r/pics/comments/1abcde/a_very_real_photo/")
+		assert.NoError(t, err)
+		assert.Equal(t, "t3_1abcde", fullname)
+
+		fullname, err = FullnameFromPermalink("https://reddit.com/r/pics/comments/1abcde")
+		assert.NoError(t, err)
+		assert.Equal(t, "t3_1abcde", fullname)
+	})
+
+	t.Run("returns the comment for comment permalinks", func(t *testing.T) {
+		fullname, err := FullnameFromPermalink("https://www.reddit.com/r/pics/comments/1abcde/a_very_real_photo/kz9x8y7/")
+		assert.NoError(t, err)
+		assert.Equal(t, "t1_kz9x8y7", fullname)
+
+		fullname, err = FullnameFromPermalink("https://old.reddit.com/r/pics/comments/1abcde/a_very_real_photo/kz9x8y7?context=3")
+		assert.NoError(t, err)
+		assert.Equal(t, "t1_kz9x8y7", fullname)
+	})
+
+	t.Run("rejects non-Reddit URLs", func(t *testing.T) {
+		fullname, err := FullnameFromPermalink("https://www.someotherwebsite.com/r/pics/comments/1abcde/")
+		assert.Error(t, err)
+		assert.Equal(t, "", fullname)
+	})
+}
+
+func TestCompareIDs(t *testing.T) {
+	assert.Equal(t, -1, CompareIDs("zz", "100"))
+	assert.Equal(t, 1, CompareIDs("kz9x8y8", "kz9x8y7"))
+	assert.Equal(t, 0, CompareIDs("abc", "abc"))
+}
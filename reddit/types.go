@@ -0,0 +1,85 @@
+package reddit
+
+import "encoding/json"
+
+// Reddit prefixes IDs with a type to make "fullnames", e.g. t1_abc123 for a comment
+const (
+	KindComment = "t1"
+	KindLink    = "t3"
+	KindMessage = "t4"
+)
+
+// Type of an inbox item that was created because the bot was mentioned by name
+const InboxTypeUsernameMention = "username_mention"
+
+type Listing struct {
+	Kind string      `json:"kind"`
+	Data ListingData `json:"data"`
+}
+
+type ListingData struct {
+	After    string  `json:"after"`
+	Before   string  `json:"before"`
+	Children []Thing `json:"children"`
+}
+
+// Anything Reddit can return in a listing. Which fields are filled in depends on Kind.
+type Thing struct {
+	Kind string    `json:"kind"`
+	Data ThingData `json:"data"`
+}
+
+type ThingData struct {
+	ID        string  `json:"id"`
+	Name      string  `json:"name"`
+	Author    string  `json:"author"`
+	CreatedAt float64 `json:"created_utc"`
+	Permalink string  `json:"permalink"`
+
+	// Inbox items
+	Type     string `json:"type,omitempty"`
+	Body     string `json:"body,omitempty"`
+	ParentID string `json:"parent_id,omitempty"`
+	Context  string `json:"context,omitempty"`
+
+	// Links (submissions)
+	URL       string `json:"url,omitempty"`
+	PostHint  string `json:"post_hint,omitempty"`
+	IsVideo   bool   `json:"is_video,omitempty"`
+	IsGallery bool   `json:"is_gallery,omitempty"`
+
+	// Comments, and links with galleries. Keyed by media ID.
+	MediaMetadata map[string]json.RawMessage `json:"media_metadata,omitempty"`
+}
+
+// The "json" envelope Reddit wraps around API responses when api_type=json is sent
+type CommentResponse struct {
+	JSON struct {
+		Errors [][]any `json:"errors"`
+		Data   struct {
+			Things []Thing `json:"things"`
+		} `json:"data"`
+	} `json:"json"`
+}
+
+type accessTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	Error       string `json:"error,omitempty"`
+}
+
+// Whether the thing is a link or comment carrying an image, gallery, or video
+func (t Thing) HasMedia() bool {
+	switch t.Kind {
+	case KindLink:
+		switch t.Data.PostHint {
+		case "image", "hosted:video", "rich:video":
+			return true
+		}
+		return t.Data.IsVideo || t.Data.IsGallery || len(t.Data.MediaMetadata) > 0
+	case KindComment:
+		return len(t.Data.MediaMetadata) > 0
+	default:
+		return false
+	}
+}
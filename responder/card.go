@@ -0,0 +1,136 @@
+package responder
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/truemediaorg/socialbot/card"
+	"github.com/truemediaorg/socialbot/messages"
+	"github.com/truemediaorg/socialbot/model"
+	"github.com/truemediaorg/socialbot/platform"
+	"github.com/truemediaorg/socialbot/truemedia"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// How many model scores a "details" reply lists
+const maxDetailScores = 3
+
+/*
+Renders the verdict card for a mention's completed analyses, or returns nil if the platform can't
+attach images or the card can't be made. Cards are a nice-to-have, so failures are logged rather
+than holding up the reply. In test mode the card is written to a temp file instead.
+*/
+func (r *Responder) renderVerdictCard(ctx context.Context, mention model.Mention, analyses []truemedia.GetResultResponse) *platform.Image {
+	if _, ok := r.platform.(platform.ImageReplier); !ok && !r.testModeEnabled {
+		return nil
+	}
+
+	worst := worstAnalysis(analyses)
+	mediaID := mention.MediaID
+	if worst < len(mention.MediaIDs) {
+		mediaID = mention.MediaIDs[worst]
+	}
+	data := messages.Data{Verdict: verdictName(analyses[worst].Verdict)}
+	if data.Verdict == "" {
+		return nil
+	}
+	verdictCard := card.Card{
+		Color:         verdictColor(analyses[worst].Verdict),
+		Heading:       r.render(mention, messages.TemplateCardHeading, data),
+		Label:         r.render(mention, messages.TemplateCardLabel, data),
+		ScoresHeading: r.render(mention, messages.TemplateCardScoresHeading, data),
+		Scores:        cardScores(analyses[worst]),
+	}
+	altText := r.render(mention, messages.TemplateCardAltText, data)
+	if verdictCard.Label == "" || altText == "" {
+		return nil
+	}
+	if thumbnailer, ok := r.platform.(platform.MediaThumbnailer); ok {
+		verdictCard.Thumbnail = r.fetchThumbnail(ctx, thumbnailer, mediaID)
+	}
+
+	png, err := card.Render(verdictCard)
+	if err != nil {
+		log.WithField("mediaId", mediaID).Errorf("error rendering verdict card: %v", err)
+		return nil
+	}
+	cardImage := &platform.Image{
+		PNG:     png,
+		AltText: altText,
+	}
+
+	if r.testModeEnabled {
+		path := filepath.Join(os.TempDir(), fmt.Sprintf("socialbot-card-%s.png", mention.ID))
+		if err := os.WriteFile(path, png, 0o644); err != nil {
+			log.WithField("path", path).Errorf("error writing verdict card: %v", err)
+		} else {
+			log.WithField("path", path).Infof("Wrote verdict card for %s mention ID=%s", mention.Platform, mention.PlatformID)
+		}
+	}
+	return cardImage
+}
+
+// Gets a still of the media to show on the card, or nil if there isn't one
+func (r *Responder) fetchThumbnail(ctx context.Context, thumbnailer platform.MediaThumbnailer, mediaID string) image.Image {
+	postURL, err := r.db.GetMediaPostUrl(ctx, mediaID)
+	if err != nil {
+		log.WithField("mediaId", mediaID).Warnf("error finding post for thumbnail: %v", err)
+		return nil
+	}
+	thumbnailURL, err := thumbnailer.MediaThumbnailURL(ctx, postURL)
+	if err != nil || thumbnailURL == "" {
+		log.WithField("postURL", postURL).Debugf("no thumbnail available: %v", err)
+		return nil
+	}
+	thumbnail, err := card.FetchThumbnail(ctx, thumbnailURL)
+	if err != nil {
+		log.WithField("thumbnailURL", thumbnailURL).Warnf("error fetching thumbnail: %v", err)
+		return nil
+	}
+	return thumbnail
+}
+
+// Converts an analysis's detector scores for the verdict card, highest first
+func cardScores(analysis truemedia.GetResultResponse) []card.Score {
+	var scores []card.Score
+	for _, score := range analysis.ModelScores() {
+		scores = append(scores, card.Score{Model: score.Model, Score: score.Score})
+	}
+	return scores
+}
+
+// Picks the top model scores to list in a "details" reply; only a few fit within post length limits
+func detailScores(analysis truemedia.GetResultResponse) []messages.Score {
+	var details []messages.Score
+	for _, score := range analysis.ModelScores() {
+		if len(details) == maxDetailScores {
+			break
+		}
+		details = append(details, messages.Score{
+			Model:     score.Model,
+			Percent:   int(math.Round(score.Score * 100)),
+			Rank:      score.Rank,
+			MediaType: string(score.MediaType),
+		})
+	}
+	return details
+}
+
+func verdictColor(verdict truemedia.Verdict) color.Color {
+	switch verdictSeverity(verdict) {
+	case 3:
+		return card.ColorHigh
+	case 2:
+		return card.ColorUncertain
+	case 1:
+		return card.ColorLow
+	default:
+		return card.ColorUnknown
+	}
+}
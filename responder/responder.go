@@ -4,167 +4,576 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/url"
 	"time"
 
-	"github.com/g8rswimmer/go-twitter/v2"
 	"github.com/lucsky/cuid"
 	"github.com/truemediaorg/socialbot/database/db"
+	"github.com/truemediaorg/socialbot/health"
+	"github.com/truemediaorg/socialbot/messages"
+	"github.com/truemediaorg/socialbot/metrics"
 	"github.com/truemediaorg/socialbot/model"
+	"github.com/truemediaorg/socialbot/platform"
+	"github.com/truemediaorg/socialbot/tracing"
 	"github.com/truemediaorg/socialbot/truemedia"
-	twitterutil "github.com/truemediaorg/socialbot/twitter"
+	"go.opentelemetry.io/otel/attribute"
 
 	log "github.com/sirupsen/logrus"
 )
 
 const (
-	// Used in the "final" response
-	lowVerdictMsg       = "🟢 TrueMedia verdict: 𝗹𝗶𝘁𝘁𝗹𝗲 𝗲𝘃𝗶𝗱𝗲𝗻𝗰𝗲 of manipulation. More analysis >"
-	uncertainVerdictMsg = "🟡 TrueMedia verdict: 𝘀𝗼𝗺𝗲 𝗲𝘃𝗶𝗱𝗲𝗻𝗰𝗲 of manipulation. More analysis >"
-	highVerdictMsg      = "🔴 TrueMedia verdict: 𝘀𝘂𝗯𝘀𝘁𝗮𝗻𝘁𝗶𝗮𝗹 𝗲𝘃𝗶𝗱𝗲𝗻𝗰𝗲 of manipulation. More analysis >"
-	unknownVerdictMsg   = "⏳ TrueMedia is taking longer than usual to analyze this media. Results will be available >"
-	trueMediaTagline    = "TrueMedia detects political deepfakes in social media. It's non-profit, non-partisan, and free."
-	userThankMsg        = "Thank you for submitting this, @%s." // UserName goes in the %s
-
 	maximumProcessingDelay = 15 * time.Minute // How long to wait before posting the analysis URL anyway
+	timedOutPollInterval   = 5 * time.Minute  // How often to check on analyses that ran past maximumProcessingDelay
+	maximumAnalysisAge     = 24 * time.Hour   // How long to keep checking before giving up on an analysis
+	callbackPollInterval   = 1 * time.Minute  // How often to check on analyses when TrueMedia calls back as they finish
+	// How many analysis callbacks can wait to be handled before more are dropped
+	completedBuffer = 100
+
+	// Failed mentions are abandoned after this many attempts
+	maxMentionAttempts = 5
+	// Wait before trying a failed mention again, doubling with each failure up to maxFailureBackoff
+	failureBackoff    = 1 * time.Minute
+	maxFailureBackoff = 1 * time.Hour
 
-	// Copied from the Twitter response, beware the risk of this changing over time.
-	deletedPostErrorMsg   = "You attempted to reply to a Tweet that is deleted or not visible to you."
-	duplicatePostErrorMsg = "You are not allowed to create a Tweet with duplicate content."
+	// How long other replicas leave a claimed mention alone. Leases are renewed every time the responder
+	// checks for work, so this only needs to outlast one pass over the claimed mentions.
+	mentionLeaseDuration = 5 * time.Minute
+	// Most mentions one responder works on at a time, leaving the rest for other replicas
+	mentionClaimLimit = 20
 )
 
 type ReplyHandler interface {
-	GetMentionsNeedingRepliesForPlatform(ctx context.Context, platform model.Platform) ([]model.Mention, error)
+	ClaimMentionsNeedingReplies(ctx context.Context, platform model.Platform, workerID string, leaseDuration time.Duration, limit int) ([]model.Mention, error)
+	ClaimMentionsForMedia(ctx context.Context, platform model.Platform, workerID string, leaseDuration time.Duration, mediaID string) ([]model.Mention, error)
+	ReleaseMentions(ctx context.Context, platform model.Platform, workerID string) error
 	DeleteMention(ctx context.Context, mentionID string) error
 	AddReply(ctx context.Context, mentionID string, platform model.Platform, platformID string, replyType db.ReplyType) error
+	AddPlaceholderReply(ctx context.Context, mentionID string, platform model.Platform, replyType db.ReplyType) error
 	FindRepliesForMention(ctx context.Context, mentionID string) ([]model.Reply, error)
 	GetMediaPostUrl(ctx context.Context, mediaID string) (string, error)
-}
-
-type TweetResponder interface {
-	TweetResponse(ctx context.Context, replyToID string, message string) (*twitter.CreateTweetResponse, error)
+	MarkMentionAnalyzing(ctx context.Context, mentionID string) error
+	RecordMentionFailure(ctx context.Context, mentionID string, lastError string, abandon bool, nextAttempt time.Time) error
+	PostponeMention(ctx context.Context, mentionID string, until time.Time) error
 }
 
 type MediaAnalyzer interface {
-	GetAnalysis(mediaID string) (*truemedia.GetResultResponse, error)
+	GetAnalysis(ctx context.Context, mediaID string) (*truemedia.GetResultResponse, error)
+	// Whether TrueMedia calls back when analyses finish, so they only need polling as a safety net
+	CallbacksEnabled() bool
 }
 
 type Responder struct {
-	twitterService   TweetResponder
+	platform         platform.SocialPlatform
 	truemediaService MediaAnalyzer
 	db               ReplyHandler
+	messages         *messages.Catalog
+	resultsURL       url.URL
 	testModeEnabled  bool
+	// Identifies this replica's claims on mentions
+	workerID string
+
+	// Media IDs whose analyses TrueMedia says have finished
+	completed chan string
+
+	// Beaten each time the responder checks for work
+	Heartbeat *health.Heartbeat
 }
 
-func NewResponder(twitterService TweetResponder, truemediaService MediaAnalyzer, db ReplyHandler, isTestMode bool) *Responder {
+func NewResponder(socialPlatform platform.SocialPlatform, truemediaService MediaAnalyzer, db ReplyHandler, catalog *messages.Catalog, resultsURL url.URL, workerID string, isTestMode bool) *Responder {
 	return &Responder{
-		twitterService:   twitterService,
+		platform:         socialPlatform,
 		truemediaService: truemediaService,
 		db:               db,
+		messages:         catalog,
+		resultsURL:       resultsURL,
 		testModeEnabled:  isTestMode,
+		workerID:         workerID,
+		completed:        make(chan string, completedBuffer),
 	}
 }
 
 func (r *Responder) Respond(ctx context.Context) error {
+	// check for work every 5 seconds to avoid slamming the truemedia API
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	r.Heartbeat.Beat()
 	for {
 		select {
 		case <-ctx.Done():
-			log.Debug("exiting Responder by closing channel")
+			log.WithField("platform", r.platform.Platform()).Debug("exiting Responder by closing channel")
+			// Hand the claimed mentions over to other replicas rather than making them wait out the leases
+			releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := r.db.ReleaseMentions(releaseCtx, r.platform.Platform(), r.workerID); err != nil {
+				log.WithField("platform", r.platform.Platform()).Warnf("error releasing claimed mentions: %v", err)
+			}
 			return nil
-		case <-time.After(5 * time.Second): // check for work every 5 seconds to avoid slamming the truemedia API
-			mentions, err := r.db.GetMentionsNeedingRepliesForPlatform(ctx, model.PlatformX)
-			if err != nil {
-				log.Errorf("error getting work: %v", err)
+		case mediaID := <-r.completed:
+			r.checkMentionsForMedia(ctx, mediaID)
+		case <-ticker.C:
+			r.Heartbeat.Beat()
+			if err := r.checkForWork(ctx); err != nil {
 				return err
 			}
-			if len(mentions) > 0 {
-				log.Infof("found %d mentions needing replies", len(mentions))
+		}
+	}
+}
+
+/*
+Claims the mentions that are due and checks on each of them. Mentions still waiting on an analysis are held
+off until their next check, so they don't take up the claim ahead of newer mentions.
+*/
+func (r *Responder) checkForWork(ctx context.Context) error {
+	mentions, err := r.db.ClaimMentionsNeedingReplies(ctx, r.platform.Platform(), r.workerID, mentionLeaseDuration, mentionClaimLimit)
+	if err != nil {
+		log.Errorf("error getting work: %v", err)
+		return err
+	}
+	if len(mentions) > 0 {
+		log.Infof("found %d mentions needing replies", len(mentions))
+	}
+
+	// Popular media gets mentioned many times, so each analysis is fetched once per pass and shared
+	analyses := map[string]truemedia.GetResultResponse{}
+	for _, mention := range mentions {
+		r.checkMention(ctx, mention, analyses)
+	}
+	return nil
+}
+
+/*
+Tells the responder a media item's analysis has finished, so mentions waiting on it are checked right away
+instead of at their next poll. Doesn't block; if too many are waiting, polling catches the mention later.
+*/
+func (r *Responder) Wake(mediaID string) {
+	select {
+	case r.completed <- mediaID:
+	default:
+		log.WithField("mediaId", mediaID).Warn("too many analysis callbacks waiting, leaving this one for polling")
+	}
+}
+
+/*
+Checks on every mention waiting on a media item whose analysis has finished. Errors are only logged, since
+polling picks the mentions up later anyway.
+*/
+func (r *Responder) checkMentionsForMedia(ctx context.Context, mediaID string) {
+	mentions, err := r.db.ClaimMentionsForMedia(ctx, r.platform.Platform(), r.workerID, mentionLeaseDuration, mediaID)
+	if err != nil {
+		log.WithField("mediaId", mediaID).Errorf("error getting mentions for completed analysis: %v", err)
+		return
+	}
+	analyses := map[string]truemedia.GetResultResponse{}
+	for _, mention := range mentions {
+		log.WithField("mediaId", mediaID).Debugf("analysis callback received, checking %s post ID=%s", mention.Platform, mention.PlatformID)
+		r.checkMention(ctx, mention, analyses)
+	}
+}
+
+/*
+Checks on a mention's analyses and posts whichever reply is due. fetched holds analyses already got this pass.
+The check is traced as part of the trace the watcher started for the mention.
+*/
+func (r *Responder) checkMention(ctx context.Context, mention model.Mention, fetched map[string]truemedia.GetResultResponse) {
+	ctx, span := tracing.Start(tracing.ContextWithTraceParent(ctx, mention.TraceParent), "check mention",
+		tracing.AttributePlatform.String(string(mention.Platform)),
+		tracing.AttributeMentionID.String(mention.ID),
+		tracing.AttributeMentionPlatformID.String(mention.PlatformID),
+		attribute.Int("socialbot.mention.attempts", mention.Attempts),
+	)
+	defer span.End()
+	if mention.FailureReason != "" {
+		// TrueMedia couldn't get the media out of the post, so all that's left is to tell the user why
+		r.recordFailure(ctx, mention, &truemedia.FailureError{Reason: truemedia.FailureReason(mention.FailureReason), Messages: []string{"unable to resolve post media"}}, true)
+		return
+	}
+	if mention.MediaID == "" {
+		// The media must've been deleted in the DB, so there's no point trying again
+		log.WithField("ID", mention.PlatformID).Warn("Mention missing media; was media deleted?")
+		r.recordFailure(ctx, mention, errors.New("mention has no media"), true)
+		return
+	}
+	analyses, err := r.getAnalyses(ctx, mention, fetched)
+	var apiError *truemedia.APIError
+	if errors.Is(err, truemedia.ErrRateLimited) && errors.As(err, &apiError) {
+		// Not the mention's fault, so this doesn't count against it
+		retryAt := time.Now().Add(max(apiError.RetryAfter, failureBackoff))
+		log.WithField("id", mention.ID).Warnf("TrueMedia rate limited until %s: %v", retryAt, err)
+		if err := r.db.PostponeMention(ctx, mention.ID, retryAt); err != nil {
+			log.WithField("id", mention.ID).Errorf("error postponing mention: %v", err)
+		}
+		return
+	}
+	if err != nil {
+		log.Errorf("error getting analysis: %v", err)
+		r.recordFailure(ctx, mention, fmt.Errorf("error getting analysis: %w", err), false)
+		return
+	}
+	switch combinedState(analyses) {
+	case truemedia.AnalysisStateComplete:
+		log.Infof("analysis complete for %s, responding to %s post ID=%s", mention.MediaID, mention.Platform, mention.PlatformID)
+		err := r.respondToPostWithAnalysis(ctx, mention, analyses...)
+		if err != nil {
+			r.handleAPIError(ctx, mention, err, db.ReplyTypeFinal)
+		}
+	case truemedia.AnalysisStateProcessing:
+		log.WithField("mediaIds", mention.MediaIDs).Infof("%s still processing, continuing...", mention.MediaID)
+		if mention.State != db.MentionStateAnalyzing {
+			if err := r.db.MarkMentionAnalyzing(ctx, mention.ID); err != nil {
+				log.WithField("id", mention.ID).Warnf("error updating mention state: %v", err)
+			}
+		}
+		// If the Media stays in "Processing" for too long, respond with a link to the incomplete analysis.
+		// The mention stays queued so the verdict can follow once the analysis completes, unless it never does.
+		if time.Since(mention.Enqueued) > maximumAnalysisAge {
+			r.recordFailure(ctx, mention, fmt.Errorf("analysis still processing after %s", maximumAnalysisAge), true)
+			return
+		}
+		if time.Since(mention.Enqueued) > maximumProcessingDelay {
+			log.WithField("mediaId", mention.MediaID).WithField("enqueued", mention.Enqueued).Warnf("analysis taking too long, responding anyway")
+			err := r.respondToPostWithAnalysis(ctx, mention, analyses...)
+			if err != nil {
+				r.handleAPIError(ctx, mention, err, db.ReplyTypeTimedOut)
+				return
+			}
+		} else {
+			// Let the user know the bot is on it while they wait
+			err := r.acknowledgeMention(ctx, mention)
+			if err != nil {
+				r.handleAPIError(ctx, mention, err, db.ReplyTypeProcessing)
+				return
+			}
+		}
+		r.scheduleNextPoll(ctx, mention)
+	case truemedia.AnalysisStateError:
+		failure := &truemedia.FailureError{Reason: truemedia.FailureReasonUnknown}
+		for i, analysis := range analyses {
+			analysisFailure := analysis.Failure()
+			if analysisFailure == nil {
+				continue
 			}
+			log.Errorf("errors analyzing media %v: %v", mention.MediaIDs[i], analysis.Errors)
+			failure.Messages = append(failure.Messages, analysisFailure.Messages...)
+			if failure.Reason == truemedia.FailureReasonUnknown {
+				failure.Reason = analysisFailure.Reason
+			}
+		}
+		// Unsupported, private or overlong media won't analyze any better next time
+		r.recordFailure(ctx, mention, failure, failure.Reason != truemedia.FailureReasonUnknown)
+	}
+}
+
+/*
+Counts a failed attempt at a mention, so it's tried again after a backoff rather than on every pass.
+After maxMentionAttempts, or straight away if the failure is permanent, the mention is abandoned and the
+user is told the media couldn't be analyzed.
+*/
+func (r *Responder) recordFailure(ctx context.Context, mention model.Mention, cause error, permanent bool) {
+	tracing.RecordError(ctx, cause)
+	attempts := mention.Attempts + 1
+	abandon := permanent || attempts >= maxMentionAttempts
+	backoff := min(failureBackoff<<(attempts-1), maxFailureBackoff)
+	if abandon {
+		if err := r.replyWithError(ctx, mention, cause); err != nil {
+			metrics.ReplyFailures.WithLabelValues(string(mention.Platform), string(db.ReplyTypeError), r.platform.ClassifyError(err).Kind.String()).Inc()
+			log.WithField("id", mention.ID).Errorf("error posting error reply: %v", err)
+		}
+	}
+	if err := r.db.RecordMentionFailure(ctx, mention.ID, cause.Error(), abandon, time.Now().Add(backoff)); err != nil {
+		log.WithField("id", mention.ID).Errorf("error recording mention failure: %v", err)
+		return
+	}
+	if abandon {
+		log.WithField("id", mention.ID).WithField("attempts", attempts).Errorf("abandoning %s mention ID=%s: %v", mention.Platform, mention.PlatformID, cause)
+	} else {
+		log.WithField("id", mention.ID).WithField("attempts", attempts).Warnf("%s mention ID=%s failed, trying again in %s", mention.Platform, mention.PlatformID, backoff)
+	}
+}
+
+// Counts a posted reply, and for FINAL replies how long the user waited for it
+func recordReplyPosted(mention model.Mention, replyType db.ReplyType) {
+	metrics.RepliesPosted.WithLabelValues(string(mention.Platform), string(replyType)).Inc()
+	if replyType == db.ReplyTypeFinal {
+		metrics.MentionReplySeconds.WithLabelValues(string(mention.Platform)).Observe(time.Since(mention.Enqueued).Seconds())
+	}
+}
 
-			for _, mention := range mentions {
-				if mention.MediaID == "" {
-					// TODO: pop it from the list for next time, the media must've been deleted in the DB
-					log.WithField("ID", mention.PlatformID).Warn("Mention missing media; was media deleted?")
-					continue
-				}
-				analysis, err := r.truemediaService.GetAnalysis(mention.MediaID)
-				if err != nil {
-					log.Errorf("error getting analysis: %v", err)
-					continue
-				}
-				switch analysis.State {
-				case truemedia.AnalysisStateComplete:
-					log.Infof("analysis complete for %s, responding to %s post ID=%s", mention.MediaID, mention.Platform, mention.PlatformID)
-					err := r.respondToPostWithAnalysis(ctx, mention, *analysis)
-					if err != nil {
-						var apiError *twitter.ErrorResponse
-						if errors.As(err, &apiError) {
-							r.handleAPIError(ctx, mention, *apiError)
-						} else {
-							log.Errorf("error responding to post: %v", err)
-						}
-					}
-				case truemedia.AnalysisStateProcessing:
-					log.WithField("verdict", analysis.Verdict).Infof("%s still processing, continuing...", mention.MediaID)
-					// If the Media stays in "Processing" for too long, respond with a link to the incomplete analysis
-					if time.Since(mention.Enqueued) > maximumProcessingDelay {
-						log.WithField("mediaId", mention.MediaID).WithField("enqueued", mention.Enqueued).Warnf("analysis taking too long, responding anyway")
-						err := r.respondToPostWithAnalysis(ctx, mention, *analysis)
-						if err != nil {
-							var apiError *twitter.ErrorResponse
-							if errors.As(err, &apiError) {
-								r.handleAPIError(ctx, mention, *apiError)
-							} else {
-								log.Errorf("error responding to post: %v", err)
-							}
-						}
-					}
-				case truemedia.AnalysisStateError:
-					log.Errorf("errors analyzing media %v: %v", mention.MediaID, analysis.Errors)
-				}
+// Posts an interim reply saying the media is being analyzed, unless one was already posted for this mention
+func (r *Responder) acknowledgeMention(ctx context.Context, mention model.Mention) error {
+	replies, err := r.db.FindRepliesForMention(ctx, mention.ID)
+	if err != nil {
+		return err
+	}
+	if findReply(replies, db.ReplyTypeProcessing) != nil {
+		return nil
+	}
+
+	replyID, err := r.replyToMediaPost(ctx, mention, r.generateProcessingContent(mention), nil)
+	if err != nil {
+		return err
+	}
+
+	recordReplyPosted(mention, db.ReplyTypeProcessing)
+	err = r.db.AddReply(ctx, mention.ID, mention.Platform, replyID, db.ReplyTypeProcessing)
+	if err != nil {
+		log.Warnf("Processing reply %s posted to %s but wasn't recorded in the database", replyID, mention.Platform)
+		return err
+	}
+	return nil
+}
+
+/*
+Tells the user the mention's media couldn't be analyzed, and why if cause is a *truemedia.FailureError.
+Links the analysis page if there's an analysis to link, and otherwise suggests uploading the media directly.
+Posted at most once per mention, and never after a FINAL reply.
+*/
+func (r *Responder) replyWithError(ctx context.Context, mention model.Mention, cause error) error {
+	replies, err := r.db.FindRepliesForMention(ctx, mention.ID)
+	if err != nil {
+		return err
+	}
+	if findReply(replies, db.ReplyTypeError) != nil || findReply(replies, db.ReplyTypeFinal) != nil {
+		return nil
+	}
+	responseContent := r.generateErrorContent(mention, cause)
+	if responseContent == "" {
+		return fmt.Errorf("failed to generate error response for mention %s", mention.ID)
+	}
+
+	replyID, err := r.deliverReply(ctx, mention, replies, responseContent, nil)
+	if err != nil {
+		return err
+	}
+	recordReplyPosted(mention, db.ReplyTypeError)
+	err = r.db.AddReply(ctx, mention.ID, mention.Platform, replyID, db.ReplyTypeError)
+	if err != nil {
+		log.Warnf("Error reply %s posted to %s but wasn't recorded in the database", replyID, mention.Platform)
+		return err
+	}
+	return nil
+}
+
+/*
+Gets the analysis of every media item in the mention's post, in the same order as mention.MediaIDs.
+Analyses in fetched are reused rather than asked for again, and new ones are added to it.
+*/
+func (r *Responder) getAnalyses(ctx context.Context, mention model.Mention, fetched map[string]truemedia.GetResultResponse) ([]truemedia.GetResultResponse, error) {
+	analyses := make([]truemedia.GetResultResponse, 0, len(mention.MediaIDs))
+	for _, mediaID := range mention.MediaIDs {
+		analysis, ok := fetched[mediaID]
+		if !ok {
+			result, err := r.truemediaService.GetAnalysis(ctx, mediaID)
+			if err != nil {
+				return nil, err
 			}
+			analysis = *result
+			fetched[mediaID] = analysis
+			metrics.AnalysesChecked.WithLabelValues(string(mention.Platform), string(analysis.State), string(analysis.Verdict)).Inc()
 		}
+		analyses = append(analyses, analysis)
 	}
+	return analyses, nil
 }
 
-func (r *Responder) respondToPostWithAnalysis(ctx context.Context, mention model.Mention, analysis truemedia.GetResultResponse) error {
-	responseContent := generateResponseContent(mention, analysis)
+// Logs which detectors contributed to each analysis a reply is about, and which were still running
+func logBreakdown(mention model.Mention, replyType db.ReplyType, analyses []truemedia.GetResultResponse) {
+	for i, analysis := range analyses {
+		mediaID := mention.MediaID
+		if i < len(mention.MediaIDs) {
+			mediaID = mention.MediaIDs[i]
+		}
+		log.WithField("mediaId", mediaID).
+			WithField("replyType", replyType).
+			WithField("scores", analysis.ModelScores()).
+			WithField("pending", analysis.Pending).
+			Info("analysis breakdown")
+	}
+}
+
+/*
+Replies with the analysis results, given one analysis per media item in the same order as mention.MediaIDs.
+If the analyses are complete this is the FINAL reply; otherwise it's a TIMED_OUT reply pointing to the
+results page, posted at most once per mention.
+*/
+func (r *Responder) respondToPostWithAnalysis(ctx context.Context, mention model.Mention, analyses ...truemedia.GetResultResponse) error {
+	responseContent := r.generateResponseContent(mention, analyses...)
 	if responseContent == "" {
-		return fmt.Errorf("failed to generate response for media %s with rank %s", mention.MediaID, analysis.Verdict)
+		return fmt.Errorf("failed to generate response for media %s with state %s", mention.MediaID, combinedState(analyses))
 	}
 
-	// Reply to the Media message
-	parentPostURL, err := r.db.GetMediaPostUrl(ctx, mention.MediaID)
+	replies, err := r.db.FindRepliesForMention(ctx, mention.ID)
 	if err != nil {
 		return err
 	}
 
-	_, replyToID, err := twitterutil.DeconstructTweetURL(parentPostURL)
+	replyType := db.ReplyTypeFinal
+	if combinedState(analyses) != truemedia.AnalysisStateComplete {
+		replyType = db.ReplyTypeTimedOut
+	}
+	logBreakdown(mention, replyType, analyses)
+	timedOutReply := findReply(replies, db.ReplyTypeTimedOut)
+	if replyType == db.ReplyTypeTimedOut && timedOutReply != nil {
+		// The user already knows it's taking a while
+		return nil
+	}
+
+	var cardImage *platform.Image
+	if replyType == db.ReplyTypeFinal {
+		cardImage = r.renderVerdictCard(ctx, mention, analyses)
+	}
+
+	replyID, err := r.deliverReply(ctx, mention, replies, responseContent, cardImage)
 	if err != nil {
 		return err
 	}
+	recordReplyPosted(mention, replyType)
 
+	err = r.db.AddReply(ctx, mention.ID, mention.Platform, replyID, replyType)
+	if err != nil {
+		log.Warnf("Reply %s posted to %s but wasn't recorded in the database", replyID, mention.Platform)
+		return err
+	}
+	return nil
+}
+
+/*
+Posts a reply where the user will see it, given the bot's earlier replies to the mention. A TIMED_OUT reply
+gets a new reply threaded under it, a PROCESSING reply is edited or threaded under, and otherwise, or if the
+earlier reply is gone or only a placeholder, the media post is replied to. Returns the platform ID of the reply.
+*/
+func (r *Responder) deliverReply(ctx context.Context, mention model.Mention, replies []model.Reply, responseContent string, cardImage *platform.Image) (string, error) {
 	var replyID string
+	var err error
+	var earlierReply *model.Reply
+	timedOutReply := findPostedReply(replies, db.ReplyTypeTimedOut)
+	if timedOutReply != nil {
+		// The user may have stopped watching the thread by now, so post a new reply they'll be notified of
+		earlierReply = timedOutReply
+		replyID, err = r.followUpEarlierReply(ctx, mention, *timedOutReply, responseContent, cardImage, false)
+	} else if interimReply := findPostedReply(replies, db.ReplyTypeProcessing); interimReply != nil {
+		earlierReply = interimReply
+		replyID, err = r.followUpEarlierReply(ctx, mention, *interimReply, responseContent, cardImage, true)
+	}
+	if earlierReply != nil && err != nil {
+		if r.platform.ClassifyError(err).Kind != platform.APIErrorKindPostDeleted {
+			return "", err
+		}
+		// The earlier reply is gone, so fall back to replying to the media post
+		log.WithField("id", mention.ID).WithField("earlierReplyID", earlierReply.PlatformID).Warn("Earlier reply not found, replying to post instead")
+		earlierReply = nil
+	}
+	if earlierReply == nil {
+		return r.replyToMediaPost(ctx, mention, responseContent, cardImage)
+	}
+	return replyID, nil
+}
+
+// Replies to the post carrying the mention's media, attaching the image if there is one and the platform
+// supports it, and returns the platform ID of the reply
+func (r *Responder) replyToMediaPost(ctx context.Context, mention model.Mention, responseContent string, image *platform.Image) (replyID string, err error) {
+	ctx, span := tracing.Start(ctx, "post reply", tracing.AttributePlatform.String(string(mention.Platform)))
+	defer func() {
+		if err != nil {
+			tracing.RecordError(ctx, err)
+		}
+		span.End()
+	}()
+	// Mentions whose media couldn't be resolved have no media to look the post up by
+	parentPostURL := mention.MediaPostURL
+	if mention.MediaID != "" {
+		parentPostURL, err = r.db.GetMediaPostUrl(ctx, mention.MediaID)
+		if err != nil {
+			return "", err
+		}
+	}
+	if parentPostURL == "" {
+		return "", fmt.Errorf("no post to reply to for mention %s", mention.ID)
+	}
+
 	if r.testModeEnabled {
 		replyID = cuid.New()
-		log.WithField("replyToID", replyToID).WithField("responseContent", responseContent).Infof("Simulating reply to %s with post ID %s", mention.Platform, replyID)
-	} else {
-		resp, err := r.twitterService.TweetResponse(ctx, replyToID, responseContent)
+		log.WithField("parentPostURL", parentPostURL).WithField("responseContent", responseContent).Infof("Simulating reply to %s with post ID %s", mention.Platform, replyID)
+		return replyID, nil
+	}
+	if imageReplier, ok := r.platform.(platform.ImageReplier); ok && image != nil {
+		return imageReplier.PostReplyWithImage(ctx, parentPostURL, responseContent, *image)
+	}
+	return r.platform.PostReply(ctx, parentPostURL, responseContent)
+}
+
+/*
+Delivers new content for a mention that already has a reply from the bot.
+If allowEdit is set, the earlier reply is edited in place where the platform allows it; otherwise the
+content is threaded underneath it, with the image attached if there is one. Edits keep the earlier
+reply's attachments, so the image is dropped in that case. Returns the platform ID of the reply holding
+the new content.
+*/
+func (r *Responder) followUpEarlierReply(ctx context.Context, mention model.Mention, earlierReply model.Reply, responseContent string, image *platform.Image, allowEdit bool) (replyID string, err error) {
+	ctx, span := tracing.Start(ctx, "follow up reply", tracing.AttributePlatform.String(string(mention.Platform)), tracing.AttributeReplyType.String(string(earlierReply.Type)))
+	defer func() {
 		if err != nil {
-			return err
+			tracing.RecordError(ctx, err)
 		}
-		replyID = resp.Tweet.ID
+		span.End()
+	}()
+	editor, canEdit := r.platform.(platform.ReplyEditor)
+	canEdit = canEdit && allowEdit
+	if r.testModeEnabled {
+		replyID = cuid.New()
+		if canEdit {
+			replyID = earlierReply.PlatformID
+		}
+		log.WithField("earlierReplyID", earlierReply.PlatformID).WithField("canEdit", canEdit).WithField("responseContent", responseContent).Infof("Simulating follow-up to %s with post ID %s", mention.Platform, replyID)
+		return replyID, nil
+	}
+	if canEdit {
+		if err := editor.EditReply(ctx, earlierReply.PlatformID, responseContent); err != nil {
+			return "", err
+		}
+		return earlierReply.PlatformID, nil
+	}
+	if imageReplier, ok := r.platform.(platform.ImageReplier); ok && image != nil {
+		return imageReplier.PostThreadedReplyWithImage(ctx, earlierReply.PlatformID, responseContent, *image)
 	}
+	return r.platform.PostThreadedReply(ctx, earlierReply.PlatformID, responseContent)
+}
 
-	err = r.db.AddReply(ctx, mention.ID, mention.Platform, replyID, db.ReplyTypeFinal)
-	if err != nil {
-		log.Warnf("Reply %s posted to %s but wasn't recorded in the database", replyID, model.PlatformX)
-		return err
+/*
+How long to leave a mention whose analysis is still processing before checking on it again, or 0 to check
+on every pass. Mentions that have waited past maximumProcessingDelay are only checked every
+timedOutPollInterval, so long-running analyses don't keep hitting the TrueMedia API every few seconds.
+When TrueMedia calls back as analyses finish, polling is only a safety net, so newer mentions are
+checked every callbackPollInterval instead.
+*/
+func (r *Responder) pollInterval(mention model.Mention) time.Duration {
+	if time.Since(mention.Enqueued) > maximumProcessingDelay {
+		return timedOutPollInterval
 	}
-	return nil
+	if r.truemediaService.CallbacksEnabled() {
+		return callbackPollInterval
+	}
+	return 0
 }
 
-func (r *Responder) handleAPIError(ctx context.Context, mention model.Mention, apiError twitter.ErrorResponse) {
-	if apiError.Detail == deletedPostErrorMsg {
+/*
+Holds off on a mention that's still processing until its next check is due. The schedule is kept in the
+database rather than in memory, so it survives restarts and every replica sees it.
+*/
+func (r *Responder) scheduleNextPoll(ctx context.Context, mention model.Mention) {
+	interval := r.pollInterval(mention)
+	if interval == 0 {
+		return
+	}
+	if err := r.db.PostponeMention(ctx, mention.ID, time.Now().Add(interval)); err != nil {
+		log.WithField("id", mention.ID).Errorf("error scheduling next check on mention: %v", err)
+	}
+}
+
+func (r *Responder) handleAPIError(ctx context.Context, mention model.Mention, err error, replyType db.ReplyType) {
+	apiError := r.platform.ClassifyError(err)
+	metrics.ReplyFailures.WithLabelValues(string(mention.Platform), string(replyType), apiError.Kind.String()).Inc()
+	switch apiError.Kind {
+	case platform.APIErrorKindPostDeleted:
 		// The post with the media is deleted--there's nothing to
 		// reply to, so delete the mention from the queue.
 		err := r.db.DeleteMention(ctx, mention.ID)
@@ -173,50 +582,257 @@ func (r *Responder) handleAPIError(ctx context.Context, mention model.Mention, a
 		} else {
 			log.WithField("id", mention.ID).WithField("mediaId", mention.MediaID).Warn("Deleted post detected. Removing mention from database.")
 		}
-	} else if apiError.Detail == duplicatePostErrorMsg {
-		// There's already a reply, but it isn't recorded in the database.
-		// Add a record with a fake ID so the bot doesn't get hung up on this.
-		err := r.db.AddReply(ctx, mention.ID, mention.Platform, cuid.New(), db.ReplyTypeFinal)
+	case platform.APIErrorKindDuplicateReply:
+		// There's already a reply, but it isn't recorded in the database, e.g. the user mentioned the bot twice
+		// on the same post. Add a placeholder so the bot doesn't get hung up on this; later replies go to the
+		// media post rather than under it, since its ID isn't known.
+		err := r.db.AddPlaceholderReply(ctx, mention.ID, mention.Platform, replyType)
 		if err != nil {
 			log.WithField("id", mention.ID).WithField("mediaId", mention.MediaID).Errorf("Error inserting missing reply record: %v", err.Error())
 		} else {
 			log.WithField("id", mention.ID).WithField("mediaId", mention.MediaID).Warn("Missing Reply record detected. Adding a new record.")
 		}
-	} else {
-		log.WithField("statusCode", apiError.StatusCode).WithField("title", apiError.Title).Errorf("API error responding to post: %v", apiError.Detail)
+	case platform.APIErrorKindRateLimited:
+		// Not the mention's fault, so this doesn't count against it
+		log.WithField("platform", mention.Platform).WithField("id", mention.ID).Warnf("rate limited until %s: %v", apiError.RetryAt, apiError.Detail)
+		if err := r.db.PostponeMention(ctx, mention.ID, apiError.RetryAt); err != nil {
+			log.WithField("id", mention.ID).Errorf("error postponing mention: %v", err)
+		}
+	default:
+		log.WithField("platform", mention.Platform).WithField("id", mention.ID).Errorf("error responding to post: %v", apiError.Detail)
+		if replyType == db.ReplyTypeProcessing {
+			// The PROCESSING reply is only a courtesy, so failing to post it isn't held against the mention,
+			// but it's not tried again on every pass either
+			if err := r.db.PostponeMention(ctx, mention.ID, time.Now().Add(failureBackoff)); err != nil {
+				log.WithField("id", mention.ID).Errorf("error postponing mention: %v", err)
+			}
+			return
+		}
+		r.recordFailure(ctx, mention, err, false)
 	}
 }
 
-func generateResponseContent(mention model.Mention, analysis truemedia.GetResultResponse) string {
-	var verdictMsg string
-	if analysis.State == truemedia.AnalysisStateComplete {
-		verdictMsg = describeVerdict(analysis.Verdict)
-	} else if analysis.State == truemedia.AnalysisStateProcessing {
-		verdictMsg = unknownVerdictMsg
+/*
+Builds the reply for a mention, given one analysis per media item in the same order as mention.MediaIDs.
+The worst verdict drives the headline and which analysis is linked. Posts with several media items get
+a summary of how many share that verdict. Once the analysis is complete, the mention's command picks
+what goes with the verdict. Returns "" if there's no verdict to report.
+*/
+func (r *Responder) generateResponseContent(mention model.Mention, analyses ...truemedia.GetResultResponse) string {
+	var templateName string
+	data := messages.Data{
+		UserName:   mention.PlatformUserName,
+		ResultsURL: r.generateResultsURL(mention.MediaID),
 	}
-	if verdictMsg == "" {
-		// we didn't get a low/uncertain/high
-		// TODO: something-went-wrong response
+	switch combinedState(analyses) {
+	case truemedia.AnalysisStateComplete:
+		worst := worstAnalysis(analyses)
+		if worst < len(mention.MediaIDs) {
+			data.ResultsURL = r.generateResultsURL(mention.MediaIDs[worst])
+		}
+		data.Verdict = verdictName(analyses[worst].Verdict)
+		if data.Verdict == "" {
+			break
+		}
+		switch mention.Command {
+		case model.CommandDetails:
+			templateName = messages.TemplateDetails
+			data.Scores = detailScores(analyses[worst])
+			data.Pending = analyses[worst].Pending
+		case model.CommandExplain:
+			templateName = messages.TemplateExplain
+		default:
+			templateName = verdictTemplate(analyses[worst].Verdict)
+			data.Matching, data.Total = summarizeVerdicts(analyses)
+		}
+	case truemedia.AnalysisStateProcessing:
+		templateName = messages.TemplateTimedOut
+	}
+	if templateName == "" {
+		// we didn't get a low/uncertain/high; the mention is retried, then gets an error reply
 		return ""
 	}
-	userMention := fmt.Sprintf(userThankMsg, mention.PlatformUserName)
-	return fmt.Sprintf("%s\n%s\n\n%s\n\n%s", verdictMsg, generateResultsURL(mention.MediaID), userMention, trueMediaTagline)
+	return r.render(mention, templateName, data)
 }
 
-func generateResultsURL(mediaID string) string {
-	return fmt.Sprintf("https://OPEN-TODO-PLACEHOLDER/media/analysis?id=%s", mediaID)
+func (r *Responder) generateProcessingContent(mention model.Mention) string {
+	// The results URL keeps this unique per media. A user mentioning the bot again on the same post gets the
+	// same text, which platforms may reject as a duplicate; handleAPIError records a placeholder for that.
+	return r.render(mention, messages.TemplateProcessing, messages.Data{
+		UserName:   mention.PlatformUserName,
+		ResultsURL: r.generateResultsURL(mention.MediaID),
+	})
+}
+
+// Builds the reply saying a mention's media couldn't be analyzed
+func (r *Responder) generateErrorContent(mention model.Mention, cause error) string {
+	data := messages.Data{
+		UserName:  mention.PlatformUserName,
+		UploadURL: r.generateUploadURL(),
+		Failure:   failureName(cause),
+	}
+	if mention.MediaID != "" {
+		data.ResultsURL = r.generateResultsURL(mention.MediaID)
+	}
+	return r.render(mention, messages.TemplateError, data)
+}
+
+// Renders a reply in the mention's language. Templates are validated at startup, so this only fails on
+// a bad override; the failure is logged and "" returned.
+func (r *Responder) render(mention model.Mention, templateName string, data messages.Data) string {
+	content, err := r.messages.Render(mention.Language, templateName, data)
+	if err != nil {
+		log.WithField("template", templateName).WithField("language", mention.Language).Errorf("error rendering reply: %v", err)
+		return ""
+	}
+	return content
 }
 
-func describeVerdict(verdict truemedia.Verdict) string {
+func (r *Responder) generateResultsURL(mediaID string) string {
+	resultsURL := r.resultsURL
+	query := resultsURL.Query()
+	query.Set("id", mediaID)
+	resultsURL.RawQuery = query.Encode()
+	return resultsURL.String()
+}
+
+// The home page of the site the results are on, where users can upload media themselves
+func (r *Responder) generateUploadURL() string {
+	uploadURL := url.URL{Scheme: r.resultsURL.Scheme, Host: r.resultsURL.Host}
+	return uploadURL.String()
+}
+
+/*
+Rolls the state of several analyses up into one. Anything still processing means the post is still
+processing; otherwise it's complete if any item completed, since items that failed can be left out.
+*/
+func combinedState(analyses []truemedia.GetResultResponse) truemedia.AnalysisState {
+	state := truemedia.AnalysisStateError
+	for _, analysis := range analyses {
+		switch analysis.State {
+		case truemedia.AnalysisStateProcessing:
+			return truemedia.AnalysisStateProcessing
+		case truemedia.AnalysisStateComplete:
+			state = truemedia.AnalysisStateComplete
+		}
+	}
+	return state
+}
+
+// Finds the index of the completed analysis with the most evidence of manipulation
+func worstAnalysis(analyses []truemedia.GetResultResponse) int {
+	worst := 0
+	for i, analysis := range analyses {
+		if analysis.State != truemedia.AnalysisStateComplete {
+			continue
+		}
+		if analyses[worst].State != truemedia.AnalysisStateComplete || verdictSeverity(analysis.Verdict) > verdictSeverity(analyses[worst].Verdict) {
+			worst = i
+		}
+	}
+	return worst
+}
+
+/*
+Counts how many completed items share the worst verdict, out of how many completed.
+Both are zero unless more than one item completed, since there's nothing to summarize.
+*/
+func summarizeVerdicts(analyses []truemedia.GetResultResponse) (matching int, total int) {
+	var completed []truemedia.GetResultResponse
+	for _, analysis := range analyses {
+		if analysis.State == truemedia.AnalysisStateComplete {
+			completed = append(completed, analysis)
+		}
+	}
+	if len(completed) < 2 {
+		return 0, 0
+	}
+	worstSeverity := verdictSeverity(completed[worstAnalysis(completed)].Verdict)
+	for _, analysis := range completed {
+		if verdictSeverity(analysis.Verdict) == worstSeverity {
+			matching++
+		}
+	}
+	return matching, len(completed)
+}
+
+// Ranks verdicts by how much evidence of manipulation they represent
+func verdictSeverity(verdict truemedia.Verdict) int {
+	switch verdict {
+	case truemedia.VerdictHigh:
+		return 3
+	case truemedia.VerdictUncertain:
+		return 2
+	case truemedia.VerdictLow, truemedia.VerdictTrusted:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Finds the first reply of the given type that hasn't been superseded, or nil if there isn't one
+func findReply(replies []model.Reply, replyType db.ReplyType) *model.Reply {
+	for i := range replies {
+		if replies[i].Type == replyType && !replies[i].Superseded {
+			return &replies[i]
+		}
+	}
+	return nil
+}
+
+// Finds the first reply of the given type whose platform ID is known, so it can be followed up, or nil if there isn't one
+func findPostedReply(replies []model.Reply, replyType db.ReplyType) *model.Reply {
+	for i := range replies {
+		if replies[i].Type == replyType && !replies[i].Placeholder && !replies[i].Superseded {
+			return &replies[i]
+		}
+	}
+	return nil
+}
+
+// Names a verdict the way reply templates expect, or "" if there's no verdict
+func verdictName(verdict truemedia.Verdict) string {
+	switch verdict {
+	case truemedia.VerdictTrusted, truemedia.VerdictLow:
+		return messages.VerdictLow
+	case truemedia.VerdictUncertain:
+		return messages.VerdictUncertain
+	case truemedia.VerdictHigh:
+		return messages.VerdictHigh
+	default:
+		return ""
+	}
+}
+
+// Picks the reply template for a verdict, or "" if there isn't one
+func verdictTemplate(verdict truemedia.Verdict) string {
 	switch verdict {
 	case truemedia.VerdictTrusted:
 		fallthrough
 	case truemedia.VerdictLow:
-		return lowVerdictMsg
+		return messages.TemplateFinalLow
 	case truemedia.VerdictUncertain:
-		return uncertainVerdictMsg
+		return messages.TemplateFinalUncertain
 	case truemedia.VerdictHigh:
-		return highVerdictMsg
+		return messages.TemplateFinalHigh
+	default:
+		return ""
+	}
+}
+
+// Names the reason media couldn't be analyzed the way reply templates expect, or "" if the reason isn't known
+func failureName(cause error) string {
+	var failure *truemedia.FailureError
+	if !errors.As(cause, &failure) {
+		return ""
+	}
+	switch failure.Reason {
+	case truemedia.FailureReasonUnsupportedMedia:
+		return messages.FailureUnsupportedMedia
+	case truemedia.FailureReasonPrivateAccount:
+		return messages.FailurePrivateAccount
+	case truemedia.FailureReasonTooLong:
+		return messages.FailureTooLong
 	default:
 		return ""
 	}
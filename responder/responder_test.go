@@ -2,13 +2,18 @@ package responder
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/url"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
-	"github.com/g8rswimmer/go-twitter/v2"
 	"github.com/truemediaorg/socialbot/database/db"
+	"github.com/truemediaorg/socialbot/messages"
 	"github.com/truemediaorg/socialbot/model"
+	"github.com/truemediaorg/socialbot/platform"
 	"github.com/truemediaorg/socialbot/truemedia"
 
 	"github.com/stretchr/testify/assert"
@@ -19,18 +24,33 @@ type MockReplyHandler struct {
 	mock.Mock
 }
 
-func (m *MockReplyHandler) GetMentionsNeedingRepliesForPlatform(ctx context.Context, platform model.Platform) ([]model.Mention, error) {
-	args := m.Called(ctx, platform)
+func (m *MockReplyHandler) ClaimMentionsNeedingReplies(ctx context.Context, platform model.Platform, workerID string, leaseDuration time.Duration, limit int) ([]model.Mention, error) {
+	args := m.Called(ctx, platform, workerID, leaseDuration, limit)
 	return args.Get(0).([]model.Mention), args.Error(1)
 }
 
+func (m *MockReplyHandler) ClaimMentionsForMedia(ctx context.Context, platform model.Platform, workerID string, leaseDuration time.Duration, mediaID string) ([]model.Mention, error) {
+	args := m.Called(ctx, platform, workerID, leaseDuration, mediaID)
+	return args.Get(0).([]model.Mention), args.Error(1)
+}
+
+func (m *MockReplyHandler) ReleaseMentions(ctx context.Context, platform model.Platform, workerID string) error {
+	args := m.Called(ctx, platform, workerID)
+	return args.Error(0)
+}
+
 func (m *MockReplyHandler) DeleteMention(ctx context.Context, mentionID string) error {
 	args := m.Called(ctx, mentionID)
 	return args.Error(0)
 }
 
 func (m *MockReplyHandler) AddReply(ctx context.Context, mentionID string, platform model.Platform, platformID string, replyType db.ReplyType) error {
-	args := m.Called(ctx, mentionID, platform, platformID)
+	args := m.Called(ctx, mentionID, platform, platformID, replyType)
+	return args.Error(0)
+}
+
+func (m *MockReplyHandler) AddPlaceholderReply(ctx context.Context, mentionID string, platform model.Platform, replyType db.ReplyType) error {
+	args := m.Called(ctx, mentionID, platform, replyType)
 	return args.Error(0)
 }
 
@@ -44,25 +64,203 @@ func (m *MockReplyHandler) GetMediaPostUrl(ctx context.Context, mediaID string)
 	return args.Get(0).(string), args.Error(1)
 }
 
-type MockTweetResponder struct {
+func (m *MockReplyHandler) MarkMentionAnalyzing(ctx context.Context, mentionID string) error {
+	args := m.Called(ctx, mentionID)
+	return args.Error(0)
+}
+
+func (m *MockReplyHandler) RecordMentionFailure(ctx context.Context, mentionID string, lastError string, abandon bool, nextAttempt time.Time) error {
+	args := m.Called(ctx, mentionID, lastError, abandon, nextAttempt)
+	return args.Error(0)
+}
+
+func (m *MockReplyHandler) PostponeMention(ctx context.Context, mentionID string, until time.Time) error {
+	args := m.Called(ctx, mentionID, until)
+	return args.Error(0)
+}
+
+// A mention queue kept in memory, which claims mentions the way the database does, apart from leases
+type fakeMentionQueue struct {
+	mentions []*model.Mention
+	replies  map[string][]model.Reply
+}
+
+func (q *fakeMentionQueue) ClaimMentionsNeedingReplies(ctx context.Context, platform model.Platform, workerID string, leaseDuration time.Duration, limit int) ([]model.Mention, error) {
+	due := func(mention *model.Mention) time.Time {
+		if mention.NextAttemptAt != nil {
+			return *mention.NextAttemptAt
+		}
+		return mention.Enqueued
+	}
+	var claimed []model.Mention
+	for _, mention := range q.mentions {
+		waiting := mention.State == db.MentionStateQueued || mention.State == db.MentionStateAnalyzing || mention.State == db.MentionStateFailed
+		if waiting && !due(mention).After(time.Now()) {
+			claimed = append(claimed, *mention)
+		}
+	}
+	slices.SortStableFunc(claimed, func(a model.Mention, b model.Mention) int { return due(&a).Compare(due(&b)) })
+	return claimed[:min(limit, len(claimed))], nil
+}
+
+func (q *fakeMentionQueue) ClaimMentionsForMedia(ctx context.Context, platform model.Platform, workerID string, leaseDuration time.Duration, mediaID string) ([]model.Mention, error) {
+	return nil, nil
+}
+
+func (q *fakeMentionQueue) ReleaseMentions(ctx context.Context, platform model.Platform, workerID string) error {
+	return nil
+}
+
+func (q *fakeMentionQueue) find(mentionID string) *model.Mention {
+	for _, mention := range q.mentions {
+		if mention.ID == mentionID {
+			return mention
+		}
+	}
+	return nil
+}
+
+func (q *fakeMentionQueue) DeleteMention(ctx context.Context, mentionID string) error {
+	q.mentions = slices.DeleteFunc(q.mentions, func(mention *model.Mention) bool { return mention.ID == mentionID })
+	return nil
+}
+
+func (q *fakeMentionQueue) AddReply(ctx context.Context, mentionID string, platform model.Platform, platformID string, replyType db.ReplyType) error {
+	q.replies[mentionID] = append(q.replies[mentionID], model.Reply{MentionID: mentionID, Platform: platform, PlatformID: platformID, Type: replyType})
+	if replyType == db.ReplyTypeFinal {
+		mention := q.find(mentionID)
+		mention.State = db.MentionStateReplied
+		mention.NextAttemptAt = nil
+	}
+	return nil
+}
+
+func (q *fakeMentionQueue) AddPlaceholderReply(ctx context.Context, mentionID string, platform model.Platform, replyType db.ReplyType) error {
+	return q.AddReply(ctx, mentionID, platform, "placeholder", replyType)
+}
+
+func (q *fakeMentionQueue) FindRepliesForMention(ctx context.Context, mentionID string) ([]model.Reply, error) {
+	return q.replies[mentionID], nil
+}
+
+func (q *fakeMentionQueue) GetMediaPostUrl(ctx context.Context, mediaID string) (string, error) {
+	return "https://twitter.com/Foo/status/" + mediaID, nil
+}
+
+func (q *fakeMentionQueue) MarkMentionAnalyzing(ctx context.Context, mentionID string) error {
+	q.find(mentionID).State = db.MentionStateAnalyzing
+	return nil
+}
+
+func (q *fakeMentionQueue) RecordMentionFailure(ctx context.Context, mentionID string, lastError string, abandon bool, nextAttempt time.Time) error {
+	mention := q.find(mentionID)
+	mention.State = db.MentionStateFailed
+	if abandon {
+		mention.State = db.MentionStateAbandoned
+	}
+	mention.Attempts++
+	mention.LastError = lastError
+	mention.NextAttemptAt = &nextAttempt
+	return nil
+}
+
+func (q *fakeMentionQueue) PostponeMention(ctx context.Context, mentionID string, until time.Time) error {
+	q.find(mentionID).NextAttemptAt = &until
+	return nil
+}
+
+type MockSocialPlatform struct {
 	mock.Mock
 }
 
-func (m *MockTweetResponder) TweetResponse(ctx context.Context, replyToID string, message string) (*twitter.CreateTweetResponse, error) {
-	args := m.Called(ctx, replyToID, message)
-	return args.Get(0).(*twitter.CreateTweetResponse), args.Error(1)
+func (m *MockSocialPlatform) Platform() model.Platform {
+	return model.PlatformX
+}
+
+func (m *MockSocialPlatform) Account() string {
+	return "bot"
+}
+
+func (m *MockSocialPlatform) Handle() string {
+	return "TrueMediaBot"
+}
+
+func (m *MockSocialPlatform) PollInterval() time.Duration {
+	return time.Minute
+}
+
+func (m *MockSocialPlatform) GetMentionsSince(ctx context.Context, cursor string) ([]platform.Mention, error) {
+	args := m.Called(ctx, cursor)
+	return args.Get(0).([]platform.Mention), args.Error(1)
+}
+
+func (m *MockSocialPlatform) PostReply(ctx context.Context, parentPostURL string, message string) (string, error) {
+	args := m.Called(ctx, parentPostURL, message)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockSocialPlatform) PostThreadedReply(ctx context.Context, replyID string, message string) (string, error) {
+	args := m.Called(ctx, replyID, message)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockSocialPlatform) ClassifyError(err error) platform.APIError {
+	return platform.APIError{Kind: platform.APIErrorKindUnknown, Detail: err.Error()}
+}
+
+type MockEditingSocialPlatform struct {
+	MockSocialPlatform
+}
+
+func (m *MockEditingSocialPlatform) EditReply(ctx context.Context, replyID string, message string) error {
+	args := m.Called(ctx, replyID, message)
+	return args.Error(0)
+}
+
+// Rejects every reply as a duplicate of one already posted
+type MockDuplicateRejectingSocialPlatform struct {
+	MockSocialPlatform
+}
+
+func (m *MockDuplicateRejectingSocialPlatform) ClassifyError(err error) platform.APIError {
+	return platform.APIError{Kind: platform.APIErrorKindDuplicateReply, Detail: err.Error()}
 }
 
 type MockMediaAnalyzer struct {
 	mock.Mock
 }
 
-func (m *MockMediaAnalyzer) GetAnalysis(mediaID string) (*truemedia.GetResultResponse, error) {
-	args := m.Called(mediaID)
+func (m *MockMediaAnalyzer) GetAnalysis(ctx context.Context, mediaID string) (*truemedia.GetResultResponse, error) {
+	args := m.Called(ctx, mediaID)
 	return args.Get(0).(*truemedia.GetResultResponse), args.Error(1)
 }
 
-func TestDescribeVerdict(t *testing.T) {
+func (m *MockMediaAnalyzer) CallbacksEnabled() bool {
+	args := m.Called()
+	return args.Bool(0)
+}
+
+// Reply copy for tests, as built into the binary
+var testMessages = func() *messages.Catalog {
+	catalog, err := messages.Load("")
+	if err != nil {
+		panic(err)
+	}
+	return catalog
+}()
+
+// Generates the content the responders under test are expected to post
+var testResponder = Responder{messages: testMessages}
+
+func TestGenerateResponseContentForVerdict(t *testing.T) {
+	mention := model.Mention{
+		ID:               "c1123lfgdsa023",
+		Platform:         model.PlatformX,
+		PlatformID:       "123456",
+		PlatformUserName: "foo",
+		MediaID:          "foo.mp4",
+		MediaIDs:         []string{"foo.mp4"},
+	}
 	testCases := []struct {
 		description string
 		verdict     truemedia.Verdict
@@ -76,7 +274,7 @@ func TestDescribeVerdict(t *testing.T) {
 	}
 	for _, testCase := range testCases {
 		t.Run(testCase.description, func(t *testing.T) {
-			generatedMsg := describeVerdict(testCase.verdict)
+			generatedMsg := testResponder.generateResponseContent(mention, truemedia.GetResultResponse{State: truemedia.AnalysisStateComplete, Verdict: testCase.verdict})
 			if len(testCase.startsWith) == 0 {
 				assert.Zero(t, len(generatedMsg), "expected no content but got some")
 			} else {
@@ -86,6 +284,15 @@ func TestDescribeVerdict(t *testing.T) {
 			}
 		})
 	}
+
+	t.Run("replies in the language of the mention", func(t *testing.T) {
+		spanishMention := mention
+		spanishMention.Language = "es"
+		generatedMsg := testResponder.generateResponseContent(spanishMention, truemedia.GetResultResponse{State: truemedia.AnalysisStateComplete, Verdict: truemedia.VerdictHigh})
+		assert.True(t, strings.HasPrefix(generatedMsg, "🔴 Veredicto de TrueMedia"))
+		assert.Contains(t, generatedMsg, "@foo")
+		assert.Contains(t, generatedMsg, "id=foo.mp4")
+	})
 }
 
 func TestRespondToPostWithAnalysis(t *testing.T) {
@@ -98,29 +305,30 @@ func TestRespondToPostWithAnalysis(t *testing.T) {
 			Enqueued:         time.Now(),
 			MediaID:          "foo.mp4",
 		}
-		parentID := "789012"
+		parentPostURL := "https://twitter.com/Foo/status/789012"
 		analysis := truemedia.GetResultResponse{
 			State:   truemedia.AnalysisStateComplete,
 			Verdict: truemedia.VerdictHigh,
 		}
-		parentReplyCreateResponse := twitter.CreateTweetResponse{Tweet: &twitter.CreateTweetData{ID: "66662222"}}
+		replyID := "66662222"
 
-		mockTwitterService := new(MockTweetResponder)
-		mockTwitterService.On("TweetResponse", context.TODO(), "789012", generateResponseContent(mention, analysis)).Return(&parentReplyCreateResponse, nil)
+		mockPlatform := new(MockSocialPlatform)
+		mockPlatform.On("PostReply", mock.Anything, parentPostURL, testResponder.generateResponseContent(mention, analysis)).Return(replyID, nil)
 		mockDB := new(MockReplyHandler)
 		mockDB.On("FindRepliesForMention", context.TODO(), mention.ID).Return([]model.Reply{}, nil)
-		mockDB.On("GetMediaPostUrl", context.TODO(), mention.MediaID).Return(fmt.Sprintf("https://twitter.com/Foo/status/%s", parentID), nil)
-		mockDB.On("AddReply", context.TODO(), mention.ID, mention.Platform, parentReplyCreateResponse.Tweet.ID).Return(nil)
+		mockDB.On("GetMediaPostUrl", mock.Anything, mention.MediaID).Return(parentPostURL, nil)
+		mockDB.On("AddReply", context.TODO(), mention.ID, mention.Platform, replyID, db.ReplyTypeFinal).Return(nil)
 		responder := Responder{
-			twitterService:   mockTwitterService,
+			platform:         mockPlatform,
 			truemediaService: new(MockMediaAnalyzer),
 			db:               mockDB,
+			messages:         testMessages,
 			testModeEnabled:  false,
 		}
 
 		err := responder.respondToPostWithAnalysis(context.TODO(), mention, analysis)
 		assert.NoErrorf(t, err, "expected no error but got %v", err)
-		mockTwitterService.AssertNumberOfCalls(t, "TweetResponse", 1)
+		mockPlatform.AssertNumberOfCalls(t, "PostReply", 1)
 		mockDB.AssertNumberOfCalls(t, "AddReply", 1)
 	})
 
@@ -133,29 +341,30 @@ func TestRespondToPostWithAnalysis(t *testing.T) {
 			Enqueued:         time.Now(),
 			MediaID:          "foo.mp4",
 		}
-		parentID := "789012"
+		parentPostURL := "https://twitter.com/Foo/status/789012"
 		analysis := truemedia.GetResultResponse{
 			State:   truemedia.AnalysisStateComplete,
 			Verdict: truemedia.VerdictHigh,
 		}
-		parentReplyCreateResponse := twitter.CreateTweetResponse{Tweet: &twitter.CreateTweetData{ID: "66662222"}}
+		replyID := "66662222"
 
-		mockTwitterService := new(MockTweetResponder)
-		mockTwitterService.On("TweetResponse", context.TODO(), "789012", generateResponseContent(mention, analysis)).Return(&parentReplyCreateResponse, nil)
+		mockPlatform := new(MockSocialPlatform)
+		mockPlatform.On("PostReply", mock.Anything, parentPostURL, testResponder.generateResponseContent(mention, analysis)).Return(replyID, nil)
 		mockDB := new(MockReplyHandler)
 		mockDB.On("FindRepliesForMention", context.TODO(), mention.ID).Return([]model.Reply{}, nil)
-		mockDB.On("GetMediaPostUrl", context.TODO(), mention.MediaID).Return(fmt.Sprintf("https://twitter.com/Foo/status/%s", parentID), nil)
-		mockDB.On("AddReply", context.TODO(), mention.ID, mention.Platform, mock.Anything).Return(nil)
+		mockDB.On("GetMediaPostUrl", mock.Anything, mention.MediaID).Return(parentPostURL, nil)
+		mockDB.On("AddReply", context.TODO(), mention.ID, mention.Platform, mock.Anything, db.ReplyTypeFinal).Return(nil)
 		responder := Responder{
-			twitterService:   mockTwitterService,
+			platform:         mockPlatform,
 			truemediaService: new(MockMediaAnalyzer),
 			db:               mockDB,
+			messages:         testMessages,
 			testModeEnabled:  true,
 		}
 
 		err := responder.respondToPostWithAnalysis(context.TODO(), mention, analysis)
 		assert.NoErrorf(t, err, "expected no error but got %v", err)
-		mockTwitterService.AssertNumberOfCalls(t, "TweetResponse", 0)
+		mockPlatform.AssertNumberOfCalls(t, "PostReply", 0)
 		mockDB.AssertNumberOfCalls(t, "AddReply", 1)
 	})
 
@@ -168,26 +377,27 @@ func TestRespondToPostWithAnalysis(t *testing.T) {
 			Enqueued:         time.Now(),
 			MediaID:          "foo.mp4",
 		}
-		parentID := "789012"
+		parentPostURL := "https://twitter.com/Foo/status/789012"
 		analysis := truemedia.GetResultResponse{
 			State:   truemedia.AnalysisStateComplete,
 			Verdict: truemedia.VerdictHigh,
 		}
-		mockTwitterService := new(MockTweetResponder)
-		mockTwitterService.On("TweetResponse", context.TODO(), "789012", generateResponseContent(mention, analysis)).Return(&twitter.CreateTweetResponse{}, fmt.Errorf("oh nooooo"))
+		mockPlatform := new(MockSocialPlatform)
+		mockPlatform.On("PostReply", mock.Anything, parentPostURL, testResponder.generateResponseContent(mention, analysis)).Return("", fmt.Errorf("oh nooooo"))
 		mockDB := new(MockReplyHandler)
 		mockDB.On("FindRepliesForMention", context.TODO(), mention.ID).Return([]model.Reply{}, nil)
-		mockDB.On("GetMediaPostUrl", context.TODO(), mention.MediaID).Return(fmt.Sprintf("https://twitter.com/Foo/status/%s", parentID), nil)
+		mockDB.On("GetMediaPostUrl", mock.Anything, mention.MediaID).Return(parentPostURL, nil)
 		responder := Responder{
-			twitterService:   mockTwitterService,
+			platform:         mockPlatform,
 			truemediaService: new(MockMediaAnalyzer),
 			db:               mockDB,
+			messages:         testMessages,
 			testModeEnabled:  false,
 		}
 
 		err := responder.respondToPostWithAnalysis(context.TODO(), mention, analysis)
 		assert.Error(t, err, "expected error but got none")
-		mockTwitterService.AssertNumberOfCalls(t, "TweetResponse", 1)
+		mockPlatform.AssertNumberOfCalls(t, "PostReply", 1)
 		mockDB.AssertNumberOfCalls(t, "AddReply", 0)
 	})
 
@@ -200,30 +410,629 @@ func TestRespondToPostWithAnalysis(t *testing.T) {
 			Enqueued:         time.Now(),
 			MediaID:          "foo.mp4",
 		}
-		parentID := "789012"
+		parentPostURL := "https://twitter.com/Foo/status/789012"
 		// mock analysis response just needs a verdict
 		analysis := truemedia.GetResultResponse{
 			State:   truemedia.AnalysisStateProcessing,
 			Verdict: truemedia.VerdictUnknown,
 		}
-		parentReplyCreateResponse := twitter.CreateTweetResponse{Tweet: &twitter.CreateTweetData{ID: "66662222"}}
+		replyID := "66662222"
 
-		mockTwitterService := new(MockTweetResponder)
-		mockTwitterService.On("TweetResponse", context.TODO(), "789012", generateResponseContent(mention, analysis)).Return(&parentReplyCreateResponse, nil)
+		mockPlatform := new(MockSocialPlatform)
+		mockPlatform.On("PostReply", mock.Anything, parentPostURL, testResponder.generateResponseContent(mention, analysis)).Return(replyID, nil)
 		mockDB := new(MockReplyHandler)
 		mockDB.On("FindRepliesForMention", context.TODO(), mention.ID).Return([]model.Reply{}, nil)
-		mockDB.On("GetMediaPostUrl", context.TODO(), mention.MediaID).Return(fmt.Sprintf("https://twitter.com/Foo/status/%s", parentID), nil)
-		mockDB.On("AddReply", context.TODO(), mention.ID, mention.Platform, parentReplyCreateResponse.Tweet.ID).Return(nil)
+		mockDB.On("GetMediaPostUrl", mock.Anything, mention.MediaID).Return(parentPostURL, nil)
+		mockDB.On("AddReply", context.TODO(), mention.ID, mention.Platform, replyID, db.ReplyTypeTimedOut).Return(nil)
+		responder := Responder{
+			platform:         mockPlatform,
+			truemediaService: new(MockMediaAnalyzer),
+			db:               mockDB,
+			messages:         testMessages,
+			testModeEnabled:  false,
+		}
+
+		err := responder.respondToPostWithAnalysis(context.TODO(), mention, analysis)
+		assert.NoErrorf(t, err, "expected no error but got %v", err)
+		mockPlatform.AssertNumberOfCalls(t, "PostReply", 1)
+		mockDB.AssertNumberOfCalls(t, "AddReply", 1)
+	})
+
+	t.Run("threads the result under the interim reply if the platform can't edit", func(t *testing.T) {
+		mention := model.Mention{
+			ID:               "c1123lfgdsa023",
+			Platform:         model.PlatformX,
+			PlatformID:       "123456",
+			PlatformUserName: "foo",
+			Enqueued:         time.Now(),
+			MediaID:          "foo.mp4",
+		}
+		analysis := truemedia.GetResultResponse{
+			State:   truemedia.AnalysisStateComplete,
+			Verdict: truemedia.VerdictHigh,
+		}
+		interimReply := model.Reply{ID: "c1123interim", MentionID: mention.ID, Platform: mention.Platform, PlatformID: "55551111", Type: db.ReplyTypeProcessing}
+		replyID := "66662222"
+
+		mockPlatform := new(MockSocialPlatform)
+		mockPlatform.On("PostThreadedReply", mock.Anything, interimReply.PlatformID, testResponder.generateResponseContent(mention, analysis)).Return(replyID, nil)
+		mockDB := new(MockReplyHandler)
+		mockDB.On("FindRepliesForMention", context.TODO(), mention.ID).Return([]model.Reply{interimReply}, nil)
+		mockDB.On("AddReply", context.TODO(), mention.ID, mention.Platform, replyID, db.ReplyTypeFinal).Return(nil)
+		responder := Responder{
+			platform:         mockPlatform,
+			truemediaService: new(MockMediaAnalyzer),
+			db:               mockDB,
+			messages:         testMessages,
+			testModeEnabled:  false,
+		}
+
+		err := responder.respondToPostWithAnalysis(context.TODO(), mention, analysis)
+		assert.NoErrorf(t, err, "expected no error but got %v", err)
+		mockPlatform.AssertNumberOfCalls(t, "PostThreadedReply", 1)
+		mockPlatform.AssertNumberOfCalls(t, "PostReply", 0)
+		mockDB.AssertNumberOfCalls(t, "AddReply", 1)
+	})
+
+	t.Run("edits the interim reply if the platform can", func(t *testing.T) {
+		mention := model.Mention{
+			ID:               "c1123lfgdsa023",
+			Platform:         model.PlatformMastadon,
+			PlatformID:       "123456",
+			PlatformUserName: "foo",
+			Enqueued:         time.Now(),
+			MediaID:          "foo.mp4",
+		}
+		analysis := truemedia.GetResultResponse{
+			State:   truemedia.AnalysisStateComplete,
+			Verdict: truemedia.VerdictLow,
+		}
+		interimReply := model.Reply{ID: "c1123interim", MentionID: mention.ID, Platform: mention.Platform, PlatformID: "55551111", Type: db.ReplyTypeProcessing}
+
+		mockPlatform := new(MockEditingSocialPlatform)
+		mockPlatform.On("EditReply", mock.Anything, interimReply.PlatformID, testResponder.generateResponseContent(mention, analysis)).Return(nil)
+		mockDB := new(MockReplyHandler)
+		mockDB.On("FindRepliesForMention", context.TODO(), mention.ID).Return([]model.Reply{interimReply}, nil)
+		mockDB.On("AddReply", context.TODO(), mention.ID, mention.Platform, interimReply.PlatformID, db.ReplyTypeFinal).Return(nil)
+		responder := Responder{
+			platform:         mockPlatform,
+			truemediaService: new(MockMediaAnalyzer),
+			db:               mockDB,
+			messages:         testMessages,
+			testModeEnabled:  false,
+		}
+
+		err := responder.respondToPostWithAnalysis(context.TODO(), mention, analysis)
+		assert.NoErrorf(t, err, "expected no error but got %v", err)
+		mockPlatform.AssertNumberOfCalls(t, "EditReply", 1)
+		mockPlatform.AssertNumberOfCalls(t, "PostThreadedReply", 0)
+		mockDB.AssertNumberOfCalls(t, "AddReply", 1)
+	})
+
+	t.Run("does not post a second timed out reply", func(t *testing.T) {
+		mention := model.Mention{
+			ID:               "c1123lfgdsa023",
+			Platform:         model.PlatformX,
+			PlatformID:       "123456",
+			PlatformUserName: "foo",
+			Enqueued:         time.Now().Add(-time.Hour),
+			MediaID:          "foo.mp4",
+		}
+		analysis := truemedia.GetResultResponse{
+			State:   truemedia.AnalysisStateProcessing,
+			Verdict: truemedia.VerdictUnknown,
+		}
+		timedOutReply := model.Reply{ID: "c1123timedout", MentionID: mention.ID, Platform: mention.Platform, PlatformID: "55551111", Type: db.ReplyTypeTimedOut}
+
+		mockPlatform := new(MockSocialPlatform)
+		mockDB := new(MockReplyHandler)
+		mockDB.On("FindRepliesForMention", context.TODO(), mention.ID).Return([]model.Reply{timedOutReply}, nil)
 		responder := Responder{
-			twitterService:   mockTwitterService,
+			platform:         mockPlatform,
 			truemediaService: new(MockMediaAnalyzer),
 			db:               mockDB,
+			messages:         testMessages,
 			testModeEnabled:  false,
 		}
 
 		err := responder.respondToPostWithAnalysis(context.TODO(), mention, analysis)
 		assert.NoErrorf(t, err, "expected no error but got %v", err)
-		mockTwitterService.AssertNumberOfCalls(t, "TweetResponse", 1)
+		mockPlatform.AssertNumberOfCalls(t, "PostReply", 0)
+		mockPlatform.AssertNumberOfCalls(t, "PostThreadedReply", 0)
+		mockDB.AssertNumberOfCalls(t, "AddReply", 0)
+	})
+
+	t.Run("follows a timed out reply with a new reply even if the platform can edit", func(t *testing.T) {
+		mention := model.Mention{
+			ID:               "c1123lfgdsa023",
+			Platform:         model.PlatformMastadon,
+			PlatformID:       "123456",
+			PlatformUserName: "foo",
+			Enqueued:         time.Now().Add(-time.Hour),
+			MediaID:          "foo.mp4",
+		}
+		analysis := truemedia.GetResultResponse{
+			State:   truemedia.AnalysisStateComplete,
+			Verdict: truemedia.VerdictUncertain,
+		}
+		timedOutReply := model.Reply{ID: "c1123timedout", MentionID: mention.ID, Platform: mention.Platform, PlatformID: "55551111", Type: db.ReplyTypeTimedOut}
+		replyID := "66662222"
+
+		mockPlatform := new(MockEditingSocialPlatform)
+		mockPlatform.On("PostThreadedReply", mock.Anything, timedOutReply.PlatformID, testResponder.generateResponseContent(mention, analysis)).Return(replyID, nil)
+		mockDB := new(MockReplyHandler)
+		mockDB.On("FindRepliesForMention", context.TODO(), mention.ID).Return([]model.Reply{timedOutReply}, nil)
+		mockDB.On("AddReply", context.TODO(), mention.ID, mention.Platform, replyID, db.ReplyTypeFinal).Return(nil)
+		responder := Responder{
+			platform:         mockPlatform,
+			truemediaService: new(MockMediaAnalyzer),
+			db:               mockDB,
+			messages:         testMessages,
+			testModeEnabled:  false,
+		}
+
+		err := responder.respondToPostWithAnalysis(context.TODO(), mention, analysis)
+		assert.NoErrorf(t, err, "expected no error but got %v", err)
+		mockPlatform.AssertNumberOfCalls(t, "PostThreadedReply", 1)
+		mockPlatform.AssertNumberOfCalls(t, "EditReply", 0)
 		mockDB.AssertNumberOfCalls(t, "AddReply", 1)
 	})
 }
+
+func TestRepeatMentionOfSamePost(t *testing.T) {
+	// A user mentioning the bot a second time on a post gets the same processing text, which X rejects
+	mention := model.Mention{
+		ID:               "c1123second",
+		Platform:         model.PlatformX,
+		PlatformID:       "123457",
+		PlatformUserName: "foo",
+		Enqueued:         time.Now(),
+		MediaID:          "foo.mp4",
+	}
+	parentPostURL := "https://twitter.com/Foo/status/789012"
+
+	t.Run("records a placeholder for a rejected processing reply", func(t *testing.T) {
+		mockPlatform := new(MockDuplicateRejectingSocialPlatform)
+		mockPlatform.On("PostReply", mock.Anything, parentPostURL, testResponder.generateProcessingContent(mention)).Return("", errors.New("duplicate content"))
+		mockDB := new(MockReplyHandler)
+		mockDB.On("FindRepliesForMention", context.TODO(), mention.ID).Return([]model.Reply{}, nil)
+		mockDB.On("GetMediaPostUrl", mock.Anything, mention.MediaID).Return(parentPostURL, nil)
+		mockDB.On("AddPlaceholderReply", context.TODO(), mention.ID, mention.Platform, db.ReplyTypeProcessing).Return(nil)
+		responder := NewResponder(mockPlatform, new(MockMediaAnalyzer), mockDB, testMessages, url.URL{}, "worker", false)
+
+		err := responder.acknowledgeMention(context.TODO(), mention)
+		assert.Error(t, err)
+		responder.handleAPIError(context.TODO(), mention, err, db.ReplyTypeProcessing)
+		mockDB.AssertNumberOfCalls(t, "AddPlaceholderReply", 1)
+		mockDB.AssertNumberOfCalls(t, "AddReply", 0)
+	})
+
+	t.Run("replies to the media post rather than under a placeholder", func(t *testing.T) {
+		analysis := truemedia.GetResultResponse{State: truemedia.AnalysisStateComplete, Verdict: truemedia.VerdictHigh}
+		placeholder := model.Reply{ID: "c1123interim", MentionID: mention.ID, Platform: mention.Platform, PlatformID: "c1123madeup", Type: db.ReplyTypeProcessing, Placeholder: true}
+		replyID := "66662222"
+
+		mockPlatform := new(MockEditingSocialPlatform)
+		mockPlatform.On("PostReply", mock.Anything, parentPostURL, testResponder.generateResponseContent(mention, analysis)).Return(replyID, nil)
+		mockDB := new(MockReplyHandler)
+		mockDB.On("FindRepliesForMention", context.TODO(), mention.ID).Return([]model.Reply{placeholder}, nil)
+		mockDB.On("GetMediaPostUrl", mock.Anything, mention.MediaID).Return(parentPostURL, nil)
+		mockDB.On("AddReply", context.TODO(), mention.ID, mention.Platform, replyID, db.ReplyTypeFinal).Return(nil)
+		responder := NewResponder(mockPlatform, new(MockMediaAnalyzer), mockDB, testMessages, url.URL{}, "worker", false)
+
+		err := responder.respondToPostWithAnalysis(context.TODO(), mention, analysis)
+		assert.NoError(t, err)
+		mockPlatform.AssertNumberOfCalls(t, "PostReply", 1)
+		mockPlatform.AssertNumberOfCalls(t, "EditReply", 0)
+		mockPlatform.AssertNumberOfCalls(t, "PostThreadedReply", 0)
+	})
+}
+
+func TestAcknowledgeMention(t *testing.T) {
+	mention := model.Mention{
+		ID:               "c1123lfgdsa023",
+		Platform:         model.PlatformX,
+		PlatformID:       "123456",
+		PlatformUserName: "foo",
+		Enqueued:         time.Now(),
+		MediaID:          "foo.mp4",
+	}
+	parentPostURL := "https://twitter.com/Foo/status/789012"
+
+	t.Run("posts a processing reply the first time a mention is seen", func(t *testing.T) {
+		replyID := "55551111"
+		mockPlatform := new(MockSocialPlatform)
+		mockPlatform.On("PostReply", mock.Anything, parentPostURL, testResponder.generateProcessingContent(mention)).Return(replyID, nil)
+		mockDB := new(MockReplyHandler)
+		mockDB.On("FindRepliesForMention", context.TODO(), mention.ID).Return([]model.Reply{}, nil)
+		mockDB.On("GetMediaPostUrl", mock.Anything, mention.MediaID).Return(parentPostURL, nil)
+		mockDB.On("AddReply", context.TODO(), mention.ID, mention.Platform, replyID, db.ReplyTypeProcessing).Return(nil)
+		responder := Responder{
+			platform:         mockPlatform,
+			truemediaService: new(MockMediaAnalyzer),
+			db:               mockDB,
+			messages:         testMessages,
+			testModeEnabled:  false,
+		}
+
+		err := responder.acknowledgeMention(context.TODO(), mention)
+		assert.NoErrorf(t, err, "expected no error but got %v", err)
+		mockPlatform.AssertNumberOfCalls(t, "PostReply", 1)
+		mockDB.AssertNumberOfCalls(t, "AddReply", 1)
+	})
+
+	t.Run("does not post again if a processing reply exists", func(t *testing.T) {
+		mockPlatform := new(MockSocialPlatform)
+		mockDB := new(MockReplyHandler)
+		mockDB.On("FindRepliesForMention", context.TODO(), mention.ID).Return([]model.Reply{{ID: "c1123interim", Type: db.ReplyTypeProcessing}}, nil)
+		responder := Responder{
+			platform:         mockPlatform,
+			truemediaService: new(MockMediaAnalyzer),
+			db:               mockDB,
+			messages:         testMessages,
+			testModeEnabled:  false,
+		}
+
+		err := responder.acknowledgeMention(context.TODO(), mention)
+		assert.NoErrorf(t, err, "expected no error but got %v", err)
+		mockPlatform.AssertNumberOfCalls(t, "PostReply", 0)
+		mockDB.AssertNumberOfCalls(t, "AddReply", 0)
+	})
+}
+
+func TestProcessingReplyFailureBacksOff(t *testing.T) {
+	mention := model.Mention{ID: "c1123lfgdsa023", Platform: model.PlatformX, MediaID: "foo.mp4"}
+	mockDB := new(MockReplyHandler)
+	mockDB.On("PostponeMention", mock.Anything, mention.ID, mock.Anything).Return(nil)
+	responder := NewResponder(new(MockSocialPlatform), new(MockMediaAnalyzer), mockDB, testMessages, url.URL{}, "worker", false)
+
+	responder.handleAPIError(context.TODO(), mention, errors.New("forbidden"), db.ReplyTypeProcessing)
+	mockDB.AssertCalled(t, "PostponeMention", mock.Anything, mention.ID, mock.MatchedBy(func(until time.Time) bool {
+		return time.Until(until) > 0 && time.Until(until) <= failureBackoff
+	}))
+	mockDB.AssertNotCalled(t, "RecordMentionFailure", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestSchedulesNextPoll(t *testing.T) {
+	analyzing := func(id string, age time.Duration) model.Mention {
+		return model.Mention{ID: id, Platform: model.PlatformX, State: db.MentionStateAnalyzing, Enqueued: time.Now().Add(-age), MediaID: "foo.mp4", MediaIDs: []string{"foo.mp4"}}
+	}
+	newResponder := func(callbacksEnabled bool) (*Responder, *MockReplyHandler) {
+		analyzer := new(MockMediaAnalyzer)
+		analyzer.On("CallbacksEnabled").Return(callbacksEnabled)
+		analyzer.On("GetAnalysis", mock.Anything, "foo.mp4").Return(&truemedia.GetResultResponse{State: truemedia.AnalysisStateProcessing}, nil)
+		mockDB := new(MockReplyHandler)
+		// The user has already been told the bot is on it, and that it's taking a while
+		mockDB.On("FindRepliesForMention", mock.Anything, mock.Anything).Return([]model.Reply{{Type: db.ReplyTypeProcessing, PlatformID: "55551111"}, {Type: db.ReplyTypeTimedOut, PlatformID: "55552222"}}, nil)
+		mockDB.On("PostponeMention", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+		return NewResponder(new(MockSocialPlatform), analyzer, mockDB, testMessages, url.URL{}, "worker", false), mockDB
+	}
+	postponedBy := func(interval time.Duration) interface{} {
+		return mock.MatchedBy(func(until time.Time) bool {
+			return time.Until(until) > interval-time.Minute && time.Until(until) <= interval
+		})
+	}
+
+	t.Run("recent mentions are checked on every pass", func(t *testing.T) {
+		responder, mockDB := newResponder(false)
+		responder.checkMention(context.Background(), analyzing("recent", time.Minute), map[string]truemedia.GetResultResponse{})
+		mockDB.AssertNotCalled(t, "PostponeMention", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("with callbacks, recent mentions are polled as a safety net", func(t *testing.T) {
+		responder, mockDB := newResponder(true)
+		responder.checkMention(context.Background(), analyzing("recent", time.Minute), map[string]truemedia.GetResultResponse{})
+		mockDB.AssertCalled(t, "PostponeMention", mock.Anything, "recent", postponedBy(callbackPollInterval))
+	})
+
+	t.Run("slow mentions are checked every timedOutPollInterval", func(t *testing.T) {
+		responder, mockDB := newResponder(true)
+		responder.checkMention(context.Background(), analyzing("slow", time.Hour), map[string]truemedia.GetResultResponse{})
+		mockDB.AssertCalled(t, "PostponeMention", mock.Anything, "slow", postponedBy(timedOutPollInterval))
+		mockDB.AssertNumberOfCalls(t, "PostponeMention", 1)
+	})
+}
+
+func TestSlowAnalysesDontStarveNewMentions(t *testing.T) {
+	queue := &fakeMentionQueue{replies: map[string][]model.Reply{}}
+	// A claim's worth and more of mentions that timed out long ago, and are still being analyzed
+	for i := range mentionClaimLimit + 5 {
+		mentionID := fmt.Sprintf("slow%d", i)
+		queue.mentions = append(queue.mentions, &model.Mention{ID: mentionID, Platform: model.PlatformX, State: db.MentionStateAnalyzing, Enqueued: time.Now().Add(-time.Hour), MediaID: "slow.mp4", MediaIDs: []string{"slow.mp4"}})
+		queue.replies[mentionID] = []model.Reply{{MentionID: mentionID, Type: db.ReplyTypeTimedOut, PlatformID: "5555" + mentionID}}
+	}
+	fresh := &model.Mention{ID: "fresh", Platform: model.PlatformX, PlatformUserName: "foo", State: db.MentionStateQueued, Enqueued: time.Now(), MediaID: "fresh.mp4", MediaIDs: []string{"fresh.mp4"}}
+	queue.mentions = append(queue.mentions, fresh)
+
+	analyzer := new(MockMediaAnalyzer)
+	analyzer.On("CallbacksEnabled").Return(false)
+	analyzer.On("GetAnalysis", mock.Anything, "slow.mp4").Return(&truemedia.GetResultResponse{State: truemedia.AnalysisStateProcessing}, nil)
+	analyzer.On("GetAnalysis", mock.Anything, "fresh.mp4").Return(&truemedia.GetResultResponse{State: truemedia.AnalysisStateComplete, Verdict: truemedia.VerdictHigh}, nil)
+	mockPlatform := new(MockSocialPlatform)
+	mockPlatform.On("PostReply", mock.Anything, "https://twitter.com/Foo/status/fresh.mp4", mock.Anything).Return("66662222", nil)
+	responder := NewResponder(mockPlatform, analyzer, queue, testMessages, url.URL{}, "worker", false)
+
+	for range 2 {
+		assert.NoError(t, responder.checkForWork(context.Background()))
+	}
+	assert.Equal(t, db.MentionStateReplied, fresh.State)
+	mockPlatform.AssertNumberOfCalls(t, "PostReply", 1)
+	// Each slow mention was checked once, and left until its next check is due
+	analyzer.AssertNumberOfCalls(t, "GetAnalysis", 3)
+	for _, mention := range queue.mentions[:mentionClaimLimit+5] {
+		assert.WithinDuration(t, time.Now().Add(timedOutPollInterval), *mention.NextAttemptAt, time.Minute)
+	}
+}
+
+func TestCallbackChecksEveryMentionWaitingOnMedia(t *testing.T) {
+	// More than one claim's worth, which all need checking
+	var mentions []model.Mention
+	for i := range mentionClaimLimit + 5 {
+		mentions = append(mentions, model.Mention{ID: fmt.Sprintf("m%d", i), Platform: model.PlatformX, State: db.MentionStateAnalyzing, Enqueued: time.Now(), MediaID: "foo.mp4", MediaIDs: []string{"foo.mp4"}})
+	}
+	analyzer := new(MockMediaAnalyzer)
+	analyzer.On("CallbacksEnabled").Return(true)
+	analyzer.On("GetAnalysis", mock.Anything, "foo.mp4").Return(&truemedia.GetResultResponse{State: truemedia.AnalysisStateProcessing}, nil)
+	mockDB := new(MockReplyHandler)
+	mockDB.On("ClaimMentionsForMedia", mock.Anything, model.PlatformX, "worker", mentionLeaseDuration, "foo.mp4").Return(mentions, nil)
+	// Each already has its processing reply
+	mockDB.On("FindRepliesForMention", mock.Anything, mock.Anything).Return([]model.Reply{{Type: db.ReplyTypeProcessing, PlatformID: "55551111"}}, nil)
+	mockDB.On("PostponeMention", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	responder := NewResponder(new(MockSocialPlatform), analyzer, mockDB, testMessages, url.URL{}, "worker", false)
+
+	responder.checkMentionsForMedia(context.Background(), "foo.mp4")
+	mockDB.AssertNumberOfCalls(t, "FindRepliesForMention", len(mentions))
+	analyzer.AssertNumberOfCalls(t, "GetAnalysis", 1)
+}
+
+func TestCallbackErrorsDontStopTheResponder(t *testing.T) {
+	claimed := make(chan struct{})
+	mockDB := new(MockReplyHandler)
+	mockDB.On("ClaimMentionsForMedia", mock.Anything, model.PlatformX, "worker", mentionLeaseDuration, "bad.mp4").Return([]model.Mention{}, errors.New("connection reset"))
+	mockDB.On("ClaimMentionsForMedia", mock.Anything, model.PlatformX, "worker", mentionLeaseDuration, "foo.mp4").Return([]model.Mention{}, nil).Run(func(mock.Arguments) { close(claimed) })
+	mockDB.On("ReleaseMentions", mock.Anything, model.PlatformX, "worker").Return(nil)
+	responder := NewResponder(new(MockSocialPlatform), new(MockMediaAnalyzer), mockDB, testMessages, url.URL{}, "worker", false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- responder.Respond(ctx) }()
+	responder.Wake("bad.mp4")
+	responder.Wake("foo.mp4")
+	// The callback after the failed one is still handled
+	select {
+	case <-claimed:
+	case <-time.After(time.Second):
+		t.Fatal("responder stopped handling callbacks")
+	}
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestRecordFailure(t *testing.T) {
+	mockDB := new(MockReplyHandler)
+	mockDB.On("RecordMentionFailure", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	// Abandoned mentions get an error reply; these already have one
+	mockDB.On("FindRepliesForMention", mock.Anything, mock.Anything).Return([]model.Reply{{Type: db.ReplyTypeError}}, nil)
+	responder := NewResponder(new(MockSocialPlatform), new(MockMediaAnalyzer), mockDB, testMessages, url.URL{}, "worker", false)
+
+	responder.recordFailure(context.Background(), model.Mention{ID: "first", Attempts: 0}, errors.New("oops"), false)
+	mockDB.AssertCalled(t, "RecordMentionFailure", mock.Anything, "first", "oops", false, mock.MatchedBy(func(next time.Time) bool {
+		return time.Until(next) > 0 && time.Until(next) <= failureBackoff
+	}))
+
+	responder.recordFailure(context.Background(), model.Mention{ID: "last", Attempts: maxMentionAttempts - 1}, errors.New("oops"), false)
+	mockDB.AssertCalled(t, "RecordMentionFailure", mock.Anything, "last", "oops", true, mock.Anything)
+
+	responder.recordFailure(context.Background(), model.Mention{ID: "permanent"}, errors.New("no media"), true)
+	mockDB.AssertCalled(t, "RecordMentionFailure", mock.Anything, "permanent", "no media", true, mock.Anything)
+	mockDB.AssertNumberOfCalls(t, "FindRepliesForMention", 2)
+}
+
+func TestAbandonsAnalysesThatNeverFinish(t *testing.T) {
+	mention := model.Mention{ID: "stuck", Platform: model.PlatformX, State: db.MentionStateAnalyzing, Enqueued: time.Now().Add(-maximumAnalysisAge - time.Hour), MediaID: "foo.mp4", MediaIDs: []string{"foo.mp4"}}
+	analyzer := new(MockMediaAnalyzer)
+	analyzer.On("GetAnalysis", mock.Anything, "foo.mp4").Return(&truemedia.GetResultResponse{State: truemedia.AnalysisStateProcessing}, nil)
+	mockDB := new(MockReplyHandler)
+	mockDB.On("RecordMentionFailure", mock.Anything, mention.ID, mock.Anything, true, mock.Anything).Return(nil)
+	// The user was sent the results link long ago, and already has an error reply
+	mockDB.On("FindRepliesForMention", mock.Anything, mention.ID).Return([]model.Reply{{Type: db.ReplyTypeTimedOut}, {Type: db.ReplyTypeError}}, nil)
+	responder := NewResponder(new(MockSocialPlatform), analyzer, mockDB, testMessages, url.URL{}, "worker", false)
+
+	responder.checkMention(context.Background(), mention, map[string]truemedia.GetResultResponse{})
+	mockDB.AssertNumberOfCalls(t, "RecordMentionFailure", 1)
+}
+
+func TestReplyWithError(t *testing.T) {
+	resultsURL, _ := url.Parse("https://detect.truemedia.org/media/analysis")
+
+	t.Run("suggests uploading media that couldn't be resolved", func(t *testing.T) {
+		mention := model.Mention{
+			ID:               "c1123lfgdsa023",
+			Platform:         model.PlatformX,
+			PlatformUserName: "foo",
+			MediaPostURL:     "https://twitter.com/Foo/status/789012",
+			FailureReason:    string(truemedia.FailureReasonPrivateAccount),
+		}
+		mockPlatform := new(MockSocialPlatform)
+		mockPlatform.On("PostReply", mock.Anything, mention.MediaPostURL, mock.Anything).Return("55551111", nil)
+		mockDB := new(MockReplyHandler)
+		mockDB.On("FindRepliesForMention", context.TODO(), mention.ID).Return([]model.Reply{}, nil)
+		mockDB.On("AddReply", context.TODO(), mention.ID, mention.Platform, "55551111", db.ReplyTypeError).Return(nil)
+		responder := NewResponder(mockPlatform, new(MockMediaAnalyzer), mockDB, testMessages, *resultsURL, "worker", false)
+
+		err := responder.replyWithError(context.TODO(), mention, &truemedia.FailureError{Reason: truemedia.FailureReasonPrivateAccount})
+		assert.Nil(t, err)
+		content := mockPlatform.Calls[0].Arguments.String(2)
+		assert.Contains(t, content, "private or protected account")
+		assert.Contains(t, content, "https://detect.truemedia.org")
+		assert.NotContains(t, content, "media/analysis")
+		mockDB.AssertNumberOfCalls(t, "AddReply", 1)
+	})
+
+	t.Run("links the analysis when there is one", func(t *testing.T) {
+		mention := model.Mention{ID: "c1123lfgdsa023", Platform: model.PlatformX, PlatformUserName: "foo", MediaID: "foo.mp4"}
+		parentPostURL := "https://twitter.com/Foo/status/789012"
+		mockPlatform := new(MockSocialPlatform)
+		mockPlatform.On("PostReply", mock.Anything, parentPostURL, mock.Anything).Return("55551111", nil)
+		mockDB := new(MockReplyHandler)
+		mockDB.On("FindRepliesForMention", context.TODO(), mention.ID).Return([]model.Reply{}, nil)
+		mockDB.On("GetMediaPostUrl", mock.Anything, mention.MediaID).Return(parentPostURL, nil)
+		mockDB.On("AddReply", context.TODO(), mention.ID, mention.Platform, "55551111", db.ReplyTypeError).Return(nil)
+		responder := NewResponder(mockPlatform, new(MockMediaAnalyzer), mockDB, testMessages, *resultsURL, "worker", false)
+
+		err := responder.replyWithError(context.TODO(), mention, errors.New("timeout"))
+		assert.Nil(t, err)
+		content := mockPlatform.Calls[0].Arguments.String(2)
+		assert.Contains(t, content, "Something went wrong")
+		assert.Contains(t, content, "https://detect.truemedia.org/media/analysis?id=foo.mp4")
+	})
+
+	t.Run("does not post twice", func(t *testing.T) {
+		mention := model.Mention{ID: "c1123lfgdsa023", Platform: model.PlatformX, MediaID: "foo.mp4"}
+		mockPlatform := new(MockSocialPlatform)
+		mockDB := new(MockReplyHandler)
+		mockDB.On("FindRepliesForMention", context.TODO(), mention.ID).Return([]model.Reply{{Type: db.ReplyTypeError}}, nil)
+		responder := NewResponder(mockPlatform, new(MockMediaAnalyzer), mockDB, testMessages, *resultsURL, "worker", false)
+
+		assert.Nil(t, responder.replyWithError(context.TODO(), mention, errors.New("timeout")))
+		mockPlatform.AssertNumberOfCalls(t, "PostReply", 0)
+	})
+
+	t.Run("posts again once the earlier reply is superseded", func(t *testing.T) {
+		mention := model.Mention{ID: "c1123lfgdsa023", Platform: model.PlatformX, MediaID: "foo.mp4"}
+		parentPostURL := "https://twitter.com/Foo/status/789012"
+		mockPlatform := new(MockSocialPlatform)
+		mockPlatform.On("PostReply", mock.Anything, parentPostURL, mock.Anything).Return("55552222", nil)
+		mockDB := new(MockReplyHandler)
+		mockDB.On("FindRepliesForMention", context.TODO(), mention.ID).Return([]model.Reply{{Type: db.ReplyTypeError, PlatformID: "55551111", Superseded: true}}, nil)
+		mockDB.On("GetMediaPostUrl", mock.Anything, mention.MediaID).Return(parentPostURL, nil)
+		mockDB.On("AddReply", context.TODO(), mention.ID, mention.Platform, "55552222", db.ReplyTypeError).Return(nil)
+		responder := NewResponder(mockPlatform, new(MockMediaAnalyzer), mockDB, testMessages, *resultsURL, "worker", false)
+
+		assert.Nil(t, responder.replyWithError(context.TODO(), mention, errors.New("timeout")))
+		mockPlatform.AssertNumberOfCalls(t, "PostReply", 1)
+		mockDB.AssertNumberOfCalls(t, "AddReply", 1)
+	})
+}
+
+func TestGetAnalysesSharesResults(t *testing.T) {
+	analyzer := new(MockMediaAnalyzer)
+	analyzer.On("GetAnalysis", mock.Anything, "a.mp4").Return(&truemedia.GetResultResponse{State: truemedia.AnalysisStateComplete}, nil).Once()
+	analyzer.On("GetAnalysis", mock.Anything, "b.jpg").Return(&truemedia.GetResultResponse{State: truemedia.AnalysisStateProcessing}, nil).Once()
+	responder := NewResponder(new(MockSocialPlatform), analyzer, new(MockReplyHandler), testMessages, url.URL{}, "worker", false)
+
+	fetched := map[string]truemedia.GetResultResponse{}
+	first, err := responder.getAnalyses(context.Background(), model.Mention{MediaIDs: []string{"a.mp4"}}, fetched)
+	assert.NoError(t, err)
+	second, err := responder.getAnalyses(context.Background(), model.Mention{MediaIDs: []string{"a.mp4", "b.jpg"}}, fetched)
+	assert.NoError(t, err)
+
+	assert.Equal(t, first[0], second[0])
+	assert.Equal(t, truemedia.AnalysisStateProcessing, second[1].State)
+	analyzer.AssertNumberOfCalls(t, "GetAnalysis", 2)
+}
+
+func TestGenerateResponseContentForMultipleMedia(t *testing.T) {
+	mention := model.Mention{
+		ID:               "c1123lfgdsa023",
+		Platform:         model.PlatformX,
+		PlatformID:       "123456",
+		PlatformUserName: "foo",
+		Enqueued:         time.Now(),
+		MediaID:          "first.jpg",
+		MediaIDs:         []string{"first.jpg", "second.jpg", "third.mp4"},
+	}
+
+	t.Run("headlines the worst verdict and summarizes the rest", func(t *testing.T) {
+		content := testResponder.generateResponseContent(mention,
+			truemedia.GetResultResponse{State: truemedia.AnalysisStateComplete, Verdict: truemedia.VerdictLow},
+			truemedia.GetResultResponse{State: truemedia.AnalysisStateComplete, Verdict: truemedia.VerdictHigh},
+			truemedia.GetResultResponse{State: truemedia.AnalysisStateComplete, Verdict: truemedia.VerdictHigh},
+		)
+		assert.True(t, strings.HasPrefix(content, "🔴"))
+		assert.Contains(t, content, testResponder.generateResultsURL("second.jpg"))
+		assert.Contains(t, content, "2 of 3 items in this post show substantial evidence of manipulation.")
+		assert.NotContains(t, content, "non-partisan")
+	})
+
+	t.Run("leaves failed items out of the summary", func(t *testing.T) {
+		content := testResponder.generateResponseContent(mention,
+			truemedia.GetResultResponse{State: truemedia.AnalysisStateComplete, Verdict: truemedia.VerdictUncertain},
+			truemedia.GetResultResponse{State: truemedia.AnalysisStateError},
+			truemedia.GetResultResponse{State: truemedia.AnalysisStateComplete, Verdict: truemedia.VerdictTrusted},
+		)
+		assert.True(t, strings.HasPrefix(content, "🟡"))
+		assert.Contains(t, content, testResponder.generateResultsURL("first.jpg"))
+		assert.Contains(t, content, "1 of 2 items in this post shows some evidence of manipulation.")
+	})
+
+	t.Run("waits until every item is done", func(t *testing.T) {
+		analyses := []truemedia.GetResultResponse{
+			{State: truemedia.AnalysisStateComplete, Verdict: truemedia.VerdictHigh},
+			{State: truemedia.AnalysisStateProcessing, Verdict: truemedia.VerdictUnknown},
+			{State: truemedia.AnalysisStateComplete, Verdict: truemedia.VerdictLow},
+		}
+		assert.Equal(t, truemedia.AnalysisStateProcessing, combinedState(analyses))
+		assert.True(t, strings.HasPrefix(testResponder.generateResponseContent(mention, analyses...), "⏳"))
+	})
+}
+
+func TestGenerateResponseContentForCommands(t *testing.T) {
+	mention := model.Mention{
+		ID:               "c1123lfgdsa023",
+		Platform:         model.PlatformX,
+		PlatformID:       "123456",
+		PlatformUserName: "foo",
+		MediaID:          "foo.mp4",
+		MediaIDs:         []string{"foo.mp4"},
+	}
+	analysis := truemedia.GetResultResponse{
+		State:   truemedia.AnalysisStateComplete,
+		Verdict: truemedia.VerdictUncertain,
+		Scores: map[string]interface{}{
+			"faces":    0.914,
+			"voice":    map[string]interface{}{"score": 0.42},
+			"lipsync":  0.3,
+			"metadata": 0.1,
+		},
+	}
+
+	t.Run("details lists the top detector scores", func(t *testing.T) {
+		mention := mention
+		mention.Command = model.CommandDetails
+		content := testResponder.generateResponseContent(mention, analysis)
+		assert.True(t, strings.HasPrefix(content, "🟡"))
+		assert.Contains(t, content, "• faces: 91%\n• voice (audio): 42%\n• lipsync: 30%")
+		assert.NotContains(t, content, "metadata")
+	})
+
+	t.Run("explain describes the verdict", func(t *testing.T) {
+		mention := mention
+		mention.Command = model.CommandExplain
+		content := testResponder.generateResponseContent(mention, analysis)
+		assert.True(t, strings.HasPrefix(content, "🟡"))
+		assert.Contains(t, content, "Our AI detectors disagree")
+	})
+
+	t.Run("commands wait for the analysis like everything else", func(t *testing.T) {
+		mention := mention
+		mention.Command = model.CommandDetails
+		content := testResponder.generateResponseContent(mention, truemedia.GetResultResponse{State: truemedia.AnalysisStateProcessing})
+		assert.True(t, strings.HasPrefix(content, "⏳"))
+	})
+}
+
+func TestVerdictCardIsInTheMentionsLanguage(t *testing.T) {
+	// Test mode renders cards whether or not the platform takes images
+	responder := NewResponder(new(MockSocialPlatform), new(MockMediaAnalyzer), new(MockReplyHandler), testMessages, url.URL{}, "worker", true)
+	analyses := []truemedia.GetResultResponse{{State: truemedia.AnalysisStateComplete, Verdict: truemedia.VerdictHigh}}
+
+	english := responder.renderVerdictCard(context.TODO(), model.Mention{ID: t.Name() + "-en", Platform: model.PlatformX, Language: "en"}, analyses)
+	assert.NotNil(t, english)
+	assert.Equal(t, "TrueMedia.org verdict: substantial evidence of manipulation.", english.AltText)
+
+	spanish := responder.renderVerdictCard(context.TODO(), model.Mention{ID: t.Name() + "-es", Platform: model.PlatformX, Language: "es"}, analyses)
+	assert.NotNil(t, spanish)
+	assert.Equal(t, "Veredicto de TrueMedia.org: evidencia sustancial de manipulación.", spanish.AltText)
+	assert.NotEqual(t, english.PNG, spanish.PNG)
+}
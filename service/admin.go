@@ -0,0 +1,327 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/truemediaorg/socialbot/config"
+	"github.com/truemediaorg/socialbot/database/db"
+	"github.com/truemediaorg/socialbot/model"
+	"github.com/truemediaorg/socialbot/tracing"
+	"github.com/truemediaorg/socialbot/truemedia"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	log "github.com/sirupsen/logrus"
+)
+
+// Everything the bot hasn't finished with, including what it gave up on
+var UnfinishedMentionStates = []db.MentionState{db.MentionStateQueued, db.MentionStateAnalyzing, db.MentionStateFailed, db.MentionStateAbandoned}
+
+type AdminStore interface {
+	ListMentionsByState(ctx context.Context, states ...db.MentionState) ([]model.Mention, error)
+	GetMention(ctx context.Context, mentionID string) (*model.Mention, error)
+	FindRepliesForMention(ctx context.Context, mentionID string) ([]model.Reply, error)
+	DeleteMention(ctx context.Context, mentionID string) error
+	RequeueMention(ctx context.Context, mentionID string) (bool, error)
+	ReopenMention(ctx context.Context, mentionID string) (bool, error)
+}
+
+type AdminAnalyzer interface {
+	GetAnalysis(ctx context.Context, mediaID string) (*truemedia.GetResultResponse, error)
+}
+
+// Serves the admin API, which lets operators look at and fix up the mention queue without psql
+type AdminService struct {
+	token    string
+	store    AdminStore
+	analyzer AdminAnalyzer
+	// Asks each platform's watcher to poll now, returning false if this replica isn't the one polling
+	pollers map[model.Platform]func() bool
+}
+
+// How the admin API and the operator commands describe a mention
+type MentionView struct {
+	ID            string          `json:"id"`
+	Platform      model.Platform  `json:"platform"`
+	PlatformID    string          `json:"platformId"`
+	UserName      string          `json:"userName"`
+	Enqueued      time.Time       `json:"enqueued"`
+	State         db.MentionState `json:"state"`
+	Attempts      int             `json:"attempts"`
+	LastError     string          `json:"lastError,omitempty"`
+	NextAttemptAt *time.Time      `json:"nextAttemptAt,omitempty"`
+	MediaPostURL  string          `json:"mediaPostUrl,omitempty"`
+	FailureReason string          `json:"failureReason,omitempty"`
+	Command       string          `json:"command,omitempty"`
+	TraceID       string          `json:"traceId,omitempty"`
+	Analyses      []AnalysisView  `json:"analyses,omitempty"`
+	Replies       []ReplyView     `json:"replies,omitempty"`
+}
+
+type AnalysisView struct {
+	MediaID string                  `json:"mediaId"`
+	State   truemedia.AnalysisState `json:"state,omitempty"`
+	Verdict truemedia.Verdict       `json:"verdict,omitempty"`
+	Errors  []string                `json:"errors,omitempty"`
+	// Set if the analysis couldn't be fetched
+	Error string `json:"error,omitempty"`
+}
+
+type ReplyView struct {
+	ID         string       `json:"id"`
+	PlatformID string       `json:"platformId"`
+	Type       db.ReplyType `json:"type"`
+	Replied    time.Time    `json:"replied"`
+	// The platform rejected the reply as a duplicate, so PlatformID is made up
+	Placeholder bool `json:"placeholder,omitempty"`
+	// Replaced by a fresh reply an operator asked for
+	Superseded bool `json:"superseded,omitempty"`
+}
+
+func NewAdminService(cfg config.Config, secretsManagerClient *secretsmanager.Client, store AdminStore, analyzer AdminAnalyzer) *AdminService {
+	// Get the admin token from AWS Secrets Manager
+	result, err := secretsManagerClient.GetSecretValue(
+		context.Background(),
+		&secretsmanager.GetSecretValueInput{
+			SecretId: aws.String(cfg.AdminSecretPath),
+		},
+	)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	var adminSecrets config.AdminSecretData
+	err = json.Unmarshal([]byte(*result.SecretString), &adminSecrets)
+	if err != nil {
+		log.Panicf("admin secrets read error: %v", err)
+	}
+	if adminSecrets.Token == "" {
+		log.Fatal("the admin API needs a token in the admin secrets")
+	}
+	return &AdminService{
+		token:    adminSecrets.Token,
+		store:    store,
+		analyzer: analyzer,
+		pollers:  map[model.Platform]func() bool{},
+	}
+}
+
+// Lets the admin API trigger a poll on a platform's watcher
+func (s *AdminService) AddPoller(platform model.Platform, pollNow func() bool) {
+	s.pollers[platform] = pollNow
+}
+
+// Serves the admin API under /admin/. Requests must carry the admin token as a bearer token.
+func (s *AdminService) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/mentions", s.handleListMentions)
+	mux.HandleFunc("GET /admin/mentions/{id}", s.handleGetMention)
+	mux.HandleFunc("DELETE /admin/mentions/{id}", s.handleDeleteMention)
+	mux.HandleFunc("POST /admin/mentions/{id}/reply", s.handleReopenMention)
+	mux.HandleFunc("POST /admin/mentions/{id}/requeue", s.handleRequeueMention)
+	mux.HandleFunc("POST /admin/watchers/{platform}/poll", s.handlePoll)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			log.WithField("path", r.URL.Path).Warn("rejected admin request with a bad token")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		log.WithField("method", r.Method).WithField("path", r.URL.Path).Info("admin request")
+		mux.ServeHTTP(w, r)
+	})
+}
+
+/*
+Lists mentions the bot hasn't finished with, oldest first, with the state of their analyses.
+The "state" query param picks other states, comma-separated (e.g. "FAILED,ABANDONED").
+*/
+func (s *AdminService) handleListMentions(w http.ResponseWriter, r *http.Request) {
+	states := UnfinishedMentionStates
+	if param := r.URL.Query().Get("state"); param != "" {
+		states = nil
+		for _, state := range strings.Split(param, ",") {
+			states = append(states, db.MentionState(strings.ToUpper(strings.TrimSpace(state))))
+		}
+	}
+	mentions, err := s.store.ListMentionsByState(r.Context(), states...)
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	// Popular posts have many mentions, so each analysis is fetched once
+	fetched := map[string]AnalysisView{}
+	views := make([]MentionView, 0, len(mentions))
+	for _, mention := range mentions {
+		views = append(views, DescribeMention(r.Context(), s.analyzer, mention, fetched))
+	}
+	writeAdminJSON(w, http.StatusOK, views)
+}
+
+// Shows a mention with the state of its analyses and the replies posted to it
+func (s *AdminService) handleGetMention(w http.ResponseWriter, r *http.Request) {
+	mention, ok := s.findMention(w, r)
+	if !ok {
+		return
+	}
+	replies, err := s.store.FindRepliesForMention(r.Context(), mention.ID)
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	view := DescribeMention(r.Context(), s.analyzer, *mention, map[string]AnalysisView{})
+	view.Replies = DescribeReplies(replies)
+	writeAdminJSON(w, http.StatusOK, view)
+}
+
+func (s *AdminService) handleDeleteMention(w http.ResponseWriter, r *http.Request) {
+	mention, ok := s.findMention(w, r)
+	if !ok {
+		return
+	}
+	if err := s.store.DeleteMention(r.Context(), mention.ID); err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	log.WithField("id", mention.ID).Warn("mention deleted through the admin API")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Makes the responder reply to a mention again, e.g. after its reply was deleted
+func (s *AdminService) handleReopenMention(w http.ResponseWriter, r *http.Request) {
+	reopened, err := s.store.ReopenMention(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !reopened {
+		writeAdminJSON(w, http.StatusNotFound, map[string]string{"error": "no such mention"})
+		return
+	}
+	log.WithField("id", r.PathValue("id")).Info("mention reopened through the admin API")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Puts a failed or dead-lettered mention back in the queue
+func (s *AdminService) handleRequeueMention(w http.ResponseWriter, r *http.Request) {
+	requeued, err := s.store.RequeueMention(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !requeued {
+		writeAdminJSON(w, http.StatusConflict, map[string]string{"error": "no failed or abandoned mention with that ID"})
+		return
+	}
+	log.WithField("id", r.PathValue("id")).Info("mention requeued through the admin API")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+/*
+Asks the platform's watcher to poll now. Only the replica leading the platform polls, so with several
+replicas this only works if the request reaches the leader; the others answer 409 so the caller can try again.
+*/
+func (s *AdminService) handlePoll(w http.ResponseWriter, r *http.Request) {
+	platform, err := model.ParsePlatform(r.PathValue("platform"))
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+	pollNow, ok := s.pollers[platform]
+	if !ok {
+		writeAdminJSON(w, http.StatusNotFound, map[string]string{"error": "platform isn't being watched"})
+		return
+	}
+	if !pollNow() {
+		writeAdminJSON(w, http.StatusConflict, map[string]string{"error": "this replica isn't polling the platform; try again to reach the one that is"})
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Gets the mention named in the path, writing a response and returning false if there isn't one
+func (s *AdminService) findMention(w http.ResponseWriter, r *http.Request) (*model.Mention, bool) {
+	mention, err := s.store.GetMention(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if mention == nil {
+		writeAdminJSON(w, http.StatusNotFound, map[string]string{"error": "no such mention"})
+		return nil, false
+	}
+	return mention, true
+}
+
+/*
+Describes a mention, with the state of its analyses fetched from analyzer unless they're already in fetched.
+With a nil analyzer, the analyses are left out.
+*/
+func DescribeMention(ctx context.Context, analyzer AdminAnalyzer, mention model.Mention, fetched map[string]AnalysisView) MentionView {
+	view := MentionView{
+		ID:            mention.ID,
+		Platform:      mention.Platform,
+		PlatformID:    mention.PlatformID,
+		UserName:      mention.PlatformUserName,
+		Enqueued:      mention.Enqueued,
+		State:         mention.State,
+		Attempts:      mention.Attempts,
+		LastError:     mention.LastError,
+		NextAttemptAt: mention.NextAttemptAt,
+		MediaPostURL:  mention.MediaPostURL,
+		FailureReason: mention.FailureReason,
+		Command:       string(mention.Command),
+		TraceID:       tracing.TraceID(mention.TraceParent),
+	}
+	if analyzer == nil {
+		return view
+	}
+	for _, mediaID := range mention.MediaIDs {
+		analysis, ok := fetched[mediaID]
+		if !ok {
+			analysis = AnalysisView{MediaID: mediaID}
+			if result, err := analyzer.GetAnalysis(ctx, mediaID); err != nil {
+				analysis.Error = err.Error()
+			} else {
+				analysis.State = result.State
+				analysis.Verdict = result.Verdict
+				analysis.Errors = result.Errors
+			}
+			fetched[mediaID] = analysis
+		}
+		view.Analyses = append(view.Analyses, analysis)
+	}
+	return view
+}
+
+func DescribeReplies(replies []model.Reply) []ReplyView {
+	views := make([]ReplyView, 0, len(replies))
+	for _, reply := range replies {
+		views = append(views, ReplyView{
+			ID:          reply.ID,
+			PlatformID:  reply.PlatformID,
+			Type:        reply.Type,
+			Replied:     reply.Replied,
+			Placeholder: reply.Placeholder,
+			Superseded:  reply.Superseded,
+		})
+	}
+	return views
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeAdminError(w http.ResponseWriter, status int, err error) {
+	if status >= http.StatusInternalServerError {
+		log.Errorf("admin request failed: %v", err)
+	}
+	writeAdminJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/truemediaorg/socialbot/database/db"
+	"github.com/truemediaorg/socialbot/model"
+	"github.com/truemediaorg/socialbot/truemedia"
+)
+
+type fakeAdminStore struct {
+	mentions map[string]model.Mention
+	reopened []string
+}
+
+func (s *fakeAdminStore) ListMentionsByState(ctx context.Context, states ...db.MentionState) ([]model.Mention, error) {
+	var mentions []model.Mention
+	for _, mention := range s.mentions {
+		for _, state := range states {
+			if mention.State == state {
+				mentions = append(mentions, mention)
+			}
+		}
+	}
+	return mentions, nil
+}
+
+func (s *fakeAdminStore) GetMention(ctx context.Context, mentionID string) (*model.Mention, error) {
+	mention, ok := s.mentions[mentionID]
+	if !ok {
+		return nil, nil
+	}
+	return &mention, nil
+}
+
+func (s *fakeAdminStore) FindRepliesForMention(ctx context.Context, mentionID string) ([]model.Reply, error) {
+	return []model.Reply{{ID: "r1", MentionID: mentionID, PlatformID: "9001", Type: db.ReplyTypeFinal}}, nil
+}
+
+func (s *fakeAdminStore) DeleteMention(ctx context.Context, mentionID string) error {
+	delete(s.mentions, mentionID)
+	return nil
+}
+
+func (s *fakeAdminStore) RequeueMention(ctx context.Context, mentionID string) (bool, error) {
+	return false, nil
+}
+
+func (s *fakeAdminStore) ReopenMention(ctx context.Context, mentionID string) (bool, error) {
+	if _, ok := s.mentions[mentionID]; !ok {
+		return false, nil
+	}
+	s.reopened = append(s.reopened, mentionID)
+	return true, nil
+}
+
+type fakeAdminAnalyzer struct {
+	calls int
+}
+
+func (a *fakeAdminAnalyzer) GetAnalysis(ctx context.Context, mediaID string) (*truemedia.GetResultResponse, error) {
+	a.calls++
+	return &truemedia.GetResultResponse{State: truemedia.AnalysisStateProcessing}, nil
+}
+
+func newTestAdminService() (*AdminService, *fakeAdminStore, *fakeAdminAnalyzer) {
+	store := &fakeAdminStore{mentions: map[string]model.Mention{
+		"m1": {ID: "m1", Platform: model.PlatformX, State: db.MentionStateAnalyzing, MediaIDs: []string{"media1"}},
+		"m2": {ID: "m2", Platform: model.PlatformX, State: db.MentionStateQueued, MediaIDs: []string{"media1"}},
+		"m3": {ID: "m3", Platform: model.PlatformX, State: db.MentionStateReplied},
+	}}
+	analyzer := &fakeAdminAnalyzer{}
+	return &AdminService{token: "secret", store: store, analyzer: analyzer, pollers: map[model.Platform]func() bool{}}, store, analyzer
+}
+
+func adminRequest(handler http.Handler, method string, path string, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestAdminRejectsBadToken(t *testing.T) {
+	service, _, _ := newTestAdminService()
+	handler := service.Handler()
+
+	assert.Equal(t, http.StatusUnauthorized, adminRequest(handler, http.MethodGet, "/admin/mentions", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, adminRequest(handler, http.MethodGet, "/admin/mentions", "wrong").Code)
+	assert.Equal(t, http.StatusOK, adminRequest(handler, http.MethodGet, "/admin/mentions", "secret").Code)
+}
+
+func TestAdminMentions(t *testing.T) {
+	service, store, analyzer := newTestAdminService()
+	polls := 0
+	service.AddPoller(model.PlatformX, func() bool { polls++; return true })
+	service.AddPoller(model.PlatformBluesky, func() bool { return false })
+	handler := service.Handler()
+
+	// Finished mentions aren't listed, and the analysis both pending mentions share is fetched once
+	recorder := adminRequest(handler, http.MethodGet, "/admin/mentions", "secret")
+	var mentions []MentionView
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &mentions))
+	assert.Len(t, mentions, 2)
+	assert.Equal(t, truemedia.AnalysisStateProcessing, mentions[0].Analyses[0].State)
+	assert.Equal(t, 1, analyzer.calls)
+
+	recorder = adminRequest(handler, http.MethodGet, "/admin/mentions/m3", "secret")
+	var mention MentionView
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &mention))
+	assert.Equal(t, db.ReplyTypeFinal, mention.Replies[0].Type)
+	assert.Equal(t, http.StatusNotFound, adminRequest(handler, http.MethodGet, "/admin/mentions/nope", "secret").Code)
+
+	assert.Equal(t, http.StatusAccepted, adminRequest(handler, http.MethodPost, "/admin/mentions/m3/reply", "secret").Code)
+	assert.Equal(t, []string{"m3"}, store.reopened)
+	assert.Equal(t, http.StatusConflict, adminRequest(handler, http.MethodPost, "/admin/mentions/m3/requeue", "secret").Code)
+
+	assert.Equal(t, http.StatusNoContent, adminRequest(handler, http.MethodDelete, "/admin/mentions/m3", "secret").Code)
+	assert.NotContains(t, store.mentions, "m3")
+
+	assert.Equal(t, http.StatusAccepted, adminRequest(handler, http.MethodPost, "/admin/watchers/x/poll", "secret").Code)
+	assert.Equal(t, 1, polls)
+	assert.Equal(t, http.StatusConflict, adminRequest(handler, http.MethodPost, "/admin/watchers/bluesky/poll", "secret").Code)
+	assert.Equal(t, http.StatusNotFound, adminRequest(handler, http.MethodPost, "/admin/watchers/reddit/poll", "secret").Code)
+}
@@ -0,0 +1,308 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/truemediaorg/socialbot/bluesky"
+	"github.com/truemediaorg/socialbot/config"
+	"github.com/truemediaorg/socialbot/model"
+	"github.com/truemediaorg/socialbot/platform"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	blueskyPollInterval = 1 * time.Minute
+	// Maximum page size for listNotifications
+	blueskyNotificationPageSize = 100
+	// Posts are limited to 300 graphemes. Counting runes is stricter, so it's a safe stand-in.
+	blueskyMaxPostLength = 300
+	// How long to back off if the PDS rate limits the bot without saying when the limit resets
+	blueskyDefaultRateLimitWait = 5 * time.Minute
+	// Layout of the time at the start of a polling cursor (see blueskyCursor)
+	blueskyCursorTimeLayout = "2006-01-02T15:04:05.000000Z"
+)
+
+/*
+BlueskyService watches and replies on Bluesky. Mentions are stored by AT URI, since a record key is only
+unique within its author's repo. The bot's own replies are all in its repo, so they're stored by record key.
+*/
+type BlueskyService struct {
+	client *bluesky.Client
+}
+
+func NewBlueskyService(cfg config.Config, secretsManagerClient *secretsmanager.Client) *BlueskyService {
+	// Get the Bluesky secrets from AWS Secrets Manager
+	result, err := secretsManagerClient.GetSecretValue(context.Background(), &secretsmanager.GetSecretValueInput{SecretId: aws.String(cfg.Bluesky.SecretPath)})
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	var blueskySecrets config.BlueskySecretData
+	err = json.Unmarshal([]byte(*result.SecretString), &blueskySecrets)
+	if err != nil {
+		log.Panicf("bluesky secrets read error: %v", err)
+	}
+
+	client := bluesky.NewClient(blueskySecrets.Identifier, blueskySecrets.AppPassword, cfg.Bluesky.ServiceURL)
+	log.Infof("Bluesky client initialized. Host: %s", cfg.Bluesky.ServiceURL.String())
+
+	return &BlueskyService{
+		client: client,
+	}
+}
+
+func (s *BlueskyService) Platform() model.Platform {
+	return model.PlatformBluesky
+}
+
+func (s *BlueskyService) Account() string {
+	return s.client.Identifier()
+}
+
+/*
+The bot may sign in with its DID or an email rather than its handle, so the handle people mention it by comes
+from the session. The session is already there by the time mentions are parsed, so this doesn't usually make a call.
+*/
+func (s *BlueskyService) Handle() string {
+	handle, err := s.client.Handle(context.Background())
+	if err != nil {
+		log.WithError(err).Warn("Couldn't get the bot's Bluesky handle, falling back to the identifier it signs in with")
+		return s.client.Identifier()
+	}
+	return handle
+}
+
+func (s *BlueskyService) PollInterval() time.Duration {
+	return blueskyPollInterval
+}
+
+/*
+Gets all mention notifications the bot received after the cursor, or within platform.InitialBacklog without
+one. Record keys are picked by the author's
+client, so a backdated post, or one that took a while to be indexed, can have an older key than mentions
+already seen; the cursor is when the notification was indexed instead. Notifications come back newest-first,
+so this pages backwards until it reaches the cursor. Returned mentions are re-sorted to oldest-first to match
+the other platforms.
+*/
+func (s *BlueskyService) GetMentionsSince(ctx context.Context, cursor string) ([]platform.Mention, error) {
+	var mentions []platform.Mention
+	pageCursor := ""
+	for reachedCursor := false; !reachedCursor; {
+		log.WithField("cursor", cursor).WithField("pageCursor", pageCursor).Info("requesting bluesky notifications")
+		page, err := s.client.ListNotifications(ctx, pageCursor, blueskyNotificationPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, notification := range page.Notifications {
+			if notification.Reason != bluesky.NotificationReasonMention {
+				continue
+			}
+			_, _, recordKey, err := bluesky.ParseATURI(notification.URI)
+			if err != nil {
+				log.Warnf("skipping notification: %v", err)
+				continue
+			}
+			notificationCursor := blueskyCursor(notification)
+			if cursor != "" {
+				after, done := blueskyAfterCursor(notification, notificationCursor, recordKey, cursor)
+				if done {
+					reachedCursor = true
+					break
+				}
+				if !after {
+					continue
+				}
+			} else if time.Since(notification.IndexedAt) > platform.InitialBacklog {
+				reachedCursor = true
+				break
+			}
+			mention, err := s.mentionFromNotification(ctx, notification)
+			if err != nil {
+				return nil, err
+			}
+			mention.Cursor = notificationCursor
+			mentions = append(mentions, mention)
+		}
+		pageCursor = page.Cursor
+		if pageCursor == "" || len(page.Notifications) == 0 {
+			break
+		}
+	}
+	slices.SortFunc(mentions, func(a, b platform.Mention) int {
+		return strings.Compare(a.Cursor, b.Cursor)
+	})
+	return mentions, nil
+}
+
+/*
+Turns a notification into a polling cursor: when it was indexed, then a hash of its AT URI to order
+notifications indexed at the same moment. Cursors are compared by length first, and these are always the
+same length, longer than the record keys older versions stored, so those cursors move on to these the first
+time they advance.
+*/
+func blueskyCursor(notification bluesky.Notification) string {
+	hash := sha256.Sum256([]byte(notification.URI))
+	return notification.IndexedAt.UTC().Format(blueskyCursorTimeLayout) + hex.EncodeToString(hash[:])
+}
+
+/*
+Whether a notification came after the cursor, and whether paging can stop because everything from here on
+came before it. Notifications indexed at the same moment aren't listed in cursor order, so paging carries on
+through them. Cursors from before indexing times were used, and the newest queued mention the watcher falls
+back on without a cursor, are record keys or AT URIs, so those are compared with the notification's record
+key instead.
+*/
+func blueskyAfterCursor(notification bluesky.Notification, notificationCursor string, recordKey string, cursor string) (after bool, done bool) {
+	cursorTime, err := time.Parse(blueskyCursorTimeLayout, cursor[:min(len(blueskyCursorTimeLayout), len(cursor))])
+	if err != nil {
+		if _, _, cursorKey, err := bluesky.ParseATURI(cursor); err == nil {
+			cursor = cursorKey
+		}
+		return recordKey > cursor, recordKey <= cursor
+	}
+	return notificationCursor > cursor, notification.IndexedAt.Before(cursorTime)
+}
+
+func (s *BlueskyService) PostReply(ctx context.Context, parentPostURL string, message string) (string, error) {
+	actor, recordKey, err := bluesky.DeconstructPostURL(parentPostURL)
+	if err != nil {
+		return "", err
+	}
+	did := actor
+	if !strings.HasPrefix(actor, "did:") {
+		if did, err = s.client.ResolveHandle(ctx, actor); err != nil {
+			return "", err
+		}
+	}
+	return s.replyTo(ctx, bluesky.ConstructATURI(did, bluesky.CollectionPost, recordKey), message)
+}
+
+func (s *BlueskyService) PostThreadedReply(ctx context.Context, replyID string, message string) (string, error) {
+	did, err := s.client.DID(ctx)
+	if err != nil {
+		return "", err
+	}
+	return s.replyTo(ctx, bluesky.ConstructATURI(did, bluesky.CollectionPost, replyID), message)
+}
+
+// Replies to the post with the given AT URI and returns the record key of the reply
+func (s *BlueskyService) replyTo(ctx context.Context, uri string, message string) (string, error) {
+	parent, err := s.client.GetPost(ctx, uri)
+	if err != nil {
+		return "", err
+	}
+
+	// Replies point at both the post being replied to and the top of its thread
+	parentRef := bluesky.StrongRef{URI: parent.URI, CID: parent.CID}
+	reply := bluesky.ReplyRef{Root: parentRef, Parent: parentRef}
+	if parent.Record.Reply != nil {
+		reply.Root = parent.Record.Reply.Root
+	}
+
+	text := fitToLength(message, blueskyMaxPostLength)
+	created, err := s.client.CreatePost(ctx, bluesky.PostRecord{
+		Text:      text,
+		CreatedAt: time.Now().UTC(),
+		Reply:     &reply,
+		Facets:    s.facetsFor(ctx, text),
+	})
+	if err != nil {
+		return "", err
+	}
+	_, _, replyKey, err := bluesky.ParseATURI(created.URI)
+	if err != nil {
+		return "", err
+	}
+	return replyKey, nil
+}
+
+func (s *BlueskyService) ClassifyError(err error) platform.APIError {
+	if errors.Is(err, bluesky.ErrPostNotFound) {
+		return platform.APIError{Kind: platform.APIErrorKindPostDeleted, Detail: err.Error()}
+	}
+	var xrpcError *bluesky.XRPCError
+	if errors.As(err, &xrpcError) {
+		switch {
+		case xrpcError.StatusCode == http.StatusTooManyRequests || xrpcError.Name == "RateLimitExceeded":
+			retryAt := xrpcError.RateLimitReset
+			if retryAt.IsZero() {
+				retryAt = time.Now().Add(blueskyDefaultRateLimitWait)
+			}
+			return platform.APIError{Kind: platform.APIErrorKindRateLimited, RetryAt: retryAt, Detail: xrpcError.Message}
+		case xrpcError.Name == "NotFound" || xrpcError.Name == "RecordNotFound":
+			return platform.APIError{Kind: platform.APIErrorKindPostDeleted, Detail: xrpcError.Message}
+		}
+	}
+	return platform.APIError{Kind: platform.APIErrorKindUnknown, Detail: err.Error()}
+}
+
+// Finds the replied-to post if it carries media, and converts the mention to its platform-agnostic form
+func (s *BlueskyService) mentionFromNotification(ctx context.Context, notification bluesky.Notification) (platform.Mention, error) {
+	mention := platform.Mention{
+		PlatformID:     notification.URI,
+		AuthorUserName: notification.Author.Handle,
+		Text:           notification.Record.Text,
+	}
+	if len(notification.Record.Langs) > 0 {
+		mention.Language = notification.Record.Langs[0]
+	}
+	if notification.Record.Reply == nil {
+		return mention, nil
+	}
+	parent, err := s.client.GetPost(ctx, notification.Record.Reply.Parent.URI)
+	if err != nil {
+		if errors.Is(err, bluesky.ErrPostNotFound) {
+			log.WithField("uri", notification.Record.Reply.Parent.URI).Warn("replied-to post not found; was it deleted?")
+			return mention, nil
+		}
+		return mention, err
+	}
+	if parent.HasMedia() {
+		mention.MediaPostURL, err = bluesky.ConstructPostURL(parent.Author.Handle, parent.URI)
+		if err != nil {
+			return mention, err
+		}
+		mention.MediaPostAuthorUserName = parent.Author.Handle
+	}
+	return mention, nil
+}
+
+// Makes links clickable and @handles into real mentions. Handles that can't be resolved are left as plain text.
+func (s *BlueskyService) facetsFor(ctx context.Context, text string) []bluesky.Facet {
+	facets, mentions := bluesky.DetectFacets(text)
+	for handle, index := range mentions {
+		did, err := s.client.ResolveHandle(ctx, handle)
+		if err != nil {
+			log.WithField("handle", handle).Warnf("unable to resolve handle for mention: %v", err)
+			continue
+		}
+		facets = append(facets, bluesky.Facet{
+			Index:    index,
+			Features: []bluesky.FacetFeature{{Type: bluesky.FacetTypeMention, DID: did}},
+		})
+	}
+	return facets
+}
+
+// Drops paragraphs from the end of a message until it fits within maxLength runes
+func fitToLength(message string, maxLength int) string {
+	for utf8.RuneCountInString(message) > maxLength {
+		cut := strings.LastIndex(message, "\n\n")
+		if cut < 0 {
+			return string([]rune(message)[:maxLength])
+		}
+		message = message[:cut]
+	}
+	return message
+}
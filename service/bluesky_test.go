@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/truemediaorg/socialbot/bluesky"
+	"github.com/truemediaorg/socialbot/platform"
+)
+
+const testBotDID = "did:plc:bot"
+
+// When the notifications the fake server serves were indexed, a minute apart
+var blueskyIndexedAt = time.Now().Add(-10 * time.Minute).Truncate(time.Millisecond)
+
+func blueskyMention(recordKey string, handle string, reply *bluesky.ReplyRef, indexedAt time.Time) bluesky.Notification {
+	return bluesky.Notification{
+		URI:       bluesky.ConstructATURI("did:plc:"+handle, bluesky.CollectionPost, recordKey),
+		Author:    bluesky.ProfileView{DID: "did:plc:" + handle, Handle: handle + ".bsky.social"},
+		Reason:    bluesky.NotificationReasonMention,
+		Record:    bluesky.PostRecord{Text: "@truemediabot.bsky.social is this real?", Reply: reply, Langs: []string{"en"}},
+		IndexedAt: indexedAt,
+	}
+}
+
+/*
+Serves two pages of notifications, with any newer notifications given on top, the posts they reply to, and
+post creation. Records which pages of notifications were asked for, and every post created.
+*/
+func newFakeBlueskyServer(t *testing.T, newer ...bluesky.Notification) (*httptest.Server, *[]string, *[]bluesky.CreateRecordRequest) {
+	imageEmbed := &bluesky.EmbedView{Type: bluesky.EmbedTypeImagesView}
+	// A post with an image, which is itself a reply in a thread started by a text post
+	rootRef := bluesky.StrongRef{URI: bluesky.ConstructATURI("did:plc:starter", bluesky.CollectionPost, "3j1"), CID: "cid-root"}
+	mediaRef := bluesky.StrongRef{URI: bluesky.ConstructATURI("did:plc:poster", bluesky.CollectionPost, "3j2"), CID: "cid-media"}
+	posts := map[string]bluesky.PostView{
+		rootRef.URI: {URI: rootRef.URI, CID: rootRef.CID, Author: bluesky.ProfileView{DID: "did:plc:starter", Handle: "starter.bsky.social"}},
+		mediaRef.URI: {
+			URI:    mediaRef.URI,
+			CID:    mediaRef.CID,
+			Author: bluesky.ProfileView{DID: "did:plc:poster", Handle: "poster.bsky.social"},
+			Record: bluesky.PostRecord{Reply: &bluesky.ReplyRef{Root: rootRef, Parent: rootRef}},
+			Embed:  imageEmbed,
+		},
+	}
+	deletedRef := bluesky.StrongRef{URI: bluesky.ConstructATURI("did:plc:gone", bluesky.CollectionPost, "3j0")}
+	pages := map[string]bluesky.ListNotificationsResponse{
+		"": {Cursor: "page2", Notifications: append(newer,
+			blueskyMention("3k3", "carol", &bluesky.ReplyRef{Root: rootRef, Parent: mediaRef}, blueskyIndexedAt.Add(3*time.Minute)),
+			bluesky.Notification{URI: bluesky.ConstructATURI("did:plc:erin", "app.bsky.feed.like", "3k4"), Reason: "like", IndexedAt: blueskyIndexedAt.Add(2 * time.Minute)},
+			blueskyMention("3k2", "bob", nil, blueskyIndexedAt.Add(time.Minute)),
+		)},
+		"page2": {Notifications: []bluesky.Notification{
+			blueskyMention("3k1", "alice", &bluesky.ReplyRef{Root: deletedRef, Parent: deletedRef}, blueskyIndexedAt),
+			// From before the bot was watching
+			blueskyMention("3j0", "heidi", nil, time.Now().Add(-30*24*time.Hour)),
+		}},
+	}
+	var requestedPages []string
+	var created []bluesky.CreateRecordRequest
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /xrpc/com.atproto.server.createSession", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(bluesky.Session{AccessJwt: "access", RefreshJwt: "refresh", Handle: "truemediabot.bsky.social", DID: testBotDID})
+	})
+	mux.HandleFunc("GET /xrpc/app.bsky.notification.listNotifications", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer access", r.Header.Get("Authorization"))
+		cursor := r.URL.Query().Get("cursor")
+		requestedPages = append(requestedPages, cursor)
+		json.NewEncoder(w).Encode(pages[cursor])
+	})
+	mux.HandleFunc("GET /xrpc/app.bsky.feed.getPosts", func(w http.ResponseWriter, r *http.Request) {
+		resp := bluesky.GetPostsResponse{Posts: []bluesky.PostView{}}
+		if post, ok := posts[r.URL.Query().Get("uris")]; ok {
+			resp.Posts = append(resp.Posts, post)
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("GET /xrpc/com.atproto.identity.resolveHandle", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("handle") {
+		case "poster.bsky.social":
+			json.NewEncoder(w).Encode(bluesky.ResolveHandleResponse{DID: "did:plc:poster"})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"InvalidRequest","message":"Unable to resolve handle"}`))
+		}
+	})
+	mux.HandleFunc("POST /xrpc/com.atproto.repo.createRecord", func(w http.ResponseWriter, r *http.Request) {
+		var req bluesky.CreateRecordRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		created = append(created, req)
+		json.NewEncoder(w).Encode(bluesky.CreateRecordResponse{URI: bluesky.ConstructATURI(testBotDID, bluesky.CollectionPost, "3new"), CID: "cid-new"})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &requestedPages, &created
+}
+
+func newTestBlueskyService(serverURL string) *BlueskyService {
+	serviceURL, _ := url.Parse(serverURL)
+	return &BlueskyService{client: bluesky.NewClient("truemediabot.bsky.social", "app-password", *serviceURL)}
+}
+
+func TestBlueskyGetMentionsSince(t *testing.T) {
+	alice := blueskyMention("3k1", "alice", nil, blueskyIndexedAt)
+	bob := blueskyMention("3k2", "bob", nil, blueskyIndexedAt.Add(time.Minute))
+	carol := blueskyMention("3k3", "carol", nil, blueskyIndexedAt.Add(3*time.Minute))
+
+	t.Run("returns mentions newer than the cursor oldest-first", func(t *testing.T) {
+		server, requestedPages, _ := newFakeBlueskyServer(t)
+		mentions, err := newTestBlueskyService(server.URL).GetMentionsSince(context.TODO(), blueskyCursor(alice))
+		assert.NoError(t, err)
+		assert.Equal(t, []platform.Mention{
+			{PlatformID: bob.URI, Cursor: blueskyCursor(bob), AuthorUserName: "bob.bsky.social", Text: "@truemediabot.bsky.social is this real?", Language: "en"},
+			{
+				PlatformID:              carol.URI,
+				Cursor:                  blueskyCursor(carol),
+				AuthorUserName:          "carol.bsky.social",
+				Text:                    "@truemediabot.bsky.social is this real?",
+				Language:                "en",
+				MediaPostURL:            "https://bsky.app/profile/poster.bsky.social/post/3j2",
+				MediaPostAuthorUserName: "poster.bsky.social",
+			},
+		}, mentions)
+		assert.Equal(t, []string{"", "page2"}, *requestedPages)
+	})
+
+	t.Run("stops paging once it reaches the cursor", func(t *testing.T) {
+		server, requestedPages, _ := newFakeBlueskyServer(t)
+		mentions, err := newTestBlueskyService(server.URL).GetMentionsSince(context.TODO(), blueskyCursor(carol))
+		assert.NoError(t, err)
+		assert.Empty(t, mentions)
+		assert.Equal(t, []string{""}, *requestedPages)
+	})
+
+	t.Run("still understands record key cursors", func(t *testing.T) {
+		server, _, _ := newFakeBlueskyServer(t)
+		mentions, err := newTestBlueskyService(server.URL).GetMentionsSince(context.TODO(), "3k1")
+		assert.NoError(t, err)
+		assert.Len(t, mentions, 2)
+		assert.Equal(t, bob.URI, mentions[0].PlatformID)
+	})
+
+	t.Run("picks up a backdated post", func(t *testing.T) {
+		// The notification is newer than the cursor, but the post's record key is older than ones already seen
+		backdated := blueskyMention("3j9", "erin", nil, blueskyIndexedAt.Add(4*time.Minute))
+		server, _, _ := newFakeBlueskyServer(t, backdated)
+		mentions, err := newTestBlueskyService(server.URL).GetMentionsSince(context.TODO(), blueskyCursor(carol))
+		assert.NoError(t, err)
+		assert.Len(t, mentions, 1)
+		assert.Equal(t, backdated.URI, mentions[0].PlatformID)
+	})
+
+	t.Run("picks up a mention indexed at the same moment as the cursor", func(t *testing.T) {
+		tied := blueskyMention("3k5", "frank", nil, carol.IndexedAt)
+		server, _, _ := newFakeBlueskyServer(t, tied)
+		cursor := min(blueskyCursor(tied), blueskyCursor(carol))
+		mentions, err := newTestBlueskyService(server.URL).GetMentionsSince(context.TODO(), cursor)
+		assert.NoError(t, err)
+		assert.Len(t, mentions, 1)
+		assert.Equal(t, max(blueskyCursor(tied), blueskyCursor(carol)), mentions[0].Cursor)
+	})
+
+	t.Run("tells apart posts by different authors with the same record key", func(t *testing.T) {
+		// Record keys are picked by each author's client, so nothing stops two authors using the same one
+		copycat := blueskyMention("3k3", "mallory", nil, blueskyIndexedAt.Add(4*time.Minute))
+		server, _, _ := newFakeBlueskyServer(t, copycat)
+		mentions, err := newTestBlueskyService(server.URL).GetMentionsSince(context.TODO(), blueskyCursor(bob))
+		assert.NoError(t, err)
+		assert.Len(t, mentions, 2)
+		assert.Equal(t, carol.URI, mentions[0].PlatformID)
+		assert.Equal(t, copycat.URI, mentions[1].PlatformID)
+		assert.NotEqual(t, mentions[0].PlatformID, mentions[1].PlatformID)
+	})
+
+	t.Run("still understands AT URIs of queued mentions as cursors", func(t *testing.T) {
+		server, _, _ := newFakeBlueskyServer(t)
+		mentions, err := newTestBlueskyService(server.URL).GetMentionsSince(context.TODO(), bob.URI)
+		assert.NoError(t, err)
+		assert.Len(t, mentions, 1)
+		assert.Equal(t, carol.URI, mentions[0].PlatformID)
+	})
+
+	t.Run("leaves out old mentions without a cursor, and keeps ones whose parent was deleted", func(t *testing.T) {
+		server, _, _ := newFakeBlueskyServer(t)
+		mentions, err := newTestBlueskyService(server.URL).GetMentionsSince(context.TODO(), "")
+		assert.NoError(t, err)
+		assert.Len(t, mentions, 3)
+		assert.Equal(t, alice.URI, mentions[0].PlatformID)
+		assert.Empty(t, mentions[0].MediaPostURL)
+	})
+}
+
+func TestBlueskyHandle(t *testing.T) {
+	server, _, _ := newFakeBlueskyServer(t)
+	serviceURL, _ := url.Parse(server.URL)
+
+	t.Run("comes from the session when signing in with a DID", func(t *testing.T) {
+		service := &BlueskyService{client: bluesky.NewClient(testBotDID, "app-password", *serviceURL)}
+		assert.Equal(t, testBotDID, service.Account())
+		assert.Equal(t, "truemediabot.bsky.social", service.Handle())
+	})
+
+	t.Run("falls back to the identifier when there's no session", func(t *testing.T) {
+		unreachable, _ := url.Parse("http://127.0.0.1:0")
+		service := &BlueskyService{client: bluesky.NewClient("bot@truemedia.example", "app-password", *unreachable)}
+		assert.Equal(t, "bot@truemedia.example", service.Handle())
+	})
+}
+
+func TestBlueskyPostReply(t *testing.T) {
+	server, _, created := newFakeBlueskyServer(t)
+	service := newTestBlueskyService(server.URL)
+
+	replyID, err := service.PostReply(context.TODO(), "https://bsky.app/profile/poster.bsky.social/post/3j2", "Verdict for @poster.bsky.social")
+	assert.NoError(t, err)
+	assert.Equal(t, "3new", replyID)
+	assert.Len(t, *created, 1)
+	record := (*created)[0]
+	assert.Equal(t, testBotDID, record.Repo)
+	// The reply goes under the media post, in the thread the media post is part of
+	assert.Equal(t, &bluesky.ReplyRef{
+		Root:   bluesky.StrongRef{URI: bluesky.ConstructATURI("did:plc:starter", bluesky.CollectionPost, "3j1"), CID: "cid-root"},
+		Parent: bluesky.StrongRef{URI: bluesky.ConstructATURI("did:plc:poster", bluesky.CollectionPost, "3j2"), CID: "cid-media"},
+	}, record.Record.Reply)
+	assert.Equal(t, []bluesky.Facet{{
+		Index:    bluesky.FacetIndex{ByteStart: 12, ByteEnd: 31},
+		Features: []bluesky.FacetFeature{{Type: bluesky.FacetTypeMention, DID: "did:plc:poster"}},
+	}}, record.Record.Facets)
+
+	_, err = service.PostReply(context.TODO(), "https://bsky.app/profile/did:plc:gone/post/3j0", "Verdict")
+	assert.Equal(t, platform.APIErrorKindPostDeleted, service.ClassifyError(err).Kind)
+}
+
+func TestBlueskyPostReplyToTopLevelPost(t *testing.T) {
+	server, _, created := newFakeBlueskyServer(t)
+	service := newTestBlueskyService(server.URL)
+
+	// A post that isn't a reply is the root of its own thread
+	_, err := service.PostReply(context.TODO(), "https://bsky.app/profile/did:plc:starter/post/3j1", "Verdict")
+	assert.NoError(t, err)
+	rootRef := bluesky.StrongRef{URI: bluesky.ConstructATURI("did:plc:starter", bluesky.CollectionPost, "3j1"), CID: "cid-root"}
+	assert.Equal(t, &bluesky.ReplyRef{Root: rootRef, Parent: rootRef}, (*created)[0].Record.Reply)
+}
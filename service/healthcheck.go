@@ -9,6 +9,7 @@ import (
 
 type Healthchecker struct {
 	Server http.Server
+	mux    *http.ServeMux
 }
 
 func NewHealthchecker(healthcheckPort int) Healthchecker {
@@ -19,9 +20,15 @@ func NewHealthchecker(healthcheckPort int) Healthchecker {
 			Addr:    fmt.Sprintf("0.0.0.0:%d", healthcheckPort),
 			Handler: mux,
 		},
+		mux: mux,
 	}
 }
 
+// Serves another endpoint alongside the healthcheck, such as a webhook
+func (h *Healthchecker) Handle(pattern string, handler http.Handler) {
+	h.mux.Handle(pattern, handler)
+}
+
 func handleHealthcheck() http.Handler {
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/truemediaorg/socialbot/config"
+	"github.com/truemediaorg/socialbot/mastodon"
+	"github.com/truemediaorg/socialbot/model"
+	"github.com/truemediaorg/socialbot/platform"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// Mastodon's default rate limit is 300 requests per 5 minutes, so it can be checked more often than X
+	mastodonPollInterval = 1 * time.Minute
+	// Maximum page size the notifications endpoint allows
+	mastodonNotificationPageSize = 40
+	// How long to back off if the instance rate limits the bot without saying when the limit resets
+	mastodonDefaultRateLimitWait = 5 * time.Minute
+	// Cursors are notification IDs padded with zeros to this length, longer than any status ID (see mastodonCursor)
+	mastodonCursorLength = 20
+)
+
+type MastodonService struct {
+	client *mastodon.Client
+	// The bot's account, as username@instance
+	account string
+	// The bot's username on its own instance
+	userName string
+}
+
+func NewMastodonService(ctx context.Context, cfg config.Config, secretsManagerClient *secretsmanager.Client) *MastodonService {
+	// Get the Mastodon secrets from AWS Secrets Manager
+	result, err := secretsManagerClient.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(cfg.Mastodon.SecretPath)})
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	var mastodonSecrets config.MastodonSecretData
+	err = json.Unmarshal([]byte(*result.SecretString), &mastodonSecrets)
+	if err != nil {
+		log.Panicf("mastodon secrets read error: %v", err)
+	}
+
+	client := mastodon.NewClient(mastodonSecrets.AccessToken, cfg.Mastodon.InstanceURL)
+	log.Infof("Mastodon client initialized. Host: %s", cfg.Mastodon.InstanceURL.String())
+
+	// Resolve the bot's account, which the watcher's cursor is kept for
+	account, err := client.VerifyCredentials(ctx)
+	if err != nil {
+		log.Panicf("mastodon account lookup error: %v", err)
+	}
+
+	return &MastodonService{
+		client:   client,
+		account:  fmt.Sprintf("%s@%s", account.UserName, cfg.Mastodon.InstanceURL.Host),
+		userName: account.UserName,
+	}
+}
+
+func (s *MastodonService) Platform() model.Platform {
+	return model.PlatformMastadon
+}
+
+func (s *MastodonService) Account() string {
+	return s.account
+}
+
+func (s *MastodonService) Handle() string {
+	return s.userName
+}
+
+func (s *MastodonService) PollInterval() time.Duration {
+	return mastodonPollInterval
+}
+
+/*
+Gets all mentions of the bot that arrived after the cursor, or within platform.InitialBacklog without one.
+A status from another instance can federate long after it was written, with an ID older than statuses
+already seen, so the cursor is the notification ID rather than the status ID. Notifications come back
+newest-first, so this pages backwards until it reaches the cursor. Returned mentions are re-sorted to
+oldest-first to match the other platforms.
+*/
+func (s *MastodonService) GetMentionsSince(ctx context.Context, cursor string) ([]platform.Mention, error) {
+	var mentions []platform.Mention
+	maxID := ""
+	for reachedCursor := false; !reachedCursor; {
+		log.WithField("cursor", cursor).WithField("maxID", maxID).Info("requesting mastodon mention notifications")
+		notifications, err := s.client.GetMentionNotifications(ctx, maxID, mastodonNotificationPageSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(notifications) == 0 {
+			break
+		}
+		for _, notification := range notifications {
+			maxID = notification.ID
+			if notification.Type != mastodon.NotificationTypeMention || notification.Status == nil {
+				continue
+			}
+			if cursor != "" && !mastodonAfterCursor(notification, cursor) {
+				reachedCursor = true
+				break
+			}
+			if cursor == "" && time.Since(notification.CreatedAt) > platform.InitialBacklog {
+				reachedCursor = true
+				break
+			}
+			mention, err := s.mentionFromStatus(ctx, *notification.Status)
+			if err != nil {
+				return nil, err
+			}
+			mention.Cursor = mastodonCursor(notification.ID)
+			mentions = append(mentions, mention)
+		}
+	}
+	slices.SortFunc(mentions, func(a, b platform.Mention) int {
+		return mastodon.CompareIDs(a.Cursor, b.Cursor)
+	})
+	return mentions, nil
+}
+
+/*
+Turns a notification ID into a polling cursor. Cursors are compared by length first, so padding notification
+IDs to 20 digits puts them after any status ID, which fits in 19; an existing status ID cursor moves on to
+notification IDs the first time it advances. Status IDs never start with a zero, so the two can be told apart.
+*/
+func mastodonCursor(notificationID string) string {
+	return strings.Repeat("0", max(mastodonCursorLength-len(notificationID), 0)) + notificationID
+}
+
+/*
+Whether a notification arrived after the cursor. Cursors from before notification IDs were used, and the newest
+queued mention the watcher falls back on without a cursor, are status IDs, so those are compared with the
+notification's status instead.
+*/
+func mastodonAfterCursor(notification mastodon.Notification, cursor string) bool {
+	if strings.HasPrefix(cursor, "0") {
+		return mastodon.CompareIDs(notification.ID, strings.TrimLeft(cursor, "0")) > 0
+	}
+	return mastodon.CompareIDs(notification.Status.ID, cursor) > 0
+}
+
+func (s *MastodonService) PostReply(ctx context.Context, parentPostURL string, message string) (string, error) {
+	// The post URL may belong to another instance, so find this instance's ID for it
+	parent, err := s.client.LookupStatus(ctx, parentPostURL)
+	if err != nil {
+		return "", err
+	}
+	// Tie the idempotency key to the content so a retried reply isn't posted twice
+	hash := sha256.Sum256([]byte(parent.ID + message))
+	status, err := s.client.CreateStatus(ctx, mastodon.CreateStatusRequest{
+		Status:      message,
+		InReplyToID: parent.ID,
+	}, hex.EncodeToString(hash[:]))
+	if err != nil {
+		return "", err
+	}
+	return status.ID, nil
+}
+
+func (s *MastodonService) PostThreadedReply(ctx context.Context, replyID string, message string) (string, error) {
+	// The bot's own replies live on this instance, so their IDs can be used directly
+	hash := sha256.Sum256([]byte(replyID + message))
+	status, err := s.client.CreateStatus(ctx, mastodon.CreateStatusRequest{
+		Status:      message,
+		InReplyToID: replyID,
+	}, hex.EncodeToString(hash[:]))
+	if err != nil {
+		return "", err
+	}
+	return status.ID, nil
+}
+
+func (s *MastodonService) EditReply(ctx context.Context, replyID string, message string) error {
+	_, err := s.client.EditStatus(ctx, replyID, message)
+	return err
+}
+
+func (s *MastodonService) ClassifyError(err error) platform.APIError {
+	if errors.Is(err, mastodon.ErrStatusNotFound) {
+		return platform.APIError{Kind: platform.APIErrorKindPostDeleted, Detail: err.Error()}
+	}
+	var apiError *mastodon.APIError
+	if errors.As(err, &apiError) {
+		switch apiError.StatusCode {
+		case http.StatusTooManyRequests:
+			retryAt := apiError.RateLimitReset
+			if retryAt.IsZero() {
+				retryAt = time.Now().Add(mastodonDefaultRateLimitWait)
+			}
+			return platform.APIError{Kind: platform.APIErrorKindRateLimited, RetryAt: retryAt, Detail: apiError.Message}
+		case http.StatusNotFound:
+			return platform.APIError{Kind: platform.APIErrorKindPostDeleted, Detail: apiError.Message}
+		}
+	}
+	return platform.APIError{Kind: platform.APIErrorKindUnknown, Detail: err.Error()}
+}
+
+// Finds the replied-to status carrying media, if any, and converts the mention to its platform-agnostic form
+func (s *MastodonService) mentionFromStatus(ctx context.Context, status mastodon.Status) (platform.Mention, error) {
+	mention := platform.Mention{
+		PlatformID:     status.ID,
+		AuthorUserName: status.Account.Acct,
+		Text:           status.Text(),
+		Language:       status.Language,
+	}
+	if status.InReplyToID == "" {
+		return mention, nil
+	}
+	parent, err := s.client.GetStatus(ctx, status.InReplyToID)
+	if err != nil {
+		if errors.Is(err, mastodon.ErrStatusNotFound) {
+			log.WithField("statusID", status.InReplyToID).Warn("replied-to status not found; was it deleted?")
+			return mention, nil
+		}
+		return mention, err
+	}
+	if parent.HasMedia() {
+		mention.MediaPostURL = parent.URL
+		if mention.MediaPostURL == "" {
+			mention.MediaPostURL = parent.URI
+		}
+		mention.MediaPostAuthorUserName = parent.Account.Acct
+	}
+	return mention, nil
+}
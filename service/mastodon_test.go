@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/truemediaorg/socialbot/mastodon"
+	"github.com/truemediaorg/socialbot/platform"
+)
+
+// Serves just enough of the Mastodon API for the bot's needs, with any newer notifications given on top of the usual ones
+func newFakeMastodonServer(t *testing.T, newer ...mastodon.Notification) (*httptest.Server, *[]mastodon.CreateStatusRequest) {
+	mediaStatus := mastodon.Status{
+		ID:               "200",
+		URL:              "https://remote.example/@poster/9001",
+		Account:          mastodon.Account{Acct: "poster@remote.example"},
+		MediaAttachments: []mastodon.MediaAttachment{{ID: "m1", Type: "image"}},
+	}
+	textStatus := mastodon.Status{ID: "201", URL: "https://remote.example/@poster/9002"}
+	recently := time.Now().Add(-time.Minute)
+	notifications := append(newer, []mastodon.Notification{
+		{ID: "13", Type: mastodon.NotificationTypeMention, CreatedAt: recently, Status: &mastodon.Status{ID: "1002", InReplyToID: "201", Account: mastodon.Account{Acct: "carol"}}},
+		{ID: "12", Type: mastodon.NotificationTypeMention, CreatedAt: recently, Status: &mastodon.Status{ID: "1001", InReplyToID: "200", Account: mastodon.Account{Acct: "bob@other.example"}, Content: `<p><span class="h-card"><a href="https://mastodon.example/@TrueMediaBot" class="u-url mention">@<span>TrueMediaBot</span></a></span> details &amp; more</p>`}},
+		{ID: "11", Type: mastodon.NotificationTypeMention, CreatedAt: recently, Status: &mastodon.Status{ID: "999", Account: mastodon.Account{Acct: "alice"}}},
+		// From before the bot was watching
+		{ID: "10", Type: mastodon.NotificationTypeMention, CreatedAt: time.Now().Add(-30 * 24 * time.Hour), Status: &mastodon.Status{ID: "998", InReplyToID: "200", Account: mastodon.Account{Acct: "dave"}}},
+	}...)
+	var posted []mastodon.CreateStatusRequest
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/notifications", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Equal(t, "mention", r.URL.Query().Get("types[]"))
+		// Two notifications per page to exercise pagination
+		page := notifications
+		if maxID := r.URL.Query().Get("max_id"); maxID != "" {
+			page = nil
+			for _, n := range notifications {
+				if mastodon.CompareIDs(n.ID, maxID) < 0 {
+					page = append(page, n)
+				}
+			}
+		}
+		if len(page) > 2 {
+			page = page[:2]
+		}
+		json.NewEncoder(w).Encode(page)
+	})
+	mux.HandleFunc("GET /api/v1/statuses/{id}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.PathValue("id") {
+		case mediaStatus.ID:
+			json.NewEncoder(w).Encode(mediaStatus)
+		case textStatus.ID:
+			json.NewEncoder(w).Encode(textStatus)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"Record not found"}`))
+		}
+	})
+	mux.HandleFunc("GET /api/v2/search", func(w http.ResponseWriter, r *http.Request) {
+		results := mastodon.SearchResults{}
+		if r.URL.Query().Get("q") == mediaStatus.URL {
+			results.Statuses = append(results.Statuses, mediaStatus)
+		}
+		json.NewEncoder(w).Encode(results)
+	})
+	mux.HandleFunc("POST /api/v1/statuses", func(w http.ResponseWriter, r *http.Request) {
+		assert.NotEmpty(t, r.Header.Get("Idempotency-Key"))
+		var req mastodon.CreateStatusRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		posted = append(posted, req)
+		json.NewEncoder(w).Encode(mastodon.Status{ID: "5000", InReplyToID: req.InReplyToID})
+	})
+	return httptest.NewServer(mux), &posted
+}
+
+func newTestMastodonService(serverURL string) *MastodonService {
+	instanceURL, _ := url.Parse(serverURL)
+	return &MastodonService{client: mastodon.NewClient("token", *instanceURL)}
+}
+
+func TestMastodonGetMentionsSince(t *testing.T) {
+	server, _ := newFakeMastodonServer(t)
+	defer server.Close()
+	service := newTestMastodonService(server.URL)
+
+	expected := []platform.Mention{
+		{PlatformID: "999", Cursor: "00000000000000000011", AuthorUserName: "alice"},
+		{PlatformID: "1001", Cursor: "00000000000000000012", AuthorUserName: "bob@other.example", MediaPostURL: "https://remote.example/@poster/9001", MediaPostAuthorUserName: "poster@remote.example", Text: "@TrueMediaBot details & more"},
+		{PlatformID: "1002", Cursor: "00000000000000000013", AuthorUserName: "carol"},
+	}
+
+	t.Run("returns mentions newer than the cursor oldest-first", func(t *testing.T) {
+		mentions, err := service.GetMentionsSince(context.TODO(), mastodonCursor("10"))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, mentions)
+	})
+
+	t.Run("still understands status ID cursors", func(t *testing.T) {
+		mentions, err := service.GetMentionsSince(context.TODO(), "998")
+		assert.NoError(t, err)
+		assert.Equal(t, expected, mentions)
+	})
+
+	t.Run("leaves out old mentions without a cursor", func(t *testing.T) {
+		mentions, err := service.GetMentionsSince(context.TODO(), "")
+		assert.NoError(t, err)
+		assert.Equal(t, expected, mentions)
+	})
+
+	t.Run("picks up a remote status that federated late", func(t *testing.T) {
+		// The notification is newer than the cursor, but the status is older than ones already seen
+		late := mastodon.Notification{ID: "14", Type: mastodon.NotificationTypeMention, Status: &mastodon.Status{ID: "950", InReplyToID: "200", Account: mastodon.Account{Acct: "erin@slow.example"}}}
+		lateServer, _ := newFakeMastodonServer(t, late)
+		defer lateServer.Close()
+
+		mentions, err := newTestMastodonService(lateServer.URL).GetMentionsSince(context.TODO(), mastodonCursor("13"))
+		assert.NoError(t, err)
+		assert.Equal(t, []platform.Mention{
+			{PlatformID: "950", Cursor: "00000000000000000014", AuthorUserName: "erin@slow.example", MediaPostURL: "https://remote.example/@poster/9001", MediaPostAuthorUserName: "poster@remote.example"},
+		}, mentions)
+	})
+}
+
+func TestMastodonPostReply(t *testing.T) {
+	server, posted := newFakeMastodonServer(t)
+	defer server.Close()
+	service := newTestMastodonService(server.URL)
+
+	t.Run("replies to the local copy of the media status", func(t *testing.T) {
+		replyID, err := service.PostReply(context.TODO(), "https://remote.example/@poster/9001", "verdict")
+		assert.NoError(t, err)
+		assert.Equal(t, "5000", replyID)
+		assert.Equal(t, []mastodon.CreateStatusRequest{{Status: "verdict", InReplyToID: "200"}}, *posted)
+	})
+
+	t.Run("classifies missing statuses as deleted posts", func(t *testing.T) {
+		_, err := service.PostReply(context.TODO(), "https://remote.example/@poster/404", "verdict")
+		assert.Error(t, err)
+		assert.Equal(t, platform.APIErrorKindPostDeleted, service.ClassifyError(err).Kind)
+	})
+}
+
+func TestMastodonClassifyError(t *testing.T) {
+	service := &MastodonService{}
+	reset := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	apiError := service.ClassifyError(&mastodon.APIError{StatusCode: http.StatusTooManyRequests, RateLimitReset: reset})
+	assert.Equal(t, platform.APIErrorKindRateLimited, apiError.Kind)
+	assert.Equal(t, reset, apiError.RetryAt)
+
+	apiError = service.ClassifyError(&mastodon.APIError{StatusCode: http.StatusInternalServerError, Message: "oops"})
+	assert.Equal(t, platform.APIErrorKindUnknown, apiError.Kind)
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/truemediaorg/socialbot/config"
+	"github.com/truemediaorg/socialbot/model"
+	"github.com/truemediaorg/socialbot/platform"
+	"github.com/truemediaorg/socialbot/reddit"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// Reddit allows 100 requests per minute for OAuth clients
+	redditPollInterval = 1 * time.Minute
+	// Maximum page size for listings
+	redditInboxPageSize = 100
+	// How far up a comment thread to look for media before giving up
+	redditMaxParentDepth = 10
+	// How long to back off if Reddit rate limits the bot without saying when the limit resets
+	redditDefaultRateLimitWait = 5 * time.Minute
+)
+
+type RedditService struct {
+	client *reddit.Client
+}
+
+func NewRedditService(cfg config.Config, secretsManagerClient *secretsmanager.Client) *RedditService {
+	// Get the Reddit secrets from AWS Secrets Manager
+	result, err := secretsManagerClient.GetSecretValue(context.Background(), &secretsmanager.GetSecretValueInput{SecretId: aws.String(cfg.Reddit.SecretPath)})
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	var redditSecrets config.RedditSecretData
+	err = json.Unmarshal([]byte(*result.SecretString), &redditSecrets)
+	if err != nil {
+		log.Panicf("reddit secrets read error: %v", err)
+	}
+
+	client := reddit.NewClient(reddit.Credentials{
+		ClientID:     redditSecrets.ClientID,
+		ClientSecret: redditSecrets.ClientSecret,
+		UserName:     redditSecrets.UserName,
+		Password:     redditSecrets.Password,
+	}, reddit.DefaultAPIURL, reddit.DefaultTokenURL)
+	log.Infof("Reddit client initialized. User: %s", redditSecrets.UserName)
+
+	return &RedditService{
+		client: client,
+	}
+}
+
+func (s *RedditService) Platform() model.Platform {
+	return model.PlatformReddit
+}
+
+func (s *RedditService) Account() string {
+	return s.client.UserName()
+}
+
+func (s *RedditService) Handle() string {
+	return s.client.UserName()
+}
+
+func (s *RedditService) PollInterval() time.Duration {
+	return redditPollInterval
+}
+
+/*
+Gets all username mentions in the bot's inbox whose comment ID is newer than the cursor, or that were posted
+within platform.InitialBacklog without one. The inbox is newest-first, so this pages backwards until it reaches the cursor.
+Returned mentions are re-sorted to oldest-first to match the other platforms.
+*/
+func (s *RedditService) GetMentionsSince(ctx context.Context, cursor string) ([]platform.Mention, error) {
+	var mentions []platform.Mention
+	after := ""
+	for reachedCursor := false; !reachedCursor; {
+		log.WithField("cursor", cursor).WithField("after", after).Info("requesting reddit inbox")
+		inbox, err := s.client.GetInbox(ctx, after, redditInboxPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range inbox.Data.Children {
+			if item.Kind != reddit.KindComment || item.Data.Type != reddit.InboxTypeUsernameMention {
+				continue
+			}
+			if cursor != "" && reddit.CompareIDs(item.Data.ID, cursor) <= 0 {
+				reachedCursor = true
+				break
+			}
+			if cursor == "" && time.Since(time.Unix(int64(item.Data.CreatedAt), 0)) > platform.InitialBacklog {
+				reachedCursor = true
+				break
+			}
+			mention, err := s.mentionFromInboxItem(ctx, item)
+			if err != nil {
+				return nil, err
+			}
+			mentions = append(mentions, mention)
+		}
+		after = inbox.Data.After
+		if after == "" {
+			break
+		}
+	}
+	slices.SortFunc(mentions, func(a, b platform.Mention) int {
+		return reddit.CompareIDs(a.PlatformID, b.PlatformID)
+	})
+	return mentions, nil
+}
+
+func (s *RedditService) PostReply(ctx context.Context, parentPostURL string, message string) (string, error) {
+	parentFullname, err := reddit.FullnameFromPermalink(parentPostURL)
+	if err != nil {
+		return "", err
+	}
+	comment, err := s.client.Comment(ctx, parentFullname, message)
+	if err != nil {
+		return "", err
+	}
+	return comment.Data.ID, nil
+}
+
+func (s *RedditService) PostThreadedReply(ctx context.Context, replyID string, message string) (string, error) {
+	comment, err := s.client.Comment(ctx, fmt.Sprintf("%s_%s", reddit.KindComment, replyID), message)
+	if err != nil {
+		return "", err
+	}
+	return comment.Data.ID, nil
+}
+
+func (s *RedditService) EditReply(ctx context.Context, replyID string, message string) error {
+	_, err := s.client.EditText(ctx, fmt.Sprintf("%s_%s", reddit.KindComment, replyID), message)
+	return err
+}
+
+func (s *RedditService) ClassifyError(err error) platform.APIError {
+	if errors.Is(err, reddit.ErrThingNotFound) {
+		return platform.APIError{Kind: platform.APIErrorKindPostDeleted, Detail: err.Error()}
+	}
+	var apiError *reddit.APIError
+	if errors.As(err, &apiError) {
+		switch {
+		case apiError.StatusCode == http.StatusTooManyRequests || apiError.Code == "RATELIMIT":
+			retryAt := apiError.RateLimitReset
+			if retryAt.IsZero() {
+				retryAt = time.Now().Add(redditDefaultRateLimitWait)
+			}
+			return platform.APIError{Kind: platform.APIErrorKindRateLimited, RetryAt: retryAt, Detail: apiError.Message}
+		case apiError.Code == "DELETED_COMMENT" || apiError.Code == "DELETED_LINK":
+			return platform.APIError{Kind: platform.APIErrorKindPostDeleted, Detail: apiError.Message}
+		case apiError.Code == "THREAD_LOCKED" || apiError.Code == "TOO_OLD":
+			// Not deleted, but the bot will never be able to reply, so it's handled the same way
+			return platform.APIError{Kind: platform.APIErrorKindPostDeleted, Detail: apiError.Message}
+		}
+	}
+	return platform.APIError{Kind: platform.APIErrorKindUnknown, Detail: err.Error()}
+}
+
+// Walks up the comment tree from a mention to the nearest comment or submission carrying media
+func (s *RedditService) mentionFromInboxItem(ctx context.Context, item reddit.Thing) (platform.Mention, error) {
+	mention := platform.Mention{
+		PlatformID:     item.Data.ID,
+		AuthorUserName: item.Data.Author,
+		Text:           item.Data.Body,
+	}
+	parentFullname := item.Data.ParentID
+	for depth := 0; parentFullname != "" && depth < redditMaxParentDepth; depth++ {
+		parent, err := s.client.GetThing(ctx, parentFullname)
+		if err != nil {
+			if errors.Is(err, reddit.ErrThingNotFound) {
+				log.WithField("fullname", parentFullname).Warn("parent of mention not found; was it deleted?")
+				return mention, nil
+			}
+			return mention, err
+		}
+		if parent.HasMedia() {
+			mention.MediaPostURL = reddit.ConstructPermalinkURL(parent.Data.Permalink)
+			mention.MediaPostAuthorUserName = parent.Data.Author
+			return mention, nil
+		}
+		if parent.Kind == reddit.KindLink {
+			// Reached the submission without finding any media
+			return mention, nil
+		}
+		parentFullname = parent.Data.ParentID
+	}
+	return mention, nil
+}
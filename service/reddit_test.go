@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/truemediaorg/socialbot/platform"
+	"github.com/truemediaorg/socialbot/reddit"
+)
+
+func redditMention(id string, author string, parentID string, age time.Duration) reddit.Thing {
+	return reddit.Thing{Kind: reddit.KindComment, Data: reddit.ThingData{
+		ID:        id,
+		Name:      reddit.KindComment + "_" + id,
+		Author:    author,
+		CreatedAt: float64(time.Now().Add(-age).Unix()),
+		Body:      "u/TrueMediaBot is this real?",
+		ParentID:  parentID,
+		Type:      reddit.InboxTypeUsernameMention,
+	}}
+}
+
+// Serves a three-page inbox and the things its mentions reply to, recording which pages were asked for
+func newFakeRedditServer(t *testing.T) (*httptest.Server, *[]string) {
+	pages := map[string]reddit.ListingData{
+		"": {After: "t1_k4", Children: []reddit.Thing{
+			// Replies to a comment under a link with an image
+			redditMention("k5", "carol", "t1_c2", time.Minute),
+			{Kind: reddit.KindMessage, Data: reddit.ThingData{ID: "m1", Author: "spammer", Body: "hi"}},
+			{Kind: reddit.KindComment, Data: reddit.ThingData{ID: "k4", Author: "erin", ParentID: "t3_l1", Type: "comment_reply"}},
+		}},
+		"t1_k4": {After: "t1_k2", Children: []reddit.Thing{
+			// Replies to a text post
+			redditMention("k3", "bob", "t3_l2", 10*time.Minute),
+			// Replies to a deleted comment
+			redditMention("k2", "alice", "t1_gone", 20*time.Minute),
+		}},
+		"t1_k2": {Children: []reddit.Thing{
+			// From before the bot was watching
+			redditMention("k1", "dave", "t3_l1", 30*24*time.Hour),
+		}},
+	}
+	things := map[string]reddit.Thing{
+		"t1_c2":   {Kind: reddit.KindComment, Data: reddit.ThingData{ID: "c2", Author: "frank", ParentID: "t3_l1"}},
+		"t3_l1":   {Kind: reddit.KindLink, Data: reddit.ThingData{ID: "l1", Author: "poster", Permalink: "/r/pics/comments/l1/look/", PostHint: "image"}},
+		"t3_l2":   {Kind: reddit.KindLink, Data: reddit.ThingData{ID: "l2", Author: "writer", Permalink: "/r/AskReddit/comments/l2/words/"}},
+		"t1_gone": {Kind: reddit.KindComment, Data: reddit.ThingData{ID: "gone", Author: "[deleted]"}},
+	}
+	var requestedPages []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/access_token", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "token", "expires_in": 3600})
+	})
+	mux.HandleFunc("GET /message/inbox", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		after := r.URL.Query().Get("after")
+		requestedPages = append(requestedPages, after)
+		json.NewEncoder(w).Encode(reddit.Listing{Kind: "Listing", Data: pages[after]})
+	})
+	mux.HandleFunc("GET /api/info", func(w http.ResponseWriter, r *http.Request) {
+		listing := reddit.Listing{Kind: "Listing"}
+		if thing, ok := things[r.URL.Query().Get("id")]; ok {
+			listing.Data.Children = append(listing.Data.Children, thing)
+		}
+		json.NewEncoder(w).Encode(listing)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &requestedPages
+}
+
+func newTestRedditService(serverURL string) *RedditService {
+	client := reddit.NewClient(reddit.Credentials{ClientID: "client", ClientSecret: "secret", UserName: "TrueMediaBot", Password: "hunter2"}, serverURL, serverURL+"/api/v1/access_token")
+	return &RedditService{client: client}
+}
+
+func TestRedditGetMentionsSince(t *testing.T) {
+	mediaPostURL := "https://www.reddit.com/r/pics/comments/l1/look/"
+
+	t.Run("returns mentions newer than the cursor oldest-first, finding the media up the thread", func(t *testing.T) {
+		server, requestedPages := newFakeRedditServer(t)
+		mentions, err := newTestRedditService(server.URL).GetMentionsSince(context.TODO(), "k1")
+		assert.NoError(t, err)
+		assert.Equal(t, []platform.Mention{
+			{PlatformID: "k2", AuthorUserName: "alice", Text: "u/TrueMediaBot is this real?"},
+			{PlatformID: "k3", AuthorUserName: "bob", Text: "u/TrueMediaBot is this real?"},
+			{PlatformID: "k5", AuthorUserName: "carol", Text: "u/TrueMediaBot is this real?", MediaPostURL: mediaPostURL, MediaPostAuthorUserName: "poster"},
+		}, mentions)
+		assert.Equal(t, []string{"", "t1_k4", "t1_k2"}, *requestedPages)
+	})
+
+	t.Run("stops paging once it reaches the cursor", func(t *testing.T) {
+		server, requestedPages := newFakeRedditServer(t)
+		mentions, err := newTestRedditService(server.URL).GetMentionsSince(context.TODO(), "k3")
+		assert.NoError(t, err)
+		assert.Len(t, mentions, 1)
+		assert.Equal(t, []string{"", "t1_k4"}, *requestedPages)
+	})
+
+	t.Run("leaves out old mentions without a cursor", func(t *testing.T) {
+		server, _ := newFakeRedditServer(t)
+		mentions, err := newTestRedditService(server.URL).GetMentionsSince(context.TODO(), "")
+		assert.NoError(t, err)
+		assert.Len(t, mentions, 3)
+		assert.Equal(t, "k2", mentions[0].PlatformID)
+	})
+}
@@ -3,20 +3,25 @@ package service
 import (
 	"context"
 	"encoding/json"
-	"errors"
-	"time"
+	"net/http"
 
 	"github.com/truemediaorg/socialbot/config"
+	"github.com/truemediaorg/socialbot/metrics"
+	"github.com/truemediaorg/socialbot/tracing"
 	"github.com/truemediaorg/socialbot/truemedia"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type TruemediaService struct {
 	config config.TruemediaConfig
 	client *truemedia.Client
+	// Checked against analysis callbacks, so only TrueMedia can wake the responders
+	callbackSecret string
 }
 
 func NewTruemediaService(cfg config.Config, secretsManagerClient *secretsmanager.Client) *TruemediaService {
@@ -36,31 +41,57 @@ func NewTruemediaService(cfg config.Config, secretsManagerClient *secretsmanager
 		log.Panicf("truemedia secrets read error: %v", err)
 	}
 
-	client := truemedia.NewClient(trueMediaSecrets.ApiKey, cfg.Truemedia.ApiURL)
+	client := truemedia.NewClient(trueMediaSecrets.ApiKey, cfg.Truemedia.ApiURL, cfg.Truemedia.Timeout)
+	// Each attempt is timed separately, so retries show up as their own requests
+	client.HTTPClient.Transport = promhttp.InstrumentRoundTripperDuration(metrics.TruemediaRequestSeconds, http.DefaultTransport)
 	log.Infof("TrueMedia client initialized. Host: %s", cfg.Truemedia.ApiURL.String())
 
+	if cfg.Truemedia.CallbackURL.String() != "" && trueMediaSecrets.CallbackSecret == "" {
+		log.Fatal("truemedia callbacks need a callbackSecret in the truemedia secrets")
+	}
+
 	return &TruemediaService{
-		config: cfg.Truemedia,
-		client: client,
+		config:         cfg.Truemedia,
+		client:         client,
+		callbackSecret: trueMediaSecrets.CallbackSecret,
 	}
 }
 
-func (s *TruemediaService) ResolvePostMedia(postURL string) (string, error) {
-	resolve, err := s.client.ResolveMedia(postURL)
+/*
+Resolves the media in a post and returns the IDs of every item found, in the order they appear.
+If TrueMedia couldn't get any media out of the post, the error is a *truemedia.FailureError saying why.
+*/
+func (s *TruemediaService) ResolvePostMedia(ctx context.Context, postURL string) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "truemedia resolve media", tracing.AttributeMediaPostURL.String(postURL))
+	defer span.End()
+	resolve, err := s.client.ResolveMedia(ctx, postURL, s.config.CallbackURL.String())
 	if err != nil {
-		return "", err
+		tracing.RecordError(ctx, err)
+		return nil, err
+	}
+	if failure := resolve.Failure(); failure != nil {
+		tracing.RecordError(ctx, failure)
+		return nil, failure
 	}
-	if len(resolve.Media) == 0 {
-		// TODO: Consider adding pkg/errors
-		return "", errors.New("no media resolved")
+	mediaIDs := make([]string, 0, len(resolve.Media))
+	for _, media := range resolve.Media {
+		mediaIDs = append(mediaIDs, media.ID)
 	}
-	return resolve.Media[0].ID, nil
+	return mediaIDs, nil
 }
 
-func (s *TruemediaService) GetAnalysis(mediaID string) (*truemedia.GetResultResponse, error) {
-	return s.client.GetResults(mediaID)
+func (s *TruemediaService) GetAnalysis(ctx context.Context, mediaID string) (*truemedia.GetResultResponse, error) {
+	ctx, span := tracing.Start(ctx, "truemedia get results", tracing.AttributeMediaID.String(mediaID))
+	defer span.End()
+	result, err := s.client.GetResults(ctx, mediaID)
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.String("truemedia.state", string(result.State)), attribute.String("truemedia.verdict", string(result.Verdict)))
+	return result, nil
 }
 
-func (s *TruemediaService) ResolveInterval() time.Duration {
-	return s.config.ResolveInterval
+func (s *TruemediaService) CallbacksEnabled() bool {
+	return s.config.CallbackURL.String() != ""
 }
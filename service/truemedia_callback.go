@@ -0,0 +1,39 @@
+package service
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/truemediaorg/socialbot/truemedia"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+Serves the endpoint TrueMedia calls when an analysis finishes, handing the media ID to notify.
+Requests must carry the callback secret as a bearer token.
+*/
+func (s *TruemediaService) CallbackHandler(notify func(mediaID string)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.callbackSecret)) != 1 {
+			log.Warn("rejected analysis callback with a bad token")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var callback truemedia.AnalysisCallback
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&callback); err != nil || callback.ID == "" {
+			http.Error(w, "unable to parse callback", http.StatusBadRequest)
+			return
+		}
+		log.WithField("mediaId", callback.ID).WithField("state", callback.State).Debug("received analysis callback")
+		notify(callback.ID)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func callbackRequest(handler http.Handler, method string, token string, body string) int {
+	req := httptest.NewRequest(method, "/callbacks/truemedia", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	return recorder.Code
+}
+
+func TestCallbackHandler(t *testing.T) {
+	service := &TruemediaService{callbackSecret: "callback-secret"}
+	var notified []string
+	handler := service.CallbackHandler(func(mediaID string) { notified = append(notified, mediaID) })
+	body := `{"id": "foo.mp4", "state": "COMPLETE"}`
+
+	t.Run("rejects other methods", func(t *testing.T) {
+		assert.Equal(t, http.StatusMethodNotAllowed, callbackRequest(handler, http.MethodGet, "callback-secret", ""))
+	})
+
+	t.Run("rejects a missing token", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, callbackRequest(handler, http.MethodPost, "", body))
+	})
+
+	t.Run("rejects the wrong token", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, callbackRequest(handler, http.MethodPost, "other-secret", body))
+	})
+
+	t.Run("rejects a callback without a media ID", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, callbackRequest(handler, http.MethodPost, "callback-secret", `{"id": "", "state": "COMPLETE"}`))
+	})
+
+	assert.Empty(t, notified)
+
+	t.Run("notifies about the media", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, callbackRequest(handler, http.MethodPost, "callback-secret", body))
+		assert.Equal(t, []string{"foo.mp4"}, notified)
+	})
+}
@@ -1,14 +1,23 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"sort"
+	"time"
 
 	"github.com/dghubble/oauth1"
 	"github.com/truemediaorg/socialbot/config"
+	"github.com/truemediaorg/socialbot/metrics"
+	"github.com/truemediaorg/socialbot/model"
+	"github.com/truemediaorg/socialbot/platform"
+	twitterutil "github.com/truemediaorg/socialbot/twitter"
 	"golang.org/x/exp/maps"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -17,12 +26,40 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	// Mentions are checked every 5 minutes because of the low rate limit on the timeline endpoint
+	twitterPollInterval = 5 * time.Minute
+
+	// Media uploads still go through the v1.1 API, which lives on its own host
+	twitterUploadHost = "https://upload.twitter.com"
+
+	// Copied from the Twitter response, beware the risk of this changing over time.
+	deletedPostErrorMsg   = "You attempted to reply to a Tweet that is deleted or not visible to you."
+	duplicatePostErrorMsg = "You are not allowed to create a Tweet with duplicate content."
+
+	// Endpoints whose rate limits are published as metrics
+	twitterEndpointMentions    = "mentions"
+	twitterEndpointCreateTweet = "create_tweet"
+)
+
+// Fields requested for mentions, whether polled or streamed, so they convert to the same thing
+var (
+	mentionTweetFields = []twitter.TweetField{twitter.TweetFieldText, twitter.TweetFieldAuthorID, twitter.TweetFieldConversationID, twitter.TweetFieldAttachments, twitter.TweetFieldLanguage}
+	mentionMediaFields = []twitter.MediaField{twitter.MediaFieldMediaKey, twitter.MediaFieldType, twitter.MediaFieldURL}
+	mentionUserFields  = []twitter.UserField{twitter.UserFieldUserName}
+	mentionExpansions  = []twitter.Expansion{twitter.ExpansionReferencedTweetsID, twitter.ExpansionAttachmentsMediaKeys, twitter.ExpansionAuthorID, twitter.ExpansionInReplyToUserID}
+)
+
 type TwitterService struct {
 	userID      string
+	userName    string
 	apiClient   *twitter.Client
 	oauthClient *twitter.Client
+	// Signs webhook challenge responses and checks webhook requests came from X
+	consumerSecret string
 
 	timelinePageSize int
+	streamEnabled    bool
 }
 
 type authorize struct {
@@ -75,40 +112,50 @@ func NewTwitterService(ctx context.Context, cfg config.Config, secretsManagerCli
 	}
 	return &TwitterService{
 		userID:           users.Raw.Users[0].ID,
+		userName:         users.Raw.Users[0].UserName,
 		apiClient:        apiClient,
 		oauthClient:      oauthClient,
+		consumerSecret:   twitterSecrets.ConsumerSecret,
 		timelinePageSize: cfg.Twitter.TimelinePageSize,
+		streamEnabled:    cfg.Twitter.StreamEnabled,
 	}
 }
 
 /*
 Gets all mentions from the Twitter API since a given tweet ID.
-If sinceID is empty, returns all available mentions.
+If sinceID is empty, returns the mentions from the last platform.InitialBacklog.
 This has the capability to return a lot of mentions over multiple requests and may take some time to return.
 Returned tweets are re-sorted to oldest-first so processing always happens starting with the oldest posts.
 */
 func (s *TwitterService) GetAllTimelineMentionsSince(ctx context.Context, sinceID string) ([]*twitter.TweetDictionary, error) {
 	paginationToken := ""
+	var startTime time.Time
+	if sinceID == "" {
+		startTime = time.Now().Add(-platform.InitialBacklog)
+	}
 	tweets := map[string]*twitter.TweetDictionary{}
 	for ok := true; ok; ok = (paginationToken != "") {
 		apiOpts := twitter.UserMentionTimelineOpts{
-			TweetFields:     []twitter.TweetField{twitter.TweetFieldAuthorID, twitter.TweetFieldConversationID, twitter.TweetFieldAttachments},
-			MediaFields:     []twitter.MediaField{twitter.MediaFieldMediaKey, twitter.MediaFieldType, twitter.MediaFieldURL},
-			UserFields:      []twitter.UserField{twitter.UserFieldUserName},
-			Expansions:      []twitter.Expansion{twitter.ExpansionReferencedTweetsID, twitter.ExpansionAttachmentsMediaKeys, twitter.ExpansionAuthorID, twitter.ExpansionInReplyToUserID},
+			TweetFields:     mentionTweetFields,
+			MediaFields:     mentionMediaFields,
+			UserFields:      mentionUserFields,
+			Expansions:      mentionExpansions,
 			MaxResults:      s.timelinePageSize,
 			PaginationToken: paginationToken,
 			SinceID:         sinceID,
+			StartTime:       startTime,
 		}
 
 		log.WithField("sinceID", sinceID).WithField("paginationToken", paginationToken).WithField("userID", s.userID).Info("requesting timeline mentions")
 		timeline, err := s.apiClient.UserMentionTimeline(ctx, s.userID, apiOpts)
 		if err != nil {
+			recordRateLimitFromError(twitterEndpointMentions, err)
 			return nil, err
 		}
 		paginationToken = timeline.Meta.NextToken
 		log.WithField("paginationToken", paginationToken).Debug("new pagination token")
 		log.WithField("limit", timeline.RateLimit.Limit).WithField("remaining", timeline.RateLimit.Remaining).WithField("reset", timeline.RateLimit.Reset).Info("rate limit data for timeline mentions")
+		recordRateLimit(twitterEndpointMentions, timeline.RateLimit)
 		for key, value := range timeline.Raw.TweetDictionaries() {
 			// Shouldn't have to worry about collisions since these IDs are unique
 			if tweets[key] != nil {
@@ -126,14 +173,242 @@ func (s *TwitterService) GetAllTimelineMentionsSince(ctx context.Context, sinceI
 }
 
 func (s *TwitterService) TweetResponse(ctx context.Context, replyToID string, message string) (*twitter.CreateTweetResponse, error) {
-	return s.oauthClient.CreateTweet(ctx, twitter.CreateTweetRequest{
+	resp, err := s.oauthClient.CreateTweet(ctx, twitter.CreateTweetRequest{
 		Text: message,
 		Reply: &twitter.CreateTweetReply{
 			InReplyToTweetID: replyToID,
 		},
 	})
+	if err != nil {
+		recordRateLimitFromError(twitterEndpointCreateTweet, err)
+		return nil, err
+	}
+	recordRateLimit(twitterEndpointCreateTweet, resp.RateLimit)
+	return resp, nil
+}
+
+// Publishes the rate limit X reported for an endpoint, if it reported one
+func recordRateLimit(endpoint string, rateLimit *twitter.RateLimit) {
+	if rateLimit == nil {
+		return
+	}
+	metrics.XRateLimitRemaining.WithLabelValues(endpoint).Set(float64(rateLimit.Remaining))
+	metrics.XRateLimitReset.WithLabelValues(endpoint).Set(float64(rateLimit.Reset))
+}
+
+// Publishes the rate limit X reported along with an error, which is how running out of requests shows up
+func recordRateLimitFromError(endpoint string, err error) {
+	if rateLimit, ok := twitter.RateLimitFromError(err); ok {
+		recordRateLimit(endpoint, rateLimit)
+	}
 }
 
 func (s *TwitterService) UserID() string {
 	return s.userID
 }
+
+func (s *TwitterService) Platform() model.Platform {
+	return model.PlatformX
+}
+
+func (s *TwitterService) Account() string {
+	return s.userID
+}
+
+func (s *TwitterService) Handle() string {
+	return s.userName
+}
+
+func (s *TwitterService) PollInterval() time.Duration {
+	return twitterPollInterval
+}
+
+func (s *TwitterService) GetMentionsSince(ctx context.Context, cursor string) ([]platform.Mention, error) {
+	tweets, err := s.GetAllTimelineMentionsSince(ctx, cursor)
+	if err != nil {
+		return nil, err
+	}
+	mentions := make([]platform.Mention, 0, len(tweets))
+	for _, tweet := range tweets {
+		mentions = append(mentions, mentionFromTweet(tweet))
+	}
+	return mentions, nil
+}
+
+func (s *TwitterService) PostReply(ctx context.Context, parentPostURL string, message string) (string, error) {
+	_, replyToID, err := twitterutil.DeconstructTweetURL(parentPostURL)
+	if err != nil {
+		return "", err
+	}
+	resp, err := s.TweetResponse(ctx, replyToID, message)
+	if err != nil {
+		return "", err
+	}
+	return resp.Tweet.ID, nil
+}
+
+func (s *TwitterService) PostThreadedReply(ctx context.Context, replyID string, message string) (string, error) {
+	resp, err := s.TweetResponse(ctx, replyID, message)
+	if err != nil {
+		return "", err
+	}
+	return resp.Tweet.ID, nil
+}
+
+func (s *TwitterService) PostReplyWithImage(ctx context.Context, parentPostURL string, message string, image platform.Image) (string, error) {
+	_, replyToID, err := twitterutil.DeconstructTweetURL(parentPostURL)
+	if err != nil {
+		return "", err
+	}
+	return s.PostThreadedReplyWithImage(ctx, replyToID, message, image)
+}
+
+// Falls back to a text-only reply if the image can't be uploaded, since the verdict matters more than the card
+func (s *TwitterService) PostThreadedReplyWithImage(ctx context.Context, replyID string, message string, image platform.Image) (string, error) {
+	mediaID, err := s.uploadImage(ctx, image)
+	if err != nil {
+		log.WithField("replyTo", replyID).Warnf("error uploading image, replying without it: %v", err)
+		return s.PostThreadedReply(ctx, replyID, message)
+	}
+	resp, err := s.oauthClient.CreateTweet(ctx, twitter.CreateTweetRequest{
+		Text: message,
+		Reply: &twitter.CreateTweetReply{
+			InReplyToTweetID: replyID,
+		},
+		Media: &twitter.CreateTweetMedia{
+			IDs: []string{mediaID},
+		},
+	})
+	if err != nil {
+		recordRateLimitFromError(twitterEndpointCreateTweet, err)
+		return "", err
+	}
+	recordRateLimit(twitterEndpointCreateTweet, resp.RateLimit)
+	return resp.Tweet.ID, nil
+}
+
+func (s *TwitterService) MediaThumbnailURL(ctx context.Context, postURL string) (string, error) {
+	_, tweetID, err := twitterutil.DeconstructTweetURL(postURL)
+	if err != nil {
+		return "", err
+	}
+	lookup, err := s.apiClient.TweetLookup(ctx, []string{tweetID}, twitter.TweetLookupOpts{
+		Expansions:  []twitter.Expansion{twitter.ExpansionAttachmentsMediaKeys},
+		MediaFields: []twitter.MediaField{twitter.MediaFieldType, twitter.MediaFieldURL, twitter.MediaFieldPreviewImageURL},
+	})
+	if err != nil {
+		return "", err
+	}
+	if lookup.Raw.Includes == nil || len(lookup.Raw.Includes.Media) == 0 {
+		return "", errors.New("tweet has no media")
+	}
+	media := lookup.Raw.Includes.Media[0]
+	// Photos have a URL; videos and GIFs only have a preview image
+	if media.Type == string(twitterutil.MediaTypePhoto) && media.URL != "" {
+		return media.URL, nil
+	}
+	if media.PreviewImageURL == "" {
+		return "", errors.New("tweet media has no preview image")
+	}
+	return media.PreviewImageURL, nil
+}
+
+func (s *TwitterService) ClassifyError(err error) platform.APIError {
+	var apiError *twitter.ErrorResponse
+	if errors.As(err, &apiError) {
+		switch apiError.Detail {
+		case deletedPostErrorMsg:
+			return platform.APIError{Kind: platform.APIErrorKindPostDeleted, Detail: apiError.Detail}
+		case duplicatePostErrorMsg:
+			return platform.APIError{Kind: platform.APIErrorKindDuplicateReply, Detail: apiError.Detail}
+		}
+	}
+	if rateLimit, ok := twitter.RateLimitFromError(err); ok {
+		log.WithField("limit", rateLimit.Limit).WithField("remaining", rateLimit.Remaining).Warn("X rate limit encountered")
+		return platform.APIError{Kind: platform.APIErrorKindRateLimited, RetryAt: rateLimit.Reset.Time(), Detail: err.Error()}
+	}
+	return platform.APIError{Kind: platform.APIErrorKindUnknown, Detail: err.Error()}
+}
+
+/*
+Uploads an image through the v1.1 media endpoint, which the v2 client doesn't cover,
+and returns the media ID to attach to a tweet.
+*/
+func (s *TwitterService) uploadImage(ctx context.Context, image platform.Image) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("media", "verdict.png")
+	if err != nil {
+		return "", err
+	}
+	if _, err = part.Write(image.PNG); err != nil {
+		return "", err
+	}
+	if err = form.Close(); err != nil {
+		return "", err
+	}
+
+	var upload twitterutil.MediaUploadResponse
+	if err := s.postUploadEndpoint(ctx, twitterUploadHost+"/1.1/media/upload.json", form.FormDataContentType(), &body, &upload); err != nil {
+		return "", err
+	}
+
+	if image.AltText != "" {
+		metadata, err := json.Marshal(twitterutil.MediaMetadataRequest{
+			MediaID: upload.MediaIDString,
+			AltText: twitterutil.MediaAltText{Text: image.AltText},
+		})
+		if err != nil {
+			return "", err
+		}
+		// Missing alt text isn't worth failing the reply over
+		if err := s.postUploadEndpoint(ctx, twitterUploadHost+"/1.1/media/metadata/create.json", "application/json", bytes.NewReader(metadata), nil); err != nil {
+			log.WithField("mediaID", upload.MediaIDString).Warnf("unable to add alt text to image: %v", err)
+		}
+	}
+	return upload.MediaIDString, nil
+}
+
+func (s *TwitterService) postUploadEndpoint(ctx context.Context, url string, contentType string, body io.Reader, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := s.oauthClient.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return &twitter.HTTPError{Status: resp.Status, StatusCode: resp.StatusCode, URL: url}
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, result)
+}
+
+// Finds the replied-to tweet carrying media, if any, and converts the mention to its platform-agnostic form
+func mentionFromTweet(tweet *twitter.TweetDictionary) platform.Mention {
+	mention := platform.Mention{
+		PlatformID:     tweet.Tweet.ID,
+		AuthorUserName: tweet.Author.UserName,
+		Text:           tweet.Tweet.Text,
+		Language:       tweet.Tweet.Language,
+	}
+	log.Debugf("tweet %s has %d referenced tweets", tweet.Tweet.ID, len(tweet.ReferencedTweets))
+	for _, referencedTweet := range tweet.ReferencedTweets {
+		log.WithField("referenceType", referencedTweet.Reference.Type).Debug()
+		if twitterutil.IsReplyReference(referencedTweet) && twitterutil.TweetHasMedia(referencedTweet.TweetDictionary.Tweet) {
+			mention.MediaPostURL = twitterutil.ConstructTweetURL(referencedTweet.TweetDictionary.Author.UserName, referencedTweet.TweetDictionary.Tweet.ID)
+			mention.MediaPostAuthorUserName = referencedTweet.TweetDictionary.Author.UserName
+			break
+		}
+	}
+	return mention
+}
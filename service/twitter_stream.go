@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/truemediaorg/socialbot/platform"
+
+	"github.com/g8rswimmer/go-twitter/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// Tags the filtered stream rule this bot owns, so rules added by anything else sharing the app are left alone
+	twitterStreamRuleTag = "socialbot-mentions"
+
+	// Backoff between reconnects, doubling after each failure, per X's guidance for HTTP errors
+	twitterStreamMinBackoff = 5 * time.Second
+	twitterStreamMaxBackoff = 320 * time.Second
+	// How often to check the stream is still getting keep-alives
+	twitterStreamCheckInterval = 10 * time.Second
+)
+
+func (s *TwitterService) StreamingEnabled() bool {
+	return s.streamEnabled
+}
+
+/*
+Streams mentions of the bot from the v2 filtered stream until ctx is done, reconnecting with exponential backoff.
+Mentions posted while disconnected aren't replayed, so the watcher's polling is what catches up on them.
+*/
+func (s *TwitterService) StreamMentions(ctx context.Context, mentions chan<- platform.Mention) error {
+	if err := s.ensureStreamRule(ctx); err != nil {
+		return fmt.Errorf("error setting up stream rule: %w", err)
+	}
+	backoff := twitterStreamMinBackoff
+	for {
+		connected, err := s.streamOnce(ctx, mentions)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if connected {
+			// The stream accepted the connection, so whatever was wrong before has cleared up
+			backoff = twitterStreamMinBackoff
+		}
+		wait := backoff
+		if err != nil {
+			if apiError := s.ClassifyError(err); apiError.Kind == platform.APIErrorKindRateLimited {
+				wait = max(wait, time.Until(apiError.RetryAt))
+			}
+			log.WithField("platform", s.Platform()).Warnf("mention stream disconnected, reconnecting in %s: %v", wait, err)
+		} else {
+			log.WithField("platform", s.Platform()).Warnf("mention stream disconnected, reconnecting in %s", wait)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+		backoff = min(backoff*2, twitterStreamMaxBackoff)
+	}
+}
+
+/*
+Holds one connection to the filtered stream until it drops or ctx is done.
+Returns whether the connection was made, and the error that ended it, if any.
+*/
+func (s *TwitterService) streamOnce(ctx context.Context, mentions chan<- platform.Mention) (bool, error) {
+	// Canceling the request unblocks the stream's reader, which has to happen before it can be closed
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := s.apiClient.TweetSearchStream(streamCtx, twitter.TweetSearchStreamOpts{
+		TweetFields: mentionTweetFields,
+		MediaFields: mentionMediaFields,
+		UserFields:  mentionUserFields,
+		Expansions:  mentionExpansions,
+	})
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		cancel()
+		stream.Close()
+	}()
+	log.WithField("platform", s.Platform()).Info("connected to mention stream")
+
+	ticker := time.NewTicker(twitterStreamCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return true, nil
+		case <-ticker.C:
+			// The stream sends keep-alives every 20 seconds, so going quiet means the connection is gone
+			if !stream.Connection() {
+				return true, fmt.Errorf("no keep-alive received")
+			}
+		case disconnection := <-stream.DisconnectionError():
+			if len(disconnection.Disconnections) > 0 {
+				return true, fmt.Errorf("%s: %s", disconnection.Disconnections[0].Title, disconnection.Disconnections[0].Detail)
+			}
+			if len(disconnection.Connections) > 0 {
+				return true, fmt.Errorf("%s: %s", disconnection.Connections[0].Title, disconnection.Connections[0].Detail)
+			}
+		case err := <-stream.Err():
+			// Errors decoding a single message don't mean the connection is lost
+			log.WithField("platform", s.Platform()).Warnf("error reading mention stream: %v", err)
+		case message := <-stream.Tweets():
+			// The client drops tweets if they aren't read fast enough; polling picks those up too
+			if message == nil || message.Raw == nil {
+				continue
+			}
+			for _, tweet := range message.Raw.TweetDictionaries() {
+				if !s.mentionsBot(tweet) {
+					continue
+				}
+				select {
+				case mentions <- mentionFromTweet(tweet):
+				case <-ctx.Done():
+					return true, nil
+				}
+			}
+		}
+	}
+}
+
+/*
+Makes sure the filtered stream has a rule matching replies that mention the bot, replacing any stale rule with
+this bot's tag. The rule can't use has:media, because that matches media on the mention itself rather than on
+the post it replies to; mentions without media are dropped later, the same as polled ones.
+*/
+func (s *TwitterService) ensureStreamRule(ctx context.Context) error {
+	value := fmt.Sprintf("@%s is:reply", s.userName)
+	rules, err := s.apiClient.TweetSearchStreamRules(ctx, []twitter.TweetSearchStreamRuleID{})
+	if err != nil {
+		return err
+	}
+	var stale []twitter.TweetSearchStreamRuleID
+	for _, rule := range rules.Rules {
+		if rule.Tag != twitterStreamRuleTag {
+			continue
+		}
+		if rule.Value == value {
+			return nil
+		}
+		stale = append(stale, rule.ID)
+	}
+	if len(stale) > 0 {
+		if _, err := s.apiClient.TweetSearchStreamDeleteRuleByID(ctx, stale, false); err != nil {
+			return err
+		}
+	}
+	log.WithField("rule", value).Info("adding mention stream rule")
+	_, err = s.apiClient.TweetSearchStreamAddRule(ctx, []twitter.TweetSearchStreamRule{{Value: value, Tag: twitterStreamRuleTag}}, false)
+	return err
+}
+
+// Filters out tweets delivered for other rules on the app, and the bot's own replies
+func (s *TwitterService) mentionsBot(tweet *twitter.TweetDictionary) bool {
+	if tweet.Tweet.AuthorID == s.userID {
+		return false
+	}
+	return textMentionsUser(tweet.Tweet.Text, s.userName)
+}
+
+// Whether text mentions @userName, and not just a longer handle that starts the same way
+func textMentionsUser(text string, userName string) bool {
+	return regexp.MustCompile(`(?i)@` + regexp.QuoteMeta(userName) + `\b`).MatchString(text)
+}
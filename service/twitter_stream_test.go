@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/g8rswimmer/go-twitter/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeStreamRules struct {
+	rules   []twitter.TweetSearchStreamRuleEntity
+	added   []twitter.TweetSearchStreamRule
+	deleted []twitter.TweetSearchStreamRuleID
+}
+
+// Serves the filtered stream's rules endpoint, starting from the given rules
+func newFakeStreamRulesServer(t *testing.T, rules ...twitter.TweetSearchStreamRuleEntity) (*httptest.Server, *fakeStreamRules) {
+	state := &fakeStreamRules{rules: rules}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /2/tweets/search/stream/rules", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"data": state.rules})
+	})
+	mux.HandleFunc("POST /2/tweets/search/stream/rules", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Add    []twitter.TweetSearchStreamRule `json:"add"`
+			Delete *struct {
+				IDs []twitter.TweetSearchStreamRuleID `json:"ids"`
+			} `json:"delete"`
+		}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		if body.Delete != nil {
+			state.deleted = append(state.deleted, body.Delete.IDs...)
+			json.NewEncoder(w).Encode(map[string]any{"meta": map[string]any{"summary": map[string]int{"deleted": len(body.Delete.IDs)}}})
+			return
+		}
+		state.added = append(state.added, body.Add...)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{"data": body.Add})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, state
+}
+
+func streamRule(id string, value string, tag string) twitter.TweetSearchStreamRuleEntity {
+	return twitter.TweetSearchStreamRuleEntity{ID: twitter.TweetSearchStreamRuleID(id), TweetSearchStreamRule: twitter.TweetSearchStreamRule{Value: value, Tag: tag}}
+}
+
+func TestEnsureStreamRule(t *testing.T) {
+	wanted := twitter.TweetSearchStreamRule{Value: "@TrueMediaBot is:reply", Tag: twitterStreamRuleTag}
+
+	t.Run("adds the rule if there isn't one", func(t *testing.T) {
+		server, state := newFakeStreamRulesServer(t, streamRule("1", "cats has:images", "someone-else"))
+		assert.NoError(t, newTestTwitterService(server.URL).ensureStreamRule(context.TODO()))
+		assert.Equal(t, []twitter.TweetSearchStreamRule{wanted}, state.added)
+		assert.Empty(t, state.deleted)
+	})
+
+	t.Run("leaves a current rule alone", func(t *testing.T) {
+		server, state := newFakeStreamRulesServer(t, streamRule("2", wanted.Value, twitterStreamRuleTag))
+		assert.NoError(t, newTestTwitterService(server.URL).ensureStreamRule(context.TODO()))
+		assert.Empty(t, state.added)
+		assert.Empty(t, state.deleted)
+	})
+
+	t.Run("replaces a stale rule, keeping other apps' rules", func(t *testing.T) {
+		server, state := newFakeStreamRulesServer(t,
+			streamRule("1", "cats has:images", "someone-else"),
+			streamRule("3", "@OldBotName is:reply", twitterStreamRuleTag),
+		)
+		assert.NoError(t, newTestTwitterService(server.URL).ensureStreamRule(context.TODO()))
+		assert.Equal(t, []twitter.TweetSearchStreamRuleID{"3"}, state.deleted)
+		assert.Equal(t, []twitter.TweetSearchStreamRule{wanted}, state.added)
+	})
+}
+
+func TestMentionsBot(t *testing.T) {
+	service := newTestTwitterService("")
+	testCases := []struct {
+		name     string
+		authorID string
+		text     string
+		expected bool
+	}{
+		{"mention", "42", "@TrueMediaBot is this real?", true},
+		{"mention in other case", "42", "@someone @truemediabot, is this real?", true},
+		{"bot's own reply", "7", "@alice @TrueMediaBot verdict", false},
+		{"tweet for another rule", "42", "look at these cats", false},
+		{"longer handle", "42", "@TrueMediaBotFan is this real?", false},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			tweet := &twitter.TweetDictionary{Tweet: twitter.TweetObj{AuthorID: testCase.authorID, Text: testCase.text}}
+			assert.Equal(t, testCase.expected, service.mentionsBot(tweet))
+		})
+	}
+}
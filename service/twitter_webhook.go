@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/truemediaorg/socialbot/platform"
+	twitterutil "github.com/truemediaorg/socialbot/twitter"
+
+	"github.com/g8rswimmer/go-twitter/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// Account Activity API payloads are small, so anything much bigger isn't from X
+const twitterWebhookMaxBody = 1 << 20
+
+/*
+Serves the Account Activity API webhook for the bot's account.
+GET requests are challenge-response checks, answered by signing the token with the app's consumer secret.
+POST requests carry account events; mentions among the tweet_create_events are handed to push.
+X doesn't redeliver events the webhook missed, so polling still runs to catch up on them.
+*/
+func (s *TwitterService) WebhookHandler(push func(platform.Mention)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			s.handleWebhookCRC(w, r)
+		case http.MethodPost:
+			s.handleWebhookEvent(w, r, push)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func (s *TwitterService) handleWebhookCRC(w http.ResponseWriter, r *http.Request) {
+	crcToken := r.URL.Query().Get("crc_token")
+	if crcToken == "" {
+		http.Error(w, "missing crc_token", http.StatusBadRequest)
+		return
+	}
+	log.Debug("received webhook challenge-response check")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(twitterutil.CRCResponse{ResponseToken: twitterutil.CRCResponseToken(s.consumerSecret, crcToken)})
+}
+
+func (s *TwitterService) handleWebhookEvent(w http.ResponseWriter, r *http.Request, push func(platform.Mention)) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, twitterWebhookMaxBody))
+	if err != nil {
+		http.Error(w, "unable to read body", http.StatusBadRequest)
+		return
+	}
+	if !twitterutil.ValidWebhookSignature(s.consumerSecret, body, r.Header.Get(twitterutil.WebhookSignatureHeader)) {
+		log.Warn("rejected webhook request with a bad signature")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var event twitterutil.AccountActivityEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, "unable to parse event", http.StatusBadRequest)
+		return
+	}
+	if event.ForUserID != s.userID {
+		// Events for other accounts subscribed to the same app
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var tweetIDs []string
+	for _, tweet := range event.TweetCreateEvents {
+		if s.webhookTweetMentionsBot(tweet) {
+			tweetIDs = append(tweetIDs, tweet.IDStr)
+		}
+	}
+	if len(tweetIDs) > 0 {
+		// The event doesn't say what the mention replies to, so look it up the same way polling does
+		mentions, err := s.lookupMentions(r.Context(), tweetIDs)
+		if err != nil {
+			log.WithField("tweetIDs", tweetIDs).Errorf("error looking up webhook mentions, leaving them for polling: %v", err)
+		}
+		for _, mention := range mentions {
+			push(mention)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Keeps replies by others that mention the bot; tweet_create_events also has the bot's own tweets and retweets
+func (s *TwitterService) webhookTweetMentionsBot(tweet twitterutil.WebhookTweet) bool {
+	if tweet.User.IDStr == s.userID || tweet.RetweetedStatus != nil || tweet.InReplyToStatusIDStr == "" {
+		return false
+	}
+	return textMentionsUser(tweet.Text, s.userName)
+}
+
+func (s *TwitterService) lookupMentions(ctx context.Context, tweetIDs []string) ([]platform.Mention, error) {
+	lookup, err := s.apiClient.TweetLookup(ctx, tweetIDs, twitter.TweetLookupOpts{
+		TweetFields: mentionTweetFields,
+		MediaFields: mentionMediaFields,
+		UserFields:  mentionUserFields,
+		Expansions:  mentionExpansions,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var mentions []platform.Mention
+	for _, tweet := range lookup.Raw.TweetDictionaries() {
+		mentions = append(mentions, mentionFromTweet(tweet))
+	}
+	return mentions, nil
+}
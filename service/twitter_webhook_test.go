@@ -0,0 +1,108 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/g8rswimmer/go-twitter/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/truemediaorg/socialbot/platform"
+	twitterutil "github.com/truemediaorg/socialbot/twitter"
+)
+
+const testConsumerSecret = "consumer-secret"
+
+// Serves tweet lookups for the mention with ID 1001, recording which IDs were asked for
+func newFakeTwitterLookupServer(t *testing.T) (*httptest.Server, *[]string) {
+	var lookedUp []string
+	mux := http.NewServeMux()
+	// Looking up a single tweet has its own endpoint
+	mux.HandleFunc("GET /2/tweets/{id}", func(w http.ResponseWriter, r *http.Request) {
+		lookedUp = append(lookedUp, r.PathValue("id"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"data": {"id": "1001", "text": "@TrueMediaBot is this real?", "author_id": "42", "referenced_tweets": [{"type": "replied_to", "id": "900"}]},
+			"includes": {
+				"tweets": [{"id": "900", "text": "look at this", "author_id": "43", "attachments": {"media_keys": ["3_1"]}}],
+				"users": [{"id": "42", "username": "alice"}, {"id": "43", "username": "poster"}],
+				"media": [{"media_key": "3_1", "type": "video"}]
+			}
+		}`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &lookedUp
+}
+
+func newTestTwitterService(host string) *TwitterService {
+	return &TwitterService{
+		userID:         "7",
+		userName:       "TrueMediaBot",
+		apiClient:      &twitter.Client{Authorizer: authorize{Token: "token"}, Client: http.DefaultClient, Host: host},
+		consumerSecret: testConsumerSecret,
+	}
+}
+
+func postWebhookEvent(handler http.Handler, event twitterutil.AccountActivityEvent, secret string) int {
+	body, _ := json.Marshal(event)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/x", bytes.NewReader(body))
+	req.Header.Set(twitterutil.WebhookSignatureHeader, "sha256="+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	return recorder.Code
+}
+
+func TestWebhookHandler(t *testing.T) {
+	server, lookedUp := newFakeTwitterLookupServer(t)
+	service := newTestTwitterService(server.URL)
+	var pushed []platform.Mention
+	handler := service.WebhookHandler(func(mention platform.Mention) { pushed = append(pushed, mention) })
+
+	mention := twitterutil.WebhookTweet{IDStr: "1001", Text: "@TrueMediaBot is this real?", InReplyToStatusIDStr: "900", User: twitterutil.WebhookUser{IDStr: "42"}}
+	event := twitterutil.AccountActivityEvent{
+		ForUserID: "7",
+		TweetCreateEvents: []twitterutil.WebhookTweet{
+			mention,
+			// A retweet of the mention
+			{IDStr: "1002", Text: "RT @alice: @TrueMediaBot is this real?", InReplyToStatusIDStr: "900", User: twitterutil.WebhookUser{IDStr: "44"}, RetweetedStatus: &mention},
+			// The bot's own reply
+			{IDStr: "1003", Text: "@alice @TrueMediaBot verdict", InReplyToStatusIDStr: "1001", User: twitterutil.WebhookUser{IDStr: "7"}},
+			// Mentions the bot without replying to anything
+			{IDStr: "1004", Text: "hello @TrueMediaBot", User: twitterutil.WebhookUser{IDStr: "45"}},
+		},
+	}
+
+	t.Run("rejects a bad signature", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, postWebhookEvent(handler, event, "other-secret"))
+		assert.Empty(t, *lookedUp)
+		assert.Empty(t, pushed)
+	})
+
+	t.Run("ignores events for other accounts", func(t *testing.T) {
+		otherAccount := event
+		otherAccount.ForUserID = "8"
+		assert.Equal(t, http.StatusOK, postWebhookEvent(handler, otherAccount, testConsumerSecret))
+		assert.Empty(t, *lookedUp)
+		assert.Empty(t, pushed)
+	})
+
+	t.Run("pushes mentions, skipping retweets and the bot's own tweets", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, postWebhookEvent(handler, event, testConsumerSecret))
+		assert.Equal(t, []string{"1001"}, *lookedUp)
+		assert.Equal(t, []platform.Mention{{
+			PlatformID:              "1001",
+			AuthorUserName:          "alice",
+			Text:                    "@TrueMediaBot is this real?",
+			MediaPostURL:            twitterutil.ConstructTweetURL("poster", "900"),
+			MediaPostAuthorUserName: "poster",
+		}}, pushed)
+	})
+}
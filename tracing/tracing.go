@@ -0,0 +1,107 @@
+/*
+OpenTelemetry tracing for the mention pipeline. Each mention gets a root span when the watcher takes it in,
+and its trace context is stored with the mention so the responder's later checks on it join the same trace.
+*/
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	serviceName = "socialbot"
+	// Header the trace context is stored as, in W3C Trace Context format
+	traceParentHeader = "traceparent"
+)
+
+// Attribute keys shared by spans across the pipeline
+const (
+	AttributeMentionID         = attribute.Key("socialbot.mention.id")
+	AttributeMentionPlatformID = attribute.Key("socialbot.mention.platform_id")
+	AttributePlatform          = attribute.Key("socialbot.platform")
+	AttributeMediaID           = attribute.Key("socialbot.media.id")
+	AttributeMediaPostURL      = attribute.Key("socialbot.media.post_url")
+	AttributeReplyType         = attribute.Key("socialbot.reply.type")
+)
+
+var tracer = otel.Tracer("github.com/truemediaorg/socialbot")
+
+/*
+Exports spans over OTLP/HTTP to endpoint, such as "http://localhost:4318" for a local collector.
+If endpoint is empty, tracing stays off and spans cost next to nothing. Returns a function that flushes
+any spans still waiting to be exported, to call before exiting.
+*/
+func Setup(ctx context.Context, endpoint string, workerID string) (func(context.Context) error, error) {
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+		semconv.ServiceInstanceID(workerID),
+	))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// Starts a span at the root of a new trace, such as for a mention the watcher has just come across
+func StartRoot(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithNewRoot(), trace.WithAttributes(attributes...))
+}
+
+// Marks the span in ctx as failed
+func RecordError(ctx context.Context, err error) {
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Gets the trace context of the span in ctx to store, or "" if there's no span being recorded
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get(traceParentHeader)
+}
+
+// Gets the trace ID from a stored trace context, or "" if there isn't one
+func TraceID(traceParent string) string {
+	spanContext := trace.SpanContextFromContext(ContextWithTraceParent(context.Background(), traceParent))
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
+
+// Makes spans started from the returned context join the trace a stored trace context belongs to
+func ContextWithTraceParent(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	return propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{traceParentHeader: traceParent})
+}
@@ -0,0 +1,33 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceParentRoundTrip(t *testing.T) {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	ctx, root := StartRoot(context.Background(), "root")
+	traceParent := TraceParent(ctx)
+	root.End()
+	assert.NotEmpty(t, traceParent)
+	assert.Equal(t, root.SpanContext().TraceID().String(), TraceID(traceParent))
+
+	// Later work on the mention joins the same trace, under the root span
+	_, child := Start(ContextWithTraceParent(context.Background(), traceParent), "child")
+	defer child.End()
+	assert.Equal(t, root.SpanContext().TraceID(), child.SpanContext().TraceID())
+	assert.Equal(t, root.SpanContext().SpanID(), child.(sdktrace.ReadOnlySpan).Parent().SpanID())
+}
+
+func TestTraceParentWithoutTracing(t *testing.T) {
+	assert.Empty(t, TraceParent(context.Background()))
+	assert.Empty(t, TraceID(""))
+	assert.False(t, trace.SpanContextFromContext(ContextWithTraceParent(context.Background(), "")).IsValid())
+}
@@ -2,87 +2,231 @@ package truemedia
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// How many times a request is retried after a rate limit, server error or network error
+	defaultMaxRetries = 3
+	// Backoff before the first retry, doubling each time up to maxBackoff
+	defaultMinBackoff = 1 * time.Second
+	defaultMaxBackoff = 30 * time.Second
+)
+
+// Errors an APIError unwraps to, by status code
+var (
+	ErrRateLimited = errors.New("rate limited")
+	ErrClientError = errors.New("client error")
+	ErrServerError = errors.New("server error")
 )
 
 type Client struct {
 	baseURL    string
 	apiKey     string
 	HTTPClient *http.Client
+
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+/*
+Error response from the TrueMedia API.
+Check which kind with errors.Is against ErrRateLimited, ErrClientError or ErrServerError.
+*/
+type APIError struct {
+	StatusCode int
+	Message    string `json:"error"`
+	// How long the API asked the bot to wait before trying again, if it said
+	RetryAfter time.Duration
 }
 
-func NewClient(apiKey string, baseURL url.URL) *Client {
+func (e *APIError) Error() string {
+	return fmt.Sprintf("truemedia callout status %d: %s", e.StatusCode, e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.StatusCode >= http.StatusInternalServerError:
+		return ErrServerError
+	default:
+		return ErrClientError
+	}
+}
+
+// Creates a client whose requests, including reading the response, give up after timeout
+func NewClient(apiKey string, baseURL url.URL, timeout time.Duration) *Client {
 	return &Client{
 		apiKey:     apiKey,
 		baseURL:    baseURL.String(),
-		HTTPClient: http.DefaultClient,
+		HTTPClient: &http.Client{Timeout: timeout},
+		MaxRetries: defaultMaxRetries,
+		MinBackoff: defaultMinBackoff,
+		MaxBackoff: defaultMaxBackoff,
 	}
 }
 
-func (c Client) ResolveMedia(url string) (*ResolveMediaResponse, error) {
-	reqBody, err := json.Marshal(ResolveMediaRequest{PostURL: url})
+// Resolves the media in a post. If callbackURL is set, TrueMedia posts an AnalysisCallback there as each item finishes.
+func (c Client) ResolveMedia(ctx context.Context, url string, callbackURL string) (*ResolveMediaResponse, error) {
+	reqBody, err := json.Marshal(ResolveMediaRequest{PostURL: url, CallbackURL: callbackURL})
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/resolve-media", c.baseURL), bytes.NewReader(reqBody))
-	if err != nil {
+	var rmr ResolveMediaResponse
+	if err := c.do(ctx, http.MethodPost, "/resolve-media", reqBody, &rmr); err != nil {
 		return nil, err
 	}
-	req.Header.Add("X-API-KEY", c.apiKey)
+	return &rmr, nil
+}
 
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
+func (c Client) GetResults(ctx context.Context, mediaID string) (*GetResultResponse, error) {
+	q := url.Values{}
+	q.Add("id", mediaID)
+	var grr GetResultResponse
+	if err := c.do(ctx, http.MethodGet, "/get-results?"+q.Encode(), nil, &grr); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	return &grr, nil
+}
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
+// A request that failed before any of it was sent, so TrueMedia can't have acted on it
+type unsentError struct {
+	err error
+}
 
-	var rmr ResolveMediaResponse
-	if err = json.Unmarshal(respBody, &rmr); err != nil {
-		return nil, err
-	}
+func (e *unsentError) Error() string {
+	return e.err.Error()
+}
 
-	return &rmr, nil
+func (e *unsentError) Unwrap() error {
+	return e.err
 }
 
-func (c Client) GetResults(mediaID string) (*GetResultResponse, error) {
-	url, err := url.Parse(c.baseURL + "/get-results")
-	if err != nil {
-		return nil, err
+/*
+Makes a request, retrying rate limits, server errors and network errors with jittered exponential backoff.
+Anything but a GET may have been acted on even if it timed out or failed, and sending it again could start a
+second analysis, so those are only retried after a rate limit or a failure before the request was sent.
+A Retry-After header from the API takes the place of the backoff when it asks for longer. If it asks for
+longer than MaxBackoff, the error is returned straight away so the caller can come back later rather than
+hold up everything else.
+*/
+func (c Client) do(ctx context.Context, method string, path string, body []byte, result any) error {
+	backoff := c.MinBackoff
+	for attempt := 0; ; attempt++ {
+		err := c.doOnce(ctx, method, path, body, result)
+		if err == nil || attempt >= c.MaxRetries || !retryable(ctx, method, err) {
+			return err
+		}
+		// Full jitter keeps replicas that failed together from retrying together
+		wait := time.Duration(rand.Int63n(int64(backoff) + 1))
+		var apiError *APIError
+		if errors.As(err, &apiError) && apiError.RetryAfter > wait {
+			if apiError.RetryAfter > c.MaxBackoff {
+				return err
+			}
+			wait = apiError.RetryAfter
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		backoff = min(backoff*2, c.MaxBackoff)
 	}
-	q := url.Query()
-	q.Add("id", mediaID)
-	url.RawQuery = q.Encode()
+}
 
-	req, err := http.NewRequest(http.MethodGet, url.String(), nil)
+func (c Client) doOnce(ctx context.Context, method string, path string, body []byte, result any) error {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	req.Header.Add("X-API-KEY", c.apiKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	var sent atomic.Bool
+	req = req.WithContext(httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		WroteRequest: func(httptrace.WroteRequestInfo) { sent.Store(true) },
+	}))
 
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return nil, err
+		if !sent.Load() {
+			return &unsentError{err: err}
+		}
+		return err
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	var grr GetResultResponse
-	if err = json.Unmarshal(body, &grr); err != nil {
-		return nil, err
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiError := &APIError{StatusCode: resp.StatusCode, RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+		// Errors from the load balancer are HTML pages rather than JSON, so fall back to the status text
+		if err := json.Unmarshal(respBody, apiError); err != nil || apiError.Message == "" {
+			apiError.Message = http.StatusText(resp.StatusCode)
+		}
+		return apiError
 	}
 
-	return &grr, nil
+	return json.Unmarshal(respBody, result)
+}
+
+// Whether an error might go away by trying again, and the request is safe to send again
+func retryable(ctx context.Context, method string, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if method != http.MethodGet {
+		var unsent *unsentError
+		return errors.Is(err, ErrRateLimited) || errors.As(err, &unsent)
+	}
+	return Retryable(err)
+}
+
+// Whether an error from the client might go away by trying again later: a rate limit, server error or network error
+func Retryable(err error) bool {
+	if errors.Is(err, ErrRateLimited) || errors.Is(err, ErrServerError) {
+		return true
+	}
+	var apiError *APIError
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	// Anything else that isn't a response from the API, or a response that didn't parse, is a network error
+	return !errors.As(err, &apiError) && !errors.As(err, &syntaxError) && !errors.As(err, &typeError)
+}
+
+// Parses a Retry-After header, which is either a number of seconds or an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
 }
@@ -0,0 +1,168 @@
+package truemedia
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Starts a fake API that answers with each of responses in turn, and a client for it that retries without waiting
+func newTestClient(t *testing.T, responses ...func(w http.ResponseWriter)) (*Client, *int) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		responses[min(calls, len(responses)-1)](w)
+		calls++
+	}))
+	t.Cleanup(server.Close)
+	serverURL, _ := url.Parse(server.URL)
+	client := NewClient("key", *serverURL, time.Second)
+	client.MinBackoff = time.Millisecond
+	client.MaxBackoff = time.Millisecond
+	return client, &calls
+}
+
+func TestGetResults(t *testing.T) {
+	complete := func(w http.ResponseWriter) {
+		w.Write([]byte(`{"state":"COMPLETE"}`))
+	}
+
+	t.Run("retries server errors", func(t *testing.T) {
+		client, calls := newTestClient(t, func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("<html>Bad Gateway</html>"))
+		}, complete)
+		result, err := client.GetResults(context.Background(), "media")
+		assert.NoError(t, err)
+		assert.Equal(t, AnalysisStateComplete, result.State)
+		assert.Equal(t, 2, *calls)
+	})
+
+	t.Run("retries rate limits", func(t *testing.T) {
+		client, calls := newTestClient(t, func(w http.ResponseWriter) {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}, complete)
+		_, err := client.GetResults(context.Background(), "media")
+		assert.NoError(t, err)
+		assert.Equal(t, 2, *calls)
+	})
+
+	t.Run("doesn't wait out a long Retry-After", func(t *testing.T) {
+		client, calls := newTestClient(t, func(w http.ResponseWriter) {
+			w.Header().Set("Retry-After", "600")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}, complete)
+		_, err := client.GetResults(context.Background(), "media")
+		var apiError *APIError
+		assert.True(t, errors.As(err, &apiError))
+		assert.Equal(t, 10*time.Minute, apiError.RetryAfter)
+		assert.Equal(t, 1, *calls)
+	})
+
+	t.Run("gives up after the retries run out", func(t *testing.T) {
+		client, calls := newTestClient(t, func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusInternalServerError)
+		})
+		_, err := client.GetResults(context.Background(), "media")
+		assert.True(t, errors.Is(err, ErrServerError))
+		assert.Equal(t, defaultMaxRetries+1, *calls)
+	})
+
+	t.Run("doesn't retry client errors", func(t *testing.T) {
+		client, calls := newTestClient(t, func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"media not found"}`))
+		})
+		_, err := client.GetResults(context.Background(), "media")
+		var apiError *APIError
+		assert.True(t, errors.As(err, &apiError))
+		assert.Equal(t, "media not found", apiError.Message)
+		assert.True(t, errors.Is(err, ErrClientError))
+		assert.Equal(t, 1, *calls)
+	})
+}
+
+func TestResolveMedia(t *testing.T) {
+	t.Run("doesn't resend a request that timed out", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			// TrueMedia may well go on to start the analysis, even though the bot gave up waiting
+			time.Sleep(200 * time.Millisecond)
+		}))
+		t.Cleanup(server.Close)
+		serverURL, _ := url.Parse(server.URL)
+		client := NewClient("key", *serverURL, 50*time.Millisecond)
+		client.MinBackoff = time.Millisecond
+		client.MaxBackoff = time.Millisecond
+
+		_, err := client.ResolveMedia(context.Background(), "https://x.com/user/status/1", "")
+		assert.Error(t, err)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("doesn't resend after a server error", func(t *testing.T) {
+		client, calls := newTestClient(t, func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusBadGateway)
+		})
+		_, err := client.ResolveMedia(context.Background(), "https://x.com/user/status/1", "")
+		assert.True(t, errors.Is(err, ErrServerError))
+		assert.Equal(t, 1, *calls)
+	})
+
+	t.Run("retries rate limits", func(t *testing.T) {
+		client, calls := newTestClient(t, func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}, func(w http.ResponseWriter) {
+			w.Write([]byte(`{"result":"success"}`))
+		})
+		_, err := client.ResolveMedia(context.Background(), "https://x.com/user/status/1", "")
+		assert.NoError(t, err)
+		assert.Equal(t, 2, *calls)
+	})
+
+	t.Run("retries when it couldn't connect", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		serverURL, _ := url.Parse(server.URL)
+		server.Close()
+		client := NewClient("key", *serverURL, time.Second)
+		client.MinBackoff = time.Millisecond
+		client.MaxBackoff = time.Millisecond
+		attempts := 0
+		client.HTTPClient.Transport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			attempts++
+			return http.DefaultTransport.RoundTrip(r)
+		})
+
+		_, err := client.ResolveMedia(context.Background(), "https://x.com/user/status/1", "")
+		var unsent *unsentError
+		assert.True(t, errors.As(err, &unsent))
+		assert.Equal(t, defaultMaxRetries+1, attempts)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestRetryable(t *testing.T) {
+	assert.True(t, Retryable(&APIError{StatusCode: http.StatusTooManyRequests}))
+	assert.True(t, Retryable(&APIError{StatusCode: http.StatusServiceUnavailable}))
+	assert.True(t, Retryable(errors.New("connection reset by peer")))
+	assert.False(t, Retryable(&APIError{StatusCode: http.StatusBadRequest}))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, 120*time.Second, parseRetryAfter("120"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(""))
+	assert.InDelta(t, time.Hour, parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)), float64(2*time.Second))
+}
@@ -0,0 +1,89 @@
+package truemedia
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Why TrueMedia couldn't resolve or analyze media, as far as users need to know
+type FailureReason string
+
+const (
+	FailureReasonUnsupportedMedia FailureReason = "unsupported_media"
+	FailureReasonPrivateAccount   FailureReason = "private_account"
+	FailureReasonTooLong          FailureReason = "too_long"
+	FailureReasonUnknown          FailureReason = "unknown"
+)
+
+// TrueMedia's failure codes, given as the reason a resolve failed and sometimes as an analysis error
+var failureCodes = map[string]FailureReason{
+	"unsupported_media": FailureReasonUnsupportedMedia,
+	"private_account":   FailureReasonPrivateAccount,
+	"too_long":          FailureReasonTooLong,
+}
+
+/*
+Phrases in TrueMedia's free-text details that give away the category, checked in order. A classified failure
+is treated as permanent, so these only match what TrueMedia says for each case, not anything that sounds like it.
+*/
+var failurePhrases = []struct {
+	reason  FailureReason
+	phrases []string
+}{
+	{FailureReasonPrivateAccount, []string{"account is private", "account is protected", "private account", "protected account"}},
+	{FailureReasonTooLong, []string{"duration exceeds", "too long"}},
+	{FailureReasonUnsupportedMedia, []string{"not supported", "unsupported media"}},
+}
+
+/*
+Works out a FailureReason from TrueMedia's reasons and error messages. A failure code settles it; otherwise
+the free text is checked for known phrases. Anything else is FailureReasonUnknown.
+*/
+func ClassifyFailure(messages ...string) FailureReason {
+	for _, message := range messages {
+		if reason, ok := failureCodes[strings.ToLower(strings.TrimSpace(message))]; ok {
+			return reason
+		}
+	}
+	for _, category := range failurePhrases {
+		for _, message := range messages {
+			message = strings.ToLower(message)
+			for _, phrase := range category.phrases {
+				if strings.Contains(message, phrase) {
+					return category.reason
+				}
+			}
+		}
+	}
+	return FailureReasonUnknown
+}
+
+// Returned when TrueMedia couldn't resolve or analyze media, saying why
+type FailureError struct {
+	Reason FailureReason
+	// What TrueMedia said, for the logs
+	Messages []string
+}
+
+func (e *FailureError) Error() string {
+	return fmt.Sprintf("truemedia failure (%s): %s", e.Reason, strings.Join(e.Messages, "; "))
+}
+
+// Why resolving failed, if it did
+func (r ResolveMediaResponse) Failure() *FailureError {
+	if r.Result == string(ResolveMediaStatusFailed) {
+		return &FailureError{Reason: ClassifyFailure(r.FailureReason, r.FailureDetails), Messages: []string{r.FailureReason, r.FailureDetails}}
+	}
+	if len(r.Media) == 0 {
+		return &FailureError{Reason: FailureReasonUnsupportedMedia, Messages: []string{"no media resolved"}}
+	}
+	return nil
+}
+
+// Why the analysis failed, if it did
+func (r GetResultResponse) Failure() *FailureError {
+	if r.State != AnalysisStateError {
+		return nil
+	}
+	return &FailureError{Reason: ClassifyFailure(r.Errors...), Messages: r.Errors}
+}
@@ -0,0 +1,42 @@
+package truemedia
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	testCases := []struct {
+		messages []string
+		expected FailureReason
+	}{
+		{[]string{"unsupported_media", "GIFs are not supported"}, FailureReasonUnsupportedMedia},
+		{[]string{"fetch_failed", "Account is private"}, FailureReasonPrivateAccount},
+		{[]string{"Video duration exceeds 10 minutes"}, FailureReasonTooLong},
+		{[]string{"too_long", "Video is 42 minutes"}, FailureReasonTooLong},
+		{[]string{"Internal error"}, FailureReasonUnknown},
+		// Transient problems on TrueMedia's side mustn't look like permanent ones
+		{[]string{"Authentication with the detector failed"}, FailureReasonUnknown},
+		{[]string{"403 Forbidden from storage"}, FailureReasonUnknown},
+		{[]string{"Request exceeds the rate limit"}, FailureReasonUnknown},
+		{[]string{"Unexpected response format"}, FailureReasonUnknown},
+		{nil, FailureReasonUnknown},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, ClassifyFailure(testCase.messages...), testCase.messages)
+	}
+}
+
+func TestResolveFailure(t *testing.T) {
+	assert.Nil(t, ResolveMediaResponse{Result: "resolved", Media: []ResolveMediaItem{{ID: "foo.jpg"}}}.Failure())
+	assert.Equal(t, FailureReasonPrivateAccount, ResolveMediaResponse{Result: "failed", FailureReason: "private_account"}.Failure().Reason)
+	assert.Equal(t, FailureReasonUnsupportedMedia, ResolveMediaResponse{Result: "resolved"}.Failure().Reason)
+}
+
+func TestResultFailure(t *testing.T) {
+	assert.Nil(t, GetResultResponse{State: AnalysisStateComplete}.Failure())
+	failure := GetResultResponse{State: AnalysisStateError, Errors: []string{"GIFs are not supported"}}.Failure()
+	assert.Equal(t, FailureReasonUnsupportedMedia, failure.Reason)
+	assert.Equal(t, []string{"GIFs are not supported"}, failure.Messages)
+}
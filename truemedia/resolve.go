@@ -2,6 +2,8 @@ package truemedia
 
 type ResolveMediaRequest struct {
 	PostURL string `json:"postUrl"`
+	// Where TrueMedia should notify the bot when each media item's analysis finishes, if anywhere
+	CallbackURL string `json:"callbackUrl,omitempty"`
 }
 
 type ResolveMediaStatus string
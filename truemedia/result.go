@@ -35,3 +35,9 @@ type GetResultResponse struct {
 	Pending      []string               `json:"pending,omitempty"`
 	Errors       []string               `json:"errors,omitempty"`
 }
+
+// Notification TrueMedia sends to a resolve request's callback URL when a media item's analysis finishes
+type AnalysisCallback struct {
+	ID    string        `json:"id"`
+	State AnalysisState `json:"state"`
+}
@@ -0,0 +1,91 @@
+package truemedia
+
+import (
+	"sort"
+	"strings"
+)
+
+// Kind of media a detector looked at
+type MediaType string
+
+const (
+	MediaTypeImage MediaType = "image"
+	MediaTypeVideo MediaType = "video"
+	MediaTypeAudio MediaType = "audio"
+)
+
+// One detector's result from an analysis
+type ModelScore struct {
+	Model string
+	// How likely the detector thinks the media was manipulated, from 0 to 1
+	Score float64
+	// Position among the analysis's scores, 1 being the highest
+	Rank int
+	// What the detector looked at, or empty if the API didn't say and the model name doesn't tell
+	MediaType MediaType
+}
+
+/*
+Parses Scores into one result per detector, highest score first.
+The API gives each score either as a bare number or as an object with a "score" field and, for newer
+detectors, a "mediaType". Entries in neither shape are skipped.
+*/
+func (r GetResultResponse) ModelScores() []ModelScore {
+	var scores []ModelScore
+	for model, raw := range r.Scores {
+		score := ModelScore{Model: model}
+		switch value := raw.(type) {
+		case float64:
+			score.Score = value
+		case map[string]interface{}:
+			number, ok := value["score"].(float64)
+			if !ok {
+				continue
+			}
+			score.Score = number
+			if mediaType, ok := value["mediaType"].(string); ok {
+				score.MediaType = parseMediaType(mediaType)
+			}
+		default:
+			continue
+		}
+		if score.MediaType == "" {
+			score.MediaType = mediaTypeFromModel(model)
+		}
+		scores = append(scores, score)
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score == scores[j].Score {
+			return scores[i].Model < scores[j].Model
+		}
+		return scores[i].Score > scores[j].Score
+	})
+	for i := range scores {
+		scores[i].Rank = i + 1
+	}
+	return scores
+}
+
+func parseMediaType(raw string) MediaType {
+	switch mediaType := MediaType(strings.ToLower(raw)); mediaType {
+	case MediaTypeImage, MediaTypeVideo, MediaTypeAudio:
+		return mediaType
+	default:
+		return ""
+	}
+}
+
+// Detector names usually say what they look at, e.g. "reality-defender-audio"
+func mediaTypeFromModel(model string) MediaType {
+	model = strings.ToLower(model)
+	switch {
+	case strings.Contains(model, "image"):
+		return MediaTypeImage
+	case strings.Contains(model, "video"):
+		return MediaTypeVideo
+	case strings.Contains(model, "audio"), strings.Contains(model, "voice"):
+		return MediaTypeAudio
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,26 @@
+package truemedia
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelScores(t *testing.T) {
+	result := GetResultResponse{
+		Scores: map[string]interface{}{
+			"faces":       0.2,
+			"voice":       map[string]interface{}{"score": 0.9},
+			"metadata":    "n/a",
+			"lipsync":     map[string]interface{}{"score": 0.5, "mediaType": "VIDEO"},
+			"image-gan":   0.5,
+			"broken-type": map[string]interface{}{"score": "high"},
+		},
+	}
+	assert.Equal(t, []ModelScore{
+		{Model: "voice", Score: 0.9, Rank: 1, MediaType: MediaTypeAudio},
+		{Model: "image-gan", Score: 0.5, Rank: 2, MediaType: MediaTypeImage},
+		{Model: "lipsync", Score: 0.5, Rank: 3, MediaType: MediaTypeVideo},
+		{Model: "faces", Score: 0.2, Rank: 4},
+	}, result.ModelScores())
+}
@@ -0,0 +1,16 @@
+package twitter
+
+// Response from the v1.1 media upload endpoint
+type MediaUploadResponse struct {
+	MediaIDString string `json:"media_id_string"`
+}
+
+// Request body for the v1.1 media metadata endpoint
+type MediaMetadataRequest struct {
+	MediaID string       `json:"media_id"`
+	AltText MediaAltText `json:"alt_text"`
+}
+
+type MediaAltText struct {
+	Text string `json:"text"`
+}
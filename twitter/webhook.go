@@ -0,0 +1,52 @@
+package twitter
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// Header carrying the signature of an Account Activity API webhook request
+const WebhookSignatureHeader = "X-Twitter-Webhooks-Signature"
+
+// Event posted to the webhook by the Account Activity API. Only the events the bot uses are decoded.
+type AccountActivityEvent struct {
+	ForUserID         string         `json:"for_user_id"`
+	TweetCreateEvents []WebhookTweet `json:"tweet_create_events"`
+}
+
+// A v1.1 tweet object, as delivered in tweet_create_events
+type WebhookTweet struct {
+	IDStr                string      `json:"id_str"`
+	Text                 string      `json:"text"`
+	InReplyToStatusIDStr string      `json:"in_reply_to_status_id_str"`
+	User                 WebhookUser `json:"user"`
+	// Set on retweets, which repeat the text of a mention without being one
+	RetweetedStatus *WebhookTweet `json:"retweeted_status"`
+}
+
+type WebhookUser struct {
+	IDStr      string `json:"id_str"`
+	ScreenName string `json:"screen_name"`
+}
+
+// Response to a challenge-response check, which X sends when the webhook is registered and hourly after that
+type CRCResponse struct {
+	ResponseToken string `json:"response_token"`
+}
+
+// Signs a challenge-response check token with the app's consumer secret
+func CRCResponseToken(consumerSecret string, crcToken string) string {
+	return sign(consumerSecret, []byte(crcToken))
+}
+
+// Checks a webhook request body was signed with the app's consumer secret
+func ValidWebhookSignature(consumerSecret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(sign(consumerSecret, body)), []byte(signature))
+}
+
+func sign(consumerSecret string, message []byte) string {
+	mac := hmac.New(sha256.New, []byte(consumerSecret))
+	mac.Write(message)
+	return "sha256=" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,22 @@
+package twitter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCRCResponseToken(t *testing.T) {
+	// base64(HMAC-SHA256("consumer-secret", "crc-token")), worked out independently
+	assert.Equal(t, "sha256=QaSOGVGc8HwsDnfQi3dEVXnS9z5GRw8bGBns3lRY5iQ=", CRCResponseToken("consumer-secret", "crc-token"))
+	assert.NotEqual(t, CRCResponseToken("consumer-secret", "crc-token"), CRCResponseToken("other-secret", "crc-token"))
+}
+
+func TestValidWebhookSignature(t *testing.T) {
+	body := []byte(`{"for_user_id":"123"}`)
+	signature := sign("consumer-secret", body)
+	assert.True(t, ValidWebhookSignature("consumer-secret", body, signature))
+	assert.False(t, ValidWebhookSignature("other-secret", body, signature))
+	assert.False(t, ValidWebhookSignature("consumer-secret", []byte(`{"for_user_id":"456"}`), signature))
+	assert.False(t, ValidWebhookSignature("consumer-secret", body, ""))
+}
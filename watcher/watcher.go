@@ -2,97 +2,425 @@ package watcher
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/g8rswimmer/go-twitter/v2"
 	"github.com/truemediaorg/socialbot/database"
+	"github.com/truemediaorg/socialbot/health"
+	"github.com/truemediaorg/socialbot/metrics"
 	"github.com/truemediaorg/socialbot/model"
+	"github.com/truemediaorg/socialbot/platform"
 	"github.com/truemediaorg/socialbot/service"
-	twitterutil "github.com/truemediaorg/socialbot/twitter"
+	"github.com/truemediaorg/socialbot/tracing"
+	"github.com/truemediaorg/socialbot/truemedia"
 
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	// Advisory lock names are this plus the platform, so each platform can be watched by a different replica
+	watcherLockPrefix = "socialbot-watcher-"
+	// How many pushed mentions can wait to be handled before more are dropped
+	pushedMentionBuffer = 100
+	// How often to beat the heartbeat while sleeping off a rate limit, well inside its max age
+	rateLimitHeartbeatInterval = 1 * time.Minute
+)
+
 type Watcher struct {
-	twitterService   *service.TwitterService
+	platform         platform.SocialPlatform
 	truemediaService *service.TruemediaService
 	db               *database.Database
+
+	// Held while this replica is the one polling the platform for mentions
+	leaderLock *database.Lock
+	// Whether leaderLock is held, for callers outside the polling loop
+	leading atomic.Bool
+	// Stops the leader's mention stream, on platforms that have one, and waits for it to finish
+	stopStream func()
+
+	// Mentions pushed to this replica by the platform, such as from a webhook
+	pushed chan platform.Mention
+	// Asks for a poll now rather than at the end of the poll interval
+	pollNow chan struct{}
+
+	// Mentions are handled one at a time, so this replica doesn't resolve the same one twice. Other replicas
+	// queueing it too are stopped by the database's unique constraint on mentions.
+	handling sync.Mutex
+
+	// Beaten each time round the polling loop, whether or not this replica is the leader
+	Heartbeat *health.Heartbeat
 }
 
-func NewWatcher(twitterService *service.TwitterService, truemediaService *service.TruemediaService, db *database.Database) *Watcher {
+func NewWatcher(socialPlatform platform.SocialPlatform, truemediaService *service.TruemediaService, db *database.Database) *Watcher {
 	return &Watcher{
-		twitterService:   twitterService,
+		platform:         socialPlatform,
 		truemediaService: truemediaService,
 		db:               db,
+		pushed:           make(chan platform.Mention, pushedMentionBuffer),
+		pollNow:          make(chan struct{}, 1),
+	}
+}
+
+/*
+Asks the watcher to poll for mentions now instead of waiting out the poll interval.
+Only the replica leading the platform polls, so this does nothing on the others and returns false.
+*/
+func (w *Watcher) PollNow() bool {
+	if !w.leading.Load() {
+		return false
+	}
+	select {
+	case w.pollNow <- struct{}{}:
+	default:
+		// A poll is already waiting to happen
+	}
+	return true
+}
+
+/*
+Hands the watcher a mention the platform pushed to it, to be queued without waiting for the next poll.
+Doesn't block; if too many are waiting the mention is dropped, and polling finds it later.
+*/
+func (w *Watcher) Push(mention platform.Mention) {
+	select {
+	case w.pushed <- mention:
+	default:
+		log.WithField("platform", w.platform.Platform()).Warnf("too many pushed mentions waiting, leaving mention ID=%s for polling", mention.PlatformID)
 	}
 }
 
 func (w *Watcher) Watch(ctx context.Context) error {
+	platformName := w.platform.Platform()
+	defer w.resign()
+	w.Heartbeat.Beat()
+	// Pushed mentions can arrive at any replica, leader or not
+	go w.handlePushed(ctx)
 	for {
 		select {
 		case <-ctx.Done():
-			log.Debug("exiting Watcher by closing channel")
+			log.WithField("platform", platformName).Debug("exiting Watcher by closing channel")
 			return nil
-		case <-time.After(5 * time.Minute): // check for mentions every 5 minutes because of low rate limit
-			latestTweetID, err := w.db.GetLatestTweetID(ctx)
-			if err != nil {
-				// TODO: better handling if DB connection falters?
+		case <-time.After(w.platform.PollInterval()):
+			if err := w.poll(ctx); err != nil {
+				return err
+			}
+		case <-w.pollNow:
+			log.WithField("platform", platformName).Info("polling on request")
+			if err := w.poll(ctx); err != nil {
 				return err
 			}
-			tweets, err := w.twitterService.GetAllTimelineMentionsSince(ctx, latestTweetID)
-			if err != nil {
-				if rateLimit, ok := twitter.RateLimitFromError(err); ok {
-					// If we hit the rate limit, sleep until it resets and try again
-					log.WithField("limit", rateLimit.Limit).WithField("remaining", rateLimit.Remaining).Warnf("X rate limit encountered, sleeping for %fs", time.Until(rateLimit.Reset.Time()).Seconds())
-					time.Sleep(time.Until(rateLimit.Reset.Time()))
-					continue
-				}
+		}
+	}
+}
+
+/*
+Sleeps until the given time or until ctx is done. X's rate limits can take longer to reset than the
+heartbeat's max age, so this keeps beating; a watcher waiting on a rate limit isn't stuck.
+*/
+func (w *Watcher) sleepUntil(ctx context.Context, until time.Time) {
+	timer := time.NewTimer(time.Until(until))
+	defer timer.Stop()
+	ticker := time.NewTicker(rateLimitHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			return
+		case <-ticker.C:
+			w.Heartbeat.Beat()
+		}
+	}
+}
+
+// Fetches and handles new mentions if this replica is the leader. Returns an error if the watcher should stop.
+func (w *Watcher) poll(ctx context.Context) error {
+	platformName := w.platform.Platform()
+	w.Heartbeat.Beat()
+	if !w.lead(ctx) {
+		return nil
+	}
+	cursor, err := w.cursor(ctx)
+	if err != nil {
+		// TODO: better handling if DB connection falters?
+		return err
+	}
+	pollCtx, span := tracing.StartRoot(ctx, "poll mentions", tracing.AttributePlatform.String(string(platformName)))
+	mentions, err := w.platform.GetMentionsSince(pollCtx, cursor)
+	if err != nil {
+		tracing.RecordError(pollCtx, err)
+	}
+	span.End()
+	if err != nil {
+		if apiError := w.platform.ClassifyError(err); apiError.Kind == platform.APIErrorKindRateLimited {
+			// If we hit the rate limit, sleep until it resets and try again
+			log.WithField("platform", platformName).Warnf("rate limit encountered, sleeping for %fs", time.Until(apiError.RetryAt).Seconds())
+			w.sleepUntil(ctx, apiError.RetryAt)
+			return nil
+		}
+		return err
+	}
+	metrics.MentionsFetched.WithLabelValues(string(platformName), metrics.SourcePoll).Add(float64(len(mentions)))
+	for _, mention := range mentions {
+		if err := w.handleMention(ctx, mention, false); err != nil {
+			log.WithField("platform", platformName).Errorf("error handling mention ID=%s, will retry next poll: %v", mention.PlatformID, err)
+			// Context canceled errors are expected if the program is terminating, so stop the loop in that case
+			if ctx.Err() == context.Canceled {
 				return err
 			}
-			for _, tweet := range tweets {
-				tweetID := tweet.Tweet.ID
-				tweetAuthor := tweet.Author.UserName
-				var mediaTweetReference *twitter.TweetReference
-				log.Debugf("tweet %s has %d referenced tweets", tweetID, len(tweet.ReferencedTweets))
-				for _, referencedTweet := range tweet.ReferencedTweets {
-					log.WithField("referenceType", referencedTweet.Reference.Type).Debug()
-					if twitterutil.IsReplyReference(referencedTweet) && twitterutil.TweetHasMedia(referencedTweet.TweetDictionary.Tweet) {
-						mediaTweetReference = referencedTweet
-						break
-					}
-				}
-				if mediaTweetReference == nil {
-					// If there's no media, just move on to the next mention
-					continue
-				}
-				log.WithField("tweet", mediaTweetReference.TweetDictionary.Tweet).Debug("tweet ID")
-				log.WithField("tweetAuthor", tweetAuthor).Debug("tweet author")
-				log.WithField("tweetID", mediaTweetReference.TweetDictionary.Tweet.ID).Info("found tweet with media")
-				mediaTweetURL := twitterutil.ConstructTweetURL(mediaTweetReference.TweetDictionary.Author.UserName, mediaTweetReference.TweetDictionary.Tweet.ID)
-				log.WithField("mediaTweetURL", mediaTweetURL).Infof("resolving X post ID=%s", mediaTweetReference.TweetDictionary.Tweet.ID)
-				mediaID, err := w.truemediaService.ResolvePostMedia(mediaTweetURL)
-				if err != nil {
-					log.Errorf("error resolving post media: %v", err)
-					continue // HACK: skip this one and move on for now
-				}
-				// Ask for results immediately so analysis begins
-				if results, err := w.truemediaService.GetAnalysis(mediaID); err != nil {
-					log.WithField("mediaID", mediaID).Errorf("error starting analysis: %v", err)
-					// This doesn't stop the presses for this piece of media because the Responder also calls this,
-					// it'll just take longer for the bot to respond with results.
-				} else {
-					log.WithField("mediaID", mediaID).Debugf("initial results: %v", results)
-				}
-				if err := w.db.AddMention(ctx, tweetID, tweetAuthor, model.PlatformX, mediaID); err != nil {
-					log.Errorf("error adding post to database: %v", err)
-					// Context canceled errors are expected if the program is terminating, so stop the loop in that case
-					if ctx.Err() == context.Canceled {
-						return err
-					}
-				}
-				// hacky way to avoid hitting the resolve rate limit
-				time.Sleep(w.truemediaService.ResolveInterval())
+			// The cursor stays put, so this mention and those after it are fetched again next time
+			break
+		}
+	}
+	return nil
+}
+
+// Gets where the last poll left off, falling back to the newest queued mention for accounts without a cursor yet
+func (w *Watcher) cursor(ctx context.Context) (string, error) {
+	cursor, err := w.db.GetCursor(ctx, w.platform.Platform(), w.platform.Account())
+	if err != nil || cursor != "" {
+		return cursor, err
+	}
+	return w.db.GetLatestMentionID(ctx, w.platform.Platform())
+}
+
+/*
+Queues a mention if the bot should reply to it, and moves the cursor past it either way.
+Returns an error without moving the cursor if the mention should be tried again on the next poll.
+Streamed mentions never move the cursor, since the stream may have missed older ones that polling still has to find.
+*/
+func (w *Watcher) handleMention(ctx context.Context, mention platform.Mention, streamed bool) (err error) {
+	w.handling.Lock()
+	defer w.handling.Unlock()
+
+	platformName := w.platform.Platform()
+	ctx, span := tracing.StartRoot(ctx, "handle mention",
+		tracing.AttributePlatform.String(string(platformName)),
+		tracing.AttributeMentionPlatformID.String(mention.PlatformID),
+		tracing.AttributeMediaPostURL.String(mention.MediaPostURL),
+	)
+	defer func() {
+		if err != nil {
+			tracing.RecordError(ctx, err)
+		}
+		span.End()
+	}()
+
+	account := w.platform.Account()
+	if streamed {
+		account = ""
+	}
+	command := model.ParseCommand(mention.Text, w.platform.Handle())
+	if command == model.CommandStop {
+		// Opting out doesn't need media, and there's nothing to reply with
+		if err := w.db.AddOptOut(ctx, platformName, mention.AuthorUserName); err != nil {
+			return fmt.Errorf("error recording opt-out: %w", err)
+		}
+		log.WithField("author", mention.AuthorUserName).Infof("%s user opted out of replies", platformName)
+		return w.advanceCursor(ctx, account, mention.PollCursor())
+	}
+	if mention.MediaPostURL == "" {
+		// If there's no media, just move on to the next mention
+		return w.advanceCursor(ctx, account, mention.PollCursor())
+	}
+	queued, err := w.db.IsMentionQueued(ctx, platformName, mention.PlatformID)
+	if err != nil {
+		return fmt.Errorf("error checking mention queue: %w", err)
+	}
+	if queued {
+		// The stream got to it first, or the other way around
+		log.WithField("platform", platformName).Debugf("mention ID=%s is already queued", mention.PlatformID)
+		return w.advanceCursor(ctx, account, mention.PollCursor())
+	}
+	optedOut, err := w.db.IsOptedOut(ctx, platformName, mention.MediaPostAuthorUserName)
+	if err != nil {
+		return fmt.Errorf("error checking opt-out: %w", err)
+	}
+	if optedOut {
+		log.WithField("mediaPostURL", mention.MediaPostURL).Infof("skipping %s mention ID=%s; the media's author opted out", platformName, mention.PlatformID)
+		return w.advanceCursor(ctx, account, mention.PollCursor())
+	}
+	log.WithField("author", mention.AuthorUserName).Debug("mention author")
+	var failureReason truemedia.FailureReason
+	mediaIDs, err := w.resolveMedia(ctx, mention)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		var failure *truemedia.FailureError
+		if !errors.As(err, &failure) {
+			metrics.MediaResolved.WithLabelValues(string(platformName), metrics.ResolveError, "").Inc()
+			if truemedia.Retryable(err) {
+				// TrueMedia is struggling rather than the post being a problem, so keep the cursor here
+				return fmt.Errorf("error resolving post media: %w", err)
+			}
+			log.Errorf("error resolving post media: %v", err)
+			// HACK: skip this one and move on for now
+			return w.advanceCursor(ctx, account, mention.PollCursor())
+		}
+		// TrueMedia can't analyze the media, so queue the mention anyway for the responder to say why
+		log.WithField("mediaPostURL", mention.MediaPostURL).Warnf("unable to resolve %s post for mention ID=%s: %v", platformName, mention.PlatformID, err)
+		failureReason = failure.Reason
+		metrics.MediaResolved.WithLabelValues(string(platformName), metrics.ResolveFailed, string(failureReason)).Inc()
+	}
+	mentionID, err := w.db.AddMention(ctx, account, mention.PollCursor(), mention.PlatformID, mention.AuthorUserName, platformName, mention.MediaPostURL, mediaIDs, string(failureReason), mention.Language, command, tracing.TraceParent(ctx))
+	if err != nil {
+		return fmt.Errorf("error adding post to database: %w", err)
+	}
+	if mentionID == "" {
+		// Another replica queued it between the check above and now
+		log.WithField("platform", platformName).Debugf("mention ID=%s was already queued", mention.PlatformID)
+		return nil
+	}
+	span.SetAttributes(tracing.AttributeMentionID.String(mentionID))
+	log.WithField("id", mentionID).WithField("traceID", span.SpanContext().TraceID()).Infof("queued %s mention ID=%s", platformName, mention.PlatformID)
+	return nil
+}
+
+/*
+Gets the IDs of the media in the post a mention replies to. Posts that were mentioned before reuse the media
+already resolved for them, so popular posts are resolved and analyzed once rather than once per mention.
+*/
+func (w *Watcher) resolveMedia(ctx context.Context, mention platform.Mention) ([]string, error) {
+	platformName := w.platform.Platform()
+	mediaIDs, err := w.db.FindResolvedMedia(ctx, platformName, mention.MediaPostURL)
+	if err != nil {
+		return nil, fmt.Errorf("error finding earlier mentions of the post: %w", err)
+	}
+	if len(mediaIDs) > 0 {
+		metrics.MediaResolved.WithLabelValues(string(platformName), metrics.ResolveReused, "").Inc()
+		log.WithField("mediaPostURL", mention.MediaPostURL).Infof("%s post for mention ID=%s was already resolved", platformName, mention.PlatformID)
+		return mediaIDs, nil
+	}
+
+	log.WithField("mediaPostURL", mention.MediaPostURL).Infof("resolving %s post for mention ID=%s", platformName, mention.PlatformID)
+	mediaIDs, err = w.truemediaService.ResolvePostMedia(ctx, mention.MediaPostURL)
+	if err != nil {
+		return nil, err
+	}
+	metrics.MediaResolved.WithLabelValues(string(platformName), metrics.ResolveResolved, "").Inc()
+	// Ask for results immediately so analysis begins
+	for _, mediaID := range mediaIDs {
+		if results, err := w.truemediaService.GetAnalysis(ctx, mediaID); err != nil {
+			log.WithField("mediaID", mediaID).Errorf("error starting analysis: %v", err)
+			// This doesn't stop the presses for this piece of media because the Responder also calls this,
+			// it'll just take longer for the bot to respond with results.
+		} else {
+			log.WithField("mediaID", mediaID).Debugf("initial results: %v", results)
+		}
+	}
+	return mediaIDs, nil
+}
+
+// Moves the cursor past a mention, unless there's no account because the mention was streamed
+func (w *Watcher) advanceCursor(ctx context.Context, account string, cursor string) error {
+	if account == "" {
+		return nil
+	}
+	return w.db.AdvanceCursor(ctx, w.platform.Platform(), account, cursor)
+}
+
+func (w *Watcher) handlePushed(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case mention := <-w.pushed:
+			metrics.MentionsFetched.WithLabelValues(string(w.platform.Platform()), metrics.SourcePush).Inc()
+			if err := w.handleMention(ctx, mention, true); err != nil {
+				// Polling will come across it again
+				log.WithField("platform", w.platform.Platform()).Errorf("error handling pushed mention ID=%s: %v", mention.PlatformID, err)
+			}
+		}
+	}
+}
+
+/*
+Streams mentions into handleMention while this replica is the leader, on platforms configured to stream.
+Polling carries on as well, picking up anything sent while the stream was down.
+*/
+func (w *Watcher) startStream(ctx context.Context) {
+	streamer, ok := w.platform.(platform.MentionStreamer)
+	if !ok || !streamer.StreamingEnabled() {
+		return
+	}
+	platformName := w.platform.Platform()
+	streamCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	w.stopStream = func() {
+		cancel()
+		<-done
+	}
+
+	mentions := make(chan platform.Mention)
+	go func() {
+		defer close(mentions)
+		if err := streamer.StreamMentions(streamCtx, mentions); err != nil {
+			log.WithField("platform", platformName).Errorf("mention stream stopped, falling back to polling: %v", err)
+		}
+	}()
+	go func() {
+		defer close(done)
+		for mention := range mentions {
+			metrics.MentionsFetched.WithLabelValues(string(platformName), metrics.SourceStream).Inc()
+			if err := w.handleMention(streamCtx, mention, true); err != nil {
+				// Polling will come across it again
+				log.WithField("platform", platformName).Errorf("error handling streamed mention ID=%s: %v", mention.PlatformID, err)
 			}
 		}
+	}()
+}
+
+/*
+Elects one replica to poll the platform, so mentions aren't resolved and queued twice.
+The leader holds a Postgres advisory lock for the platform; the others keep trying to take it on every
+poll, which they can once the leader exits or loses its database connection.
+*/
+func (w *Watcher) lead(ctx context.Context) bool {
+	platformName := w.platform.Platform()
+	if w.leaderLock != nil {
+		if err := w.leaderLock.Check(ctx); err == nil {
+			return true
+		}
+		log.WithField("platform", platformName).Warn("lost connection holding the watcher lock, stepping down")
+		w.resign()
+	}
+
+	lock, err := w.db.TryLock(ctx, watcherLockPrefix+string(platformName))
+	if err != nil {
+		log.WithField("platform", platformName).Errorf("error taking the watcher lock: %v", err)
+		return false
+	}
+	if lock == nil {
+		log.WithField("platform", platformName).Debug("another replica is watching for mentions")
+		return false
+	}
+	log.WithField("platform", platformName).Info("watching for mentions on this replica")
+	w.leaderLock = lock
+	w.leading.Store(true)
+	w.startStream(ctx)
+	return true
+}
+
+// Gives up leadership, if this replica has it
+func (w *Watcher) resign() {
+	if w.stopStream != nil {
+		w.stopStream()
+		w.stopStream = nil
+	}
+	if w.leaderLock == nil {
+		return
+	}
+	// The watcher's context may already be canceled, but the lock should still be released
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := w.leaderLock.Release(ctx); err != nil {
+		log.WithField("platform", w.platform.Platform()).Warnf("error releasing the watcher lock: %v", err)
 	}
+	w.leaderLock = nil
+	w.leading.Store(false)
 }